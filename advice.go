@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// buyTier recommends how much to buy once a price is at least MinDiscount
+// percent below its threshold
+type buyTier struct {
+	MinDiscount float64
+	Advice      string
+}
+
+// defaultBuyTiers is used with BUY_ADVICE when BUY_ADVICE_TIERS is not set
+var defaultBuyTiers = []buyTier{
+	{MinDiscount: 15, Advice: "Great price: top off fully"},
+	{MinDiscount: 5, Advice: "Decent price: buy about half"},
+	{MinDiscount: 0, Advice: "Small dip: buy only what you need"},
+}
+
+// parseBuyTiers reads BUY_ADVICE_TIERS, e.g. "20:Top off fully;5:Buy half;0:Buy what you need".
+// Tiers are returned deepest discount first.
+func parseBuyTiers(value string) ([]buyTier, error) {
+	var tiers []buyTier
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pct, advice, ok := strings.Cut(entry, ":")
+		advice = strings.TrimSpace(advice)
+		if !ok || advice == "" {
+			return nil, fmt.Errorf("BUY_ADVICE_TIERS entries must be PERCENT:advice, got: %s", entry)
+		}
+		minDiscount, err := strconv.ParseFloat(strings.TrimSpace(pct), 64)
+		if err != nil || minDiscount < 0 || minDiscount >= 100 {
+			return nil, fmt.Errorf("BUY_ADVICE_TIERS percent must be from 0 to below 100, got: %s", pct)
+		}
+		tiers = append(tiers, buyTier{MinDiscount: minDiscount, Advice: advice})
+	}
+	if len(tiers) == 0 {
+		return nil, fmt.Errorf("BUY_ADVICE_TIERS must list at least one PERCENT:advice entry")
+	}
+
+	sort.SliceStable(tiers, func(i, j int) bool { return tiers[i].MinDiscount > tiers[j].MinDiscount })
+	return tiers, nil
+}
+
+// adviceFor returns the deepest tier the price qualifies for, or "" when none does
+func adviceFor(tiers []buyTier, price, threshold int) (string, float64) {
+	if price <= 0 || threshold <= 0 || price > threshold {
+		return "", 0
+	}
+	discount := float64(threshold-price) / float64(threshold) * 100
+	for _, tier := range tiers {
+		if discount >= tier.MinDiscount {
+			return tier.Advice, discount
+		}
+	}
+	return "", discount
+}
+
+// buyAdviceNote suggests how much to buy based on how far the alerted prices
+// are below their thresholds, or returns an empty string without BUY_ADVICE.
+// With ALERT_MODE=relative the advice is part of relativeNote instead.
+func buyAdviceNote(cfg *Config, slot *PriceSlot, fuel, co2 bool) string {
+	if len(cfg.BuyTiers) == 0 || cfg.AlertMode == "relative" {
+		return ""
+	}
+
+	var lines []string
+	if fuel {
+		if advice, discount := adviceFor(cfg.BuyTiers, slot.FuelPrice, cfg.FuelThreshold); advice != "" {
+			lines = append(lines, fmt.Sprintf("Fuel (%.0f%% below threshold): %s", discount, advice))
+		}
+	}
+	if co2 {
+		if advice, discount := adviceFor(cfg.BuyTiers, slot.CO2Price, cfg.CO2Threshold); advice != "" {
+			lines = append(lines, fmt.Sprintf("CO2 (%.0f%% below threshold): %s", discount, advice))
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return "\n\n" + strings.Join(lines, "\n")
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseBuyTiers(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  []buyTier
+		err   string
+	}{
+		{
+			name:  "sorted deepest first",
+			value: "0:Buy what you need; 20:Top off fully;5:Buy half",
+			want: []buyTier{
+				{MinDiscount: 20, Advice: "Top off fully"},
+				{MinDiscount: 5, Advice: "Buy half"},
+				{MinDiscount: 0, Advice: "Buy what you need"},
+			},
+		},
+		{
+			name:  "decimal percent and empty entries",
+			value: ";7.5: Buy some ;",
+			want:  []buyTier{{MinDiscount: 7.5, Advice: "Buy some"}},
+		},
+		{name: "missing advice", value: "10:", err: "must be PERCENT:advice"},
+		{name: "missing colon", value: "10 buy half", err: "must be PERCENT:advice"},
+		{name: "percent not a number", value: "lots:Buy", err: "from 0 to below 100"},
+		{name: "negative percent", value: "-5:Buy", err: "from 0 to below 100"},
+		{name: "percent of 100", value: "100:Free fuel", err: "from 0 to below 100"},
+		{name: "no entries", value: " ; ", err: "at least one"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseBuyTiers(tt.value)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("error %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseBuyTiers: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdviceFor(t *testing.T) {
+	tests := []struct {
+		name      string
+		price     int
+		threshold int
+		advice    string
+		discount  float64
+	}{
+		{"deep discount takes the deepest tier", 340, 400, "Great price: top off fully", 15},
+		{"between tiers", 370, 400, "Decent price: buy about half", 7.5},
+		{"just below the second tier", 381, 400, "Small dip: buy only what you need", 4.75},
+		{"price at the threshold", 400, 400, "Small dip: buy only what you need", 0},
+		{"price above the threshold", 401, 400, "", 0},
+		{"no price", 0, 400, "", 0},
+		{"no threshold", 300, 0, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			advice, discount := adviceFor(defaultBuyTiers, tt.price, tt.threshold)
+			if advice != tt.advice || discount != tt.discount {
+				t.Errorf("adviceFor(%d, %d) = %q, %g%%, want %q, %g%%",
+					tt.price, tt.threshold, advice, discount, tt.advice, tt.discount)
+			}
+		})
+	}
+
+	// Without a 0% tier a price at the threshold gets no advice
+	tiers := []buyTier{{MinDiscount: 10, Advice: "Buy"}}
+	if advice, _ := adviceFor(tiers, 400, 400); advice != "" {
+		t.Errorf("advice %q at the threshold without a 0%% tier, want none", advice)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// deletePollInterval is how often scheduled deletions are checked for being due
+const deletePollInterval = time.Minute
+
+// pendingDelete is a sent alert scheduled for removal by AUTO_DELETE_AFTER
+type pendingDelete struct {
+	ChatID    string `json:"chat_id"`
+	MessageID int64  `json:"message_id"`
+	At        string `json:"at"`
+}
+
+// scheduleDelete queues a sent alert for deletion after AUTO_DELETE_AFTER
+func scheduleDelete(cfg *Config, cd *cooldown, sent *sentMessage) {
+	cd.pendingDeletes = append(cd.pendingDeletes, pendingDelete{
+		ChatID:    strconv.FormatInt(sent.Chat.ID, 10),
+		MessageID: sent.MessageID,
+		At:        formatStateTime(time.Now().Add(cfg.AutoDeleteAfter)),
+	})
+}
+
+// watchDeletions deletes scheduled alerts once they are due, until ctx is cancelled
+func watchDeletions(ctx context.Context, client *http.Client, cfg *Config, cd *cooldown) {
+	ticker := time.NewTicker(deletePollInterval)
+	defer ticker.Stop()
+
+	for {
+		deleteDueMessages(client, cfg, cd)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// deleteDueMessages deletes every due message. Messages that are already gone
+// or can no longer be deleted are dropped, other failures are retried later.
+func deleteDueMessages(client *http.Client, cfg *Config, cd *cooldown) {
+	cd.mu.Lock()
+	now := time.Now()
+	var due []pendingDelete
+	for _, p := range cd.pendingDeletes {
+		if !now.Before(parseStateTime(p.At)) {
+			due = append(due, p)
+		}
+	}
+	cd.mu.Unlock()
+	if len(due) == 0 {
+		return
+	}
+
+	// Delete without the state lock, then drop the handled messages from the
+	// list, which may have grown meanwhile
+	var done []pendingDelete
+	for _, p := range due {
+		err := deleteTelegramMessage(client, cfg, p.ChatID, p.MessageID)
+		switch {
+		case err == nil:
+			log.Printf("Deleted alert message %d (AUTO_DELETE_AFTER)", p.MessageID)
+		case strings.Contains(err.Error(), "message to delete not found"):
+			log.Printf("Alert message %d was already deleted", p.MessageID)
+		case strings.Contains(err.Error(), "message can't be deleted"):
+			log.Printf("WARNING: Alert message %d can no longer be deleted: %s", p.MessageID, err)
+		default:
+			log.Printf("ERROR deleting alert message %d, retrying later: %s", p.MessageID, err)
+			continue
+		}
+		done = append(done, p)
+	}
+	if len(done) == 0 {
+		return
+	}
+
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+	cd.pendingDeletes = slices.DeleteFunc(cd.pendingDeletes, func(p pendingDelete) bool {
+		return slices.Contains(done, p)
+	})
+	saveCooldown(cd)
+}
+
+// deleteTelegramMessage deletes a message sent by the bot
+func deleteTelegramMessage(client *http.Client, cfg *Config, chatID string, messageID int64) error {
+	payload := telegramMessage{ChatID: chatID, MessageID: messageID}
+	_, err := callTelegram(client, cfg, "deleteMessage", payload)
+	return err
+}
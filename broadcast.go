@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// parseChatIDs reads a comma-separated list of chat IDs. Numeric-only IDs get
+// the "-" prefix like TELEGRAM_CHAT_ID.
+func parseChatIDs(value string) []string {
+	var chatIDs []string
+	for _, chatID := range strings.Split(value, ",") {
+		chatID = strings.TrimSpace(chatID)
+		if chatID == "" {
+			continue
+		}
+		if isNumericOnly(chatID) {
+			chatID = "-" + chatID
+		}
+		chatIDs = append(chatIDs, chatID)
+	}
+	return chatIDs
+}
+
+// sendAll sends a message to every recipient with at most SEND_CONCURRENCY
+// sends in flight. Each send counts against MAX_SENDS_PER_MINUTE like any
+// other. The failures are returned joined, each naming its recipient.
+func sendAll(client *http.Client, cfg *Config, recipients []Notifier, message string, opts sendOptions) error {
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	errs := make([]error, len(recipients))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(max(cfg.SendConcurrency, 1), len(recipients)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if err := sendThrottled(client, cfg, recipients[i], message, opts); err != nil {
+					errs[i] = fmt.Errorf("%s: %w", recipients[i].Target(), err)
+				}
+			}
+		}()
+	}
+	for i := range recipients {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// sendToChats sends a price alert to more Telegram chats, silent and in the
+// parse mode of the alert to TELEGRAM_CHAT_ID
+func sendToChats(client *http.Client, cfg *Config, chatIDs []string, message string, opts sendOptions) error {
+	recipients := make([]Notifier, len(chatIDs))
+	for i, chatID := range chatIDs {
+		recipients[i] = &telegramNotifier{cfg: cfg, chatID: chatID}
+	}
+	return sendAll(client, cfg, recipients, message, sendOptions{Silent: opts.Silent, ParseMode: opts.ParseMode})
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowNotifier takes delay per send and tracks how many sends of all
+// slowNotifiers sharing inFlight run at once
+type slowNotifier struct {
+	name     string
+	delay    time.Duration
+	err      error
+	inFlight *atomic.Int32
+	peak     *atomic.Int32
+	sent     atomic.Int32
+}
+
+func (n *slowNotifier) Send(client *http.Client, message string, opts sendOptions) error {
+	running := n.inFlight.Add(1)
+	defer n.inFlight.Add(-1)
+	for {
+		peak := n.peak.Load()
+		if running <= peak || n.peak.CompareAndSwap(peak, running) {
+			break
+		}
+	}
+	time.Sleep(n.delay)
+	if n.err != nil {
+		return n.err
+	}
+	n.sent.Add(1)
+	return nil
+}
+
+func (n *slowNotifier) Target() string { return n.name }
+
+func TestSendAll(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	errBlocked := errors.New("bot was blocked by the user")
+	errNotFound := errors.New("chat not found")
+
+	chats := make([]*slowNotifier, 9)
+	recipients := make([]Notifier, len(chats))
+	for i := range chats {
+		chats[i] = &slowNotifier{name: fmt.Sprintf("chat %d", i), delay: 50 * time.Millisecond, inFlight: &inFlight, peak: &peak}
+		recipients[i] = chats[i]
+	}
+	chats[2].err = errBlocked
+	chats[7].err = errNotFound
+
+	cfg := &Config{SendConcurrency: 3}
+	start := time.Now()
+	err := sendAll(nil, cfg, recipients, "Fuel is cheap", sendOptions{})
+	elapsed := time.Since(start)
+
+	if got := peak.Load(); got != 3 {
+		t.Errorf("%d sends ran at once, want SEND_CONCURRENCY=3", got)
+	}
+	// 9 sends of 50ms, 3 at a time, take about 150ms rather than 450ms
+	if elapsed > 400*time.Millisecond {
+		t.Errorf("sends took %s, want them in parallel", elapsed)
+	}
+	for i, chat := range chats {
+		want := int32(1)
+		if chat.err != nil {
+			want = 0
+		}
+		if got := chat.sent.Load(); got != want {
+			t.Errorf("chat %d got %d messages, want %d", i, got, want)
+		}
+	}
+
+	// Every failure is reported with its recipient, the others still went out
+	if !errors.Is(err, errBlocked) || !errors.Is(err, errNotFound) {
+		t.Fatalf("error %v, want both failures joined", err)
+	}
+	for _, want := range []string{"chat 2: bot was blocked by the user", "chat 7: chat not found"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+
+	if err := sendAll(nil, cfg, nil, "Fuel is cheap", sendOptions{}); err != nil {
+		t.Errorf("sendAll without recipients: %v", err)
+	}
+}
+
+func TestSendAllThrottle(t *testing.T) {
+	t.Cleanup(func() {
+		sendThrottle.mu.Lock()
+		sendThrottle.sent, sendThrottle.tripped = nil, false
+		sendThrottle.mu.Unlock()
+	})
+
+	// Each parallel send counts against MAX_SENDS_PER_MINUTE
+	var inFlight, peak atomic.Int32
+	recipients := make([]Notifier, 5)
+	for i := range recipients {
+		recipients[i] = &slowNotifier{name: fmt.Sprintf("chat %d", i), inFlight: &inFlight, peak: &peak}
+	}
+	notice := &slowNotifier{name: "notice", inFlight: &inFlight, peak: &peak}
+	cfg := &Config{SendConcurrency: 5, MaxSendsPerMinute: 3, Notifier: notice}
+
+	err := sendAll(nil, cfg, recipients, "Fuel is cheap", sendOptions{})
+	if err == nil || strings.Count(err.Error(), "send throttle of 3 messages per minute exceeded") != 2 {
+		t.Errorf("error %v, want 2 sends dropped by the throttle", err)
+	}
+	if got := notice.sent.Load(); got != 1 {
+		t.Errorf("sent %d safety limit notices, want 1", got)
+	}
+}
+
+func TestSendToChats(t *testing.T) {
+	var mu sync.Mutex
+	received := map[string]telegramMessage{}
+	client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg telegramMessage
+		json.NewDecoder(r.Body).Decode(&msg)
+		mu.Lock()
+		received[msg.ChatID] = msg
+		mu.Unlock()
+		if msg.ChatID == "-1003" {
+			w.Write([]byte(`{"ok":false,"error_code":403,"description":"Forbidden: bot was kicked from the group chat"}`))
+			return
+		}
+		w.Write([]byte(`{"ok":true,"result":{"message_id":7}}`))
+	}))
+	cfg := checkConfig(t)
+	cfg.SendConcurrency = 2
+	chatIDs := []string{"-1002", "-1003", "@fuelchannel"}
+
+	// The reply and sent ID of the alert to TELEGRAM_CHAT_ID stay with that chat
+	var sent sentMessage
+	opts := sendOptions{Silent: true, ParseMode: "MarkdownV2", ReplyTo: 42, Sent: &sent}
+	err := sendToChats(client, cfg, chatIDs, "*Fuel* is cheap", opts)
+	if err == nil || !strings.Contains(err.Error(), "Telegram chat -1003: Telegram API error: Forbidden") {
+		t.Errorf("error %v, want the kicked chat named", err)
+	}
+
+	if len(received) != 3 {
+		t.Fatalf("sent to %d chats, want 3: %v", len(received), received)
+	}
+	for _, chatID := range chatIDs {
+		msg, ok := received[chatID]
+		if !ok {
+			t.Errorf("nothing sent to %s", chatID)
+			continue
+		}
+		if msg.Text != "*Fuel* is cheap" || msg.ParseMode != "MarkdownV2" || !msg.DisableNotification {
+			t.Errorf("%s got %+v, want the silent MarkdownV2 alert", chatID, msg)
+		}
+		if msg.ReplyParameters != nil {
+			t.Errorf("%s got a reply to message %d", chatID, msg.ReplyParameters.MessageID)
+		}
+	}
+	if sent != (sentMessage{}) {
+		t.Errorf("sent = %+v, want the extra chats to leave it alone", sent)
+	}
+}
+
+func TestSendToChatsIgnoresMigration(t *testing.T) {
+	var requests atomic.Int32
+	client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: group chat was upgraded to a supergroup chat","parameters":{"migrate_to_chat_id":-1009}}`))
+	}))
+	cfg := checkConfig(t)
+
+	// An extra chat that moved is reported, it must not redirect TELEGRAM_CHAT_ID
+	if err := sendToChats(client, cfg, []string{"-1002"}, "Fuel is cheap", sendOptions{}); err == nil {
+		t.Error("migrated extra chat reported no error")
+	}
+	if got := targetChatID(cfg); got != configuredChatID(cfg) || requests.Load() != 1 {
+		t.Errorf("alerts now go to %s after %d requests, want %s untouched", got, requests.Load(), configuredChatID(cfg))
+	}
+}
+
+func TestParseChatIDs(t *testing.T) {
+	if got, want := parseChatIDs(" 1002 , -1003,,@fuelchannel "), []string{"-1002", "-1003", "@fuelchannel"}; !slices.Equal(got, want) {
+		t.Errorf("parseChatIDs = %q, want %q", got, want)
+	}
+	if got := parseChatIDs(""); got != nil {
+		t.Errorf("parseChatIDs(\"\") = %q, want none", got)
+	}
+}
+
+func TestExtraChatsNeedTelegram(t *testing.T) {
+	matrix := "NOTIFIER=matrix\nMATRIX_HOMESERVER=https://matrix.example.com\nMATRIX_ROOM=!room:example.com\nMATRIX_TOKEN=token\n" +
+		"SESSION_TOKEN=session\nFUEL_THRESHOLD=450\nCO2_THRESHOLD=10\n"
+	writeTestEnv(t, matrix)
+	if _, err := loadConfig(nil); err != nil {
+		t.Fatalf("loadConfig with NOTIFIER=matrix: %v", err)
+	}
+
+	// The extra chats are sent over Telegram, so they can't go with another notifier
+	for _, setting := range []string{"EXTRA_CHAT_IDS=-1002", "TIER_CHATS=15:@fueldeals"} {
+		writeTestEnv(t, matrix+setting+"\n")
+		if _, err := loadConfig(nil); err == nil || !strings.Contains(err.Error(), "require NOTIFIER=telegram") {
+			t.Errorf("%s with NOTIFIER=matrix: err = %v, want it refused", setting, err)
+		}
+	}
+}
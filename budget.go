@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+// contextTransport binds every request to ctx, so a CHECK_BUDGET deadline
+// covers all requests of a check without passing the context to each call
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.base.RoundTrip(req.WithContext(t.ctx))
+}
+
+// withCheckBudget returns a copy of client whose requests all end at the
+// CHECK_BUDGET deadline, or client itself when no budget is set
+func withCheckBudget(client *http.Client, cfg *Config) (*http.Client, context.Context, context.CancelFunc) {
+	if cfg.CheckBudget <= 0 {
+		return client, context.Background(), func() {}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.CheckBudget)
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	budgeted := *client
+	budgeted.Transport = &contextTransport{ctx: ctx, base: base}
+	return &budgeted, ctx, cancel
+}
+
+// clientContext returns the context a budgeted client binds its requests to,
+// so waits outside the requests end at the same deadline. Any other client
+// gets a background context.
+func clientContext(client *http.Client) context.Context {
+	if t, ok := client.Transport.(*contextTransport); ok {
+		return t.ctx
+	}
+	return context.Background()
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheckBudget(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler func(w http.ResponseWriter, r *http.Request)
+	}{
+		{"5xx retries", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+		}},
+		{"slow responses", func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				tt.handler(w, r)
+			}))
+			// Unbounded, six attempts with backoff would take far longer than the budget
+			cfg := checkConfig(t)
+			cfg.CheckBudget = 300 * time.Millisecond
+			cfg.FetchRetries, cfg.FetchBackoff = 5, 200*time.Millisecond
+			notifier := &recordingNotifier{}
+			cfg.Notifier = notifier
+			cd := &cooldown{store: &memoryStore{}}
+
+			start := time.Now()
+			checkPrices(client, cfg, cd)
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("checkPrices took %s, want it bounded by CHECK_BUDGET", elapsed)
+			}
+			if n := requests.Load(); n == 0 || n >= 6 {
+				t.Errorf("made %d price requests, want the retries cut short", n)
+			}
+			if cd.stats.FetchErrors != 1 || !cd.lastCheck.IsZero() {
+				t.Errorf("fetch errors %d, last check %s, want the check abandoned", cd.stats.FetchErrors, cd.lastCheck)
+			}
+			if sent := notifier.sent(); len(sent) != 0 {
+				t.Errorf("sent %q after the budget ran out", sent)
+			}
+		})
+	}
+}
+
+func TestWithCheckBudget(t *testing.T) {
+	client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	same, ctx, cancel := withCheckBudget(client, &Config{})
+	cancel()
+	if same != client || ctx.Done() != nil {
+		t.Error("without CHECK_BUDGET the client or context is bounded")
+	}
+
+	// Once the deadline passed, every request through the budgeted client fails,
+	// including sends that don't take a context of their own
+	budgeted, ctx, cancel := withCheckBudget(client, &Config{CheckBudget: time.Millisecond})
+	defer cancel()
+	<-ctx.Done()
+	_, err := budgeted.Get("https://api.telegram.org/bot123:abc/sendMessage")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("request after the deadline: %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestFloodWaitEndsWithBudget(t *testing.T) {
+	var requests atomic.Int32
+	client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1}}`))
+	}))
+	floodControl.mu.Lock()
+	floodControl.notBefore = time.Now().Add(30 * time.Second)
+	floodControl.mu.Unlock()
+	t.Cleanup(func() {
+		floodControl.mu.Lock()
+		floodControl.notBefore = time.Time{}
+		floodControl.mu.Unlock()
+	})
+
+	budgeted, _, cancel := withCheckBudget(client, &Config{CheckBudget: 50 * time.Millisecond})
+	defer cancel()
+	start := time.Now()
+	_, err := postTelegram(budgeted, &Config{TelegramChatID: "-1001"}, "sendMessage", telegramMessage{Text: "hi"})
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("postTelegram waited %s, want the flood wait cut short by CHECK_BUDGET", elapsed)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) || requests.Load() != 0 {
+		t.Errorf("postTelegram: %v after %d requests, want %v before sending", err, requests.Load(), context.DeadlineExceeded)
+	}
+}
+
+func TestEmailSendEndsWithBudget(t *testing.T) {
+	// An SMTP server that accepts the connection but never greets
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	notifier := &emailNotifier{host: host, port: port, from: "bot@example.com", to: []string{"me@example.com"}}
+	budgeted, _, cancel := withCheckBudget(&http.Client{}, &Config{CheckBudget: 200 * time.Millisecond})
+	defer cancel()
+
+	start := time.Now()
+	err = notifier.Send(budgeted, "Fuel is cheap", sendOptions{})
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("email send took %s, want it cut short by CHECK_BUDGET", elapsed)
+	}
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("email send: %v, want a timeout", err)
+	}
+}
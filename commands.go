@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pollTimeout is the getUpdates long-poll timeout, kept below the HTTP client timeout
+const pollTimeout = 25
+
+// telegramUpdate is a single entry from getUpdates
+type telegramUpdate struct {
+	UpdateID    int64             `json:"update_id"`
+	Message     *telegramIncoming `json:"message"`
+	ChannelPost *telegramIncoming `json:"channel_post"`
+}
+
+// telegramIncoming is the part of an incoming message or channel post the bot uses
+type telegramIncoming struct {
+	Chat struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+	// Sender, missing for channel posts
+	From *struct {
+		ID int64 `json:"id"`
+	} `json:"from"`
+	Text string `json:"text"`
+}
+
+// updatesResponse is the getUpdates API response
+type updatesResponse struct {
+	OK          bool             `json:"ok"`
+	Description string           `json:"description"`
+	Result      []telegramUpdate `json:"result"`
+}
+
+// commandHandler handles a chat command and returns the reply text, or an
+// empty string when it has already replied itself. The context ends after
+// COMMAND_TIMEOUT, handlers pass it to their API requests.
+type commandHandler func(ctx context.Context, client *http.Client, cfg *Config, cd *cooldown, args []string) string
+
+// commandHandlers maps command names (without the leading slash) to their handlers
+var commandHandlers = map[string]commandHandler{
+	"ack":        handleAck,
+	"export":     handleExport,
+	"interval":   handleInterval,
+	"preview":    handlePreview,
+	"prices":     handlePrices,
+	"recent":     handleRecent,
+	"reset":      handleReset,
+	"setco2":     handleSetCO2,
+	"setfuel":    handleSetFuel,
+	"slot":       handleSlot,
+	"snooze":     handleSnooze,
+	"status":     handleStatus,
+	"thresholds": handleThresholds,
+	"watch":      handleWatch,
+}
+
+// pollCommands long-polls getUpdates and handles commands until ctx is cancelled.
+// The update offset is persisted in the cooldown state so a restart neither
+// re-runs old commands nor skips new ones.
+func pollCommands(ctx context.Context, client *http.Client, cfg *Config, cd *cooldown) {
+	log.Println("Command polling started")
+
+	for {
+		cd.mu.Lock()
+		offset := cd.updateOffset
+		cd.mu.Unlock()
+
+		updates, err := getUpdates(ctx, client, cfg, offset)
+		if ctx.Err() != nil {
+			log.Println("Command polling stopped")
+			return
+		}
+		if err != nil {
+			log.Printf("ERROR polling Telegram updates: %s", err)
+			select {
+			case <-time.After(5 * time.Second):
+				continue
+			case <-ctx.Done():
+				log.Println("Command polling stopped")
+				return
+			}
+		}
+
+		for _, update := range updates {
+			handleUpdate(ctx, client, cfg, cd, update)
+
+			// Confirm the update, Telegram drops everything below the next offset
+			cd.mu.Lock()
+			cd.updateOffset = update.UpdateID + 1
+			saveCooldown(cd)
+			cd.mu.Unlock()
+		}
+	}
+}
+
+// getUpdates fetches pending updates starting at offset, waiting up to pollTimeout seconds
+func getUpdates(ctx context.Context, client *http.Client, cfg *Config, offset int64) ([]telegramUpdate, error) {
+	params := url.Values{}
+	params.Set("timeout", strconv.Itoa(pollTimeout))
+	params.Set("allowed_updates", `["message","channel_post"]`)
+	if offset > 0 {
+		params.Set("offset", strconv.FormatInt(offset, 10))
+	}
+
+	apiURL := fmt.Sprintf("https://api.telegram.org/bot%s/getUpdates?%s", cfg.TelegramBotToken, params.Encode())
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Telegram request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Telegram response: %w", err)
+	}
+
+	var updResp updatesResponse
+	if err := json.Unmarshal(body, &updResp); err != nil {
+		return nil, fmt.Errorf("failed to parse Telegram response: %w", err)
+	}
+
+	if !updResp.OK {
+		return nil, fmt.Errorf("Telegram API error: %s", updResp.Description)
+	}
+
+	return updResp.Result, nil
+}
+
+// handleUpdate runs the command in an update if it comes from the configured chat
+func handleUpdate(ctx context.Context, client *http.Client, cfg *Config, cd *cooldown, update telegramUpdate) {
+	msg := update.Message
+	if msg == nil {
+		msg = update.ChannelPost
+	}
+	if msg == nil || !strings.HasPrefix(msg.Text, "/") {
+		return
+	}
+
+	fields := strings.Fields(msg.Text)
+	// Strip the leading slash and an optional @botname suffix (/reset@my_bot)
+	name := strings.ToLower(strings.TrimPrefix(fields[0], "/"))
+	if idx := strings.Index(name, "@"); idx >= 0 {
+		name = name[:idx]
+	}
+
+	chatID := strconv.FormatInt(msg.Chat.ID, 10)
+	if chatID != targetChatID(cfg) {
+		log.Printf("Ignoring /%s from unauthorized chat %s", name, chatID)
+		return
+	}
+
+	handler, ok := commandHandlers[name]
+	if !ok && !(cfg.ConfirmCommands && name == "confirm") {
+		return
+	}
+
+	var from int64
+	if msg.From != nil {
+		from = msg.From.ID
+	}
+
+	log.Printf("Received command: %s", msg.Text)
+
+	// Bound the handler so a slow API can't wedge command polling
+	ctx, cancel := context.WithTimeout(ctx, cfg.CommandTimeout)
+	defer cancel()
+	var reply string
+	switch {
+	case cfg.ConfirmCommands && name == "confirm":
+		reply = confirmPending(ctx, client, cfg, cd, from)
+	case cfg.ConfirmCommands && confirmCommands[name] && len(fields) > 1:
+		// Without arguments these commands only show their usage
+		reply = requestConfirmation(cd, name, fields[1:], from)
+	default:
+		reply = handler(ctx, client, cfg, cd, fields[1:])
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		log.Printf("WARNING: /%s took longer than %s (COMMAND_TIMEOUT)", name, formatDuration(cfg.CommandTimeout))
+		reply = "This is taking too long, please try again in a moment."
+	}
+	if reply == "" {
+		// The handler already replied, e.g. with a document
+		return
+	}
+	if err := notify(client, cfg, reply); err != nil {
+		log.Printf("ERROR replying to /%s: %s", name, err)
+	}
+}
+
+// handleReset clears dedup state so the next check can alert again.
+// Usage: /reset [fuel|co2|stats|all], no argument resets both price types.
+func handleReset(ctx context.Context, client *http.Client, cfg *Config, cd *cooldown, args []string) string {
+	what := "prices"
+	if len(args) > 0 {
+		what = strings.ToLower(args[0])
+	}
+
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+
+	var reply string
+	switch what {
+	case "prices":
+		cd.lastFuelSlot = ""
+		cd.lastCO2Slot = ""
+		reply = "Fuel and CO2 cooldown reset."
+	case "fuel":
+		cd.lastFuelSlot = ""
+		reply = "Fuel cooldown reset."
+	case "co2":
+		cd.lastCO2Slot = ""
+		reply = "CO2 cooldown reset."
+	case "stats":
+		cd.stats = checkStats{}
+		reply = "Stats reset."
+	case "all":
+		cd.lastFuelSlot = ""
+		cd.lastCO2Slot = ""
+		cd.stats = checkStats{}
+		reply = "Fuel and CO2 cooldown and stats reset."
+	default:
+		return "Usage: /reset [fuel|co2|stats|all]"
+	}
+
+	saveCooldown(cd)
+	log.Printf("Cooldown state reset via command: %s", what)
+	return reply
+}
+
+// handlePreview renders the alert the latest prices would trigger, without
+// sending it as an alert or touching the dedup state
+func handlePreview(ctx context.Context, client *http.Client, cfg *Config, cd *cooldown, args []string) string {
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+
+	if cd.lastPrices == nil {
+		return "No prices fetched yet, try again after the next check."
+	}
+	slot := cd.lastPrices
+
+	now := time.Now().In(cfg.SlotTimezone)
+	fuelThreshold, co2Threshold := effectiveThresholds(cfg, cd, now)
+	fuel := slot.FuelPrice > 0 && slot.FuelPrice <= fuelThreshold
+	co2 := co2Valid(cfg, slot) && slot.CO2Price <= co2Threshold
+	if cfg.AlertMode == "relative" {
+		slotKey := fmt.Sprintf("%s-d%d", slot.Time, slot.Day)
+		fuel, _ = belowAverage(cd.relativeFuel, slotKey, slot.FuelPrice, cfg.RelativeWindow, cfg.RelativeDropPct)
+		co2, _ = belowAverage(cd.relativeCO2, slotKey, slot.CO2Price, cfg.RelativeWindow, cfg.RelativeDropPct)
+		fuel = fuel && slot.FuelPrice > 0
+		co2 = co2 && co2Valid(cfg, slot)
+	}
+	header := "_Preview of the next alert:_"
+	if !fuel && !co2 {
+		// Nothing would be sent, show what a combined alert looks like
+		fuel, co2 = true, true
+		header = "_Prices are above threshold, no alert would be sent. Preview with both prices:_"
+	}
+
+	return header + "\n\n" + alertMessage(cfg, cd, now, slot, fuel, co2)
+}
+
+// handleStatus replies with the last check time, the current prices and the
+// thresholds in force
+func handleStatus(ctx context.Context, client *http.Client, cfg *Config, cd *cooldown, args []string) string {
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+
+	reply := fmt.Sprintf("*Status*\n\nLast check: %s\n", formatCooldownTime(cd.lastCheck, cfg.Timezone))
+	if cd.lastPrices != nil {
+		reply += fmt.Sprintf("Prices: fuel *%s*, CO2 *%s* (slot %s, day %d)\n",
+			formatPrice(cfg, cd.lastPrices.FuelPrice), formatPrice(cfg, cd.lastPrices.CO2Price), cd.lastPrices.Time, cd.lastPrices.Day)
+	}
+	reply += "\n" + thresholdsText(cfg, cd, time.Now())
+	reply += fmt.Sprintf("\n\nLast alerts: fuel %s, CO2 %s",
+		formatCooldownTime(cd.lastFuelSent, cfg.Timezone), formatCooldownTime(cd.lastCO2Sent, cfg.Timezone))
+	return reply
+}
+
+// handlePrices replies with the prices of the last check and when they were fetched
+func handlePrices(ctx context.Context, client *http.Client, cfg *Config, cd *cooldown, args []string) string {
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+
+	if cd.lastPrices == nil {
+		return "No prices fetched yet, try again after the next check."
+	}
+	slot := cd.lastPrices
+	return fmt.Sprintf("*Prices for slot %s (day %d)*\n\nFuel: *%s*\nCO2: %s\n\n_Fetched at %s_",
+		slot.Time, slot.Day, formatPrice(cfg, slot.FuelPrice), co2PriceText(cfg, slot.CO2Price),
+		cd.lastFetched.In(cfg.Timezone).Format("15:04 MST"))
+}
+
+// handleThresholds replies with the thresholds in force, /watch overrides included
+func handleThresholds(ctx context.Context, client *http.Client, cfg *Config, cd *cooldown, args []string) string {
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+
+	return thresholdsText(cfg, cd, time.Now())
+}
+
+// thresholdsText lists the fuel and CO2 thresholds in force at now, noting a
+// /watch override and its expiry. Caller must hold cd.mu.
+func thresholdsText(cfg *Config, cd *cooldown, now time.Time) string {
+	fuel, co2 := effectiveThresholds(cfg, cd, now)
+	line := func(label string, price, configured int, watch *thresholdOverride) string {
+		if price == configured {
+			return fmt.Sprintf("%s: *%s*", label, formatPrice(cfg, price))
+		}
+		return fmt.Sprintf("%s: *%s* (/watch until %s, then %s)", label, formatPrice(cfg, price),
+			parseStateTime(watch.Until).In(cfg.Timezone).Format("15:04 MST"), formatPrice(cfg, configured))
+	}
+	return "*Thresholds*\n" + line("Fuel", fuel, cfg.FuelThreshold, cd.watchFuel) + "\n" + line("CO2", co2, cfg.CO2Threshold, cd.watchCO2)
+}
+
+// handleSnooze skips the next N alerts that would otherwise be sent.
+// Usage: /snooze N, /snooze 0 or /snooze off resumes alerts right away.
+func handleSnooze(ctx context.Context, client *http.Client, cfg *Config, cd *cooldown, args []string) string {
+	const usage = "Usage: /snooze N (e.g. /snooze 3), or /snooze off"
+	if len(args) != 1 {
+		cd.mu.Lock()
+		remaining := cd.snoozeRemaining
+		cd.mu.Unlock()
+		if remaining > 0 {
+			return fmt.Sprintf("%d more alert(s) will be skipped.\n\n%s", remaining, usage)
+		}
+		return usage
+	}
+
+	n := 0
+	if !strings.EqualFold(args[0], "off") {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 0 || n > 100 {
+			return "N must be a whole number from 0 to 100"
+		}
+	}
+
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+
+	cd.snoozeRemaining = n
+	saveCooldown(cd)
+	log.Printf("Alerts snoozed via command: skipping the next %d", n)
+
+	if n == 0 {
+		return "Snooze off, alerts resume with the next green price."
+	}
+	return fmt.Sprintf("Snoozed, the next %d alert(s) will be skipped.", n)
+}
+
+// handleSlot replies with the forecast prices of an upcoming slot.
+// Usage: /slot HH:MM [day], the day picks a slot when the time appears more than once.
+func handleSlot(ctx context.Context, client *http.Client, cfg *Config, cd *cooldown, args []string) string {
+	const usage = "Usage: /slot HH:MM [day]"
+	if len(args) == 0 || len(args) > 2 {
+		return usage
+	}
+	t, err := time.Parse("15:04", args[0])
+	if err != nil {
+		return usage
+	}
+	target := t.Format("15:04")
+	day := -1
+	if len(args) == 2 {
+		if day, err = strconv.Atoi(args[1]); err != nil {
+			return usage
+		}
+	}
+
+	// Fetch without the state lock so checks and commands aren't held up, on
+	// a copy of the config a session refresh can't change mid-request
+	prices, err := fetchPrices(ctx, client, sessionConfig(cfg, cd))
+	if err != nil {
+		log.Printf("ERROR fetching prices for /slot: %s", err)
+		return fmt.Sprintf("Could not fetch prices: %s", err)
+	}
+
+	current := slotTime(time.Now().In(cfg.SlotTimezone), cfg.SlotMinutes)
+	slot := findUpcomingSlot(prices, current, target, day)
+	if slot == nil {
+		return fmt.Sprintf("Slot %s is not in the current forecast.", target)
+	}
+
+	return fmt.Sprintf("*Slot %s (day %d)*\n\nFuel: *%s*\nCO2: *%s*",
+		slot.Time, slot.Day, formatPrice(cfg, slot.FuelPrice), formatPrice(cfg, slot.CO2Price))
+}
+
+// findUpcomingSlot returns the first forecast slot at target time, starting the
+// search at the current slot so a time that already passed today resolves to
+// the next occurrence. A day of -1 matches any day.
+func findUpcomingSlot(prices []PriceSlot, current, target string, day int) *PriceSlot {
+	start := 0
+	for i := range prices {
+		if prices[i].Time == current {
+			start = i
+			break
+		}
+	}
+
+	for i := start; i < len(prices); i++ {
+		if prices[i].Time == target && (day < 0 || prices[i].Day == day) {
+			return &prices[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPollCommandsOffset(t *testing.T) {
+	t.Cleanup(func() { os.Remove(cooldownFilePath()) })
+
+	batches := [][]telegramUpdate{
+		{{UpdateID: 41}, {UpdateID: 42}},
+		{{UpdateID: 43}},
+		{},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var offsets []string
+	client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		offsets = append(offsets, r.URL.Query().Get("offset"))
+		result := []telegramUpdate{}
+		if n := len(offsets); n <= len(batches) {
+			result = batches[n-1]
+		}
+		if len(offsets) == len(batches) {
+			cancel()
+		}
+		json.NewEncoder(w).Encode(updatesResponse{OK: true, Result: result})
+	}))
+
+	store := &memoryStore{}
+	cd := &cooldown{store: store}
+	pollCommands(ctx, client, &Config{}, cd)
+
+	// Each request confirms everything below the next offset
+	want := []string{"", "43", "44"}
+	if len(offsets) != len(want) {
+		t.Fatalf("got %d getUpdates requests with offsets %q, want %q", len(offsets), offsets, want)
+	}
+	for i := range want {
+		if offsets[i] != want[i] {
+			t.Errorf("request %d offset = %q, want %q", i+1, offsets[i], want[i])
+		}
+	}
+
+	// A restart resumes after the last handled update
+	if store.state == nil || store.state.UpdateOffset != 44 {
+		t.Fatalf("persisted offset = %+v, want 44", store.state)
+	}
+	if restored := loadCooldown(store); restored.updateOffset != 44 {
+		t.Errorf("restored offset = %d, want 44", restored.updateOffset)
+	}
+}
+
+func TestHandleExport(t *testing.T) {
+	var chatID, filename string
+	var rows [][]string
+	client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/sendDocument") {
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			return
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("parse upload: %v", err)
+			return
+		}
+		chatID = r.FormValue("chat_id")
+		file, header, err := r.FormFile("document")
+		if err != nil {
+			t.Errorf("no document in upload: %v", err)
+			return
+		}
+		defer file.Close()
+		filename = header.Filename
+		rows, _ = csv.NewReader(file).ReadAll()
+		w.Write([]byte(`{"ok":true,"result":{}}`))
+	}))
+
+	cfg := &Config{TelegramChatID: "-1001", SlotTimezone: time.UTC}
+	today := time.Now().UTC()
+	cd := &cooldown{store: &memoryStore{}, slotHistory: map[string]slotRecord{
+		slotHistoryKey(today, "14:30"):                   {FuelPrice: 420, CO2Price: 9},
+		slotHistoryKey(today, "02:00"):                   {FuelPrice: 510, CO2Price: 12},
+		slotHistoryKey(today.AddDate(0, 0, -1), "14:30"): {FuelPrice: 455, CO2Price: 11},
+	}}
+
+	if reply := handleExport(context.Background(), client, cfg, cd, []string{"1"}); reply != "" {
+		t.Fatalf("reply = %q, want none after sending the document", reply)
+	}
+	if chatID != "-1001" || filename != "price-history.csv" {
+		t.Errorf("sent %q to chat %q, want price-history.csv to -1001", filename, chatID)
+	}
+	date := today.Format("2006-01-02")
+	want := [][]string{
+		{"date", "slot", "fuel_price", "co2_price"},
+		{date, "02:00", "510", "12"},
+		{date, "14:30", "420", "9"},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("got %d CSV rows %q, want %q", len(rows), rows, want)
+	}
+	for i := range want {
+		if strings.Join(rows[i], ",") != strings.Join(want[i], ",") {
+			t.Errorf("row %d = %q, want %q", i, rows[i], want[i])
+		}
+	}
+
+	if reply := handleExport(context.Background(), client, cfg, &cooldown{store: &memoryStore{}}, nil); reply != "No price history recorded yet." {
+		t.Errorf("empty history reply = %q", reply)
+	}
+	if reply := handleExport(context.Background(), client, cfg, cd, []string{"x"}); !strings.HasPrefix(reply, "Usage:") {
+		t.Errorf("bad argument reply = %q, want usage", reply)
+	}
+}
+
+func TestIntervalCommand(t *testing.T) {
+	cfg := checkConfig(t)
+	cfg.CheckInterval = 30 * time.Minute
+	cfg.RecheckAfter = 10 * time.Minute
+	store := &memoryStore{}
+	cd := &cooldown{store: store, intervalChanged: make(chan struct{}, 1)}
+
+	steps := []struct {
+		args         []string
+		wantReply    string
+		wantInterval time.Duration
+		wantRearm    bool
+	}{
+		{nil, "Checking every 30m (CHECK_INTERVAL)", 30 * time.Minute, false},
+		{[]string{"soon"}, "The interval must be a duration", 30 * time.Minute, false},
+		{[]string{"7m"}, "The interval must be whole minutes that evenly divide an hour", 30 * time.Minute, false},
+		{[]string{"2m"}, "The interval must be at least 5m", 30 * time.Minute, false},
+		{[]string{"10m"}, "The interval must be longer than 11m with RECHECK_AFTER=10m", 30 * time.Minute, false},
+		{[]string{"15m"}, "Checking every 15m from now on, next check at ", 15 * time.Minute, true},
+		{nil, "Checking every 15m (set with /interval)", 15 * time.Minute, false},
+		{[]string{"off"}, "Check interval back to 30m (CHECK_INTERVAL)", 30 * time.Minute, true},
+	}
+	for _, step := range steps {
+		reply := handleInterval(context.Background(), nil, cfg, cd, step.args)
+		if !strings.HasPrefix(reply, step.wantReply) {
+			t.Errorf("/interval %v: reply %q, want %q", step.args, reply, step.wantReply)
+		}
+		if got := effectiveCheckInterval(cfg, cd); got != step.wantInterval {
+			t.Errorf("/interval %v: interval %s, want %s", step.args, got, step.wantInterval)
+		}
+		select {
+		case <-cd.intervalChanged:
+			if !step.wantRearm {
+				t.Errorf("/interval %v re-armed the schedule", step.args)
+			}
+		default:
+			if step.wantRearm {
+				t.Errorf("/interval %v did not re-arm the schedule", step.args)
+			}
+		}
+	}
+
+	// The override survives a restart
+	handleInterval(context.Background(), nil, cfg, cd, []string{"20m"})
+	if restored := loadCooldown(store); effectiveCheckInterval(cfg, restored) != 20*time.Minute {
+		t.Errorf("restored interval = %s, want 20m", effectiveCheckInterval(cfg, restored))
+	}
+}
+
+// commandUpdate returns an update with a command sent by user from to the test chat
+func commandUpdate(text string, from int64) telegramUpdate {
+	msg := &telegramIncoming{Text: text}
+	msg.Chat.ID = -1001
+	msg.From = &struct {
+		ID int64 `json:"id"`
+	}{ID: from}
+	return telegramUpdate{Message: msg}
+}
+
+func TestConfirmCommands(t *testing.T) {
+	client, game := newFakeGame(t, nil)
+	cfg := checkConfig(t)
+	cfg.ConfirmCommands = true
+	cd := &cooldown{store: &memoryStore{}}
+
+	steps := []struct {
+		text      string
+		from      int64
+		wantReply string
+		wantWatch int // fuel override price afterwards, 0 for none
+	}{
+		{"/watch fuel 400 2h", 5, "Reply /confirm within 2m to apply: /watch fuel 400 2h", 0},
+		{"/confirm", 6, "Only the sender of the change can confirm it.", 0},
+		{"/confirm", 5, "Fuel threshold set to $400/t for 2h", 400},
+		{"/confirm", 5, "Nothing to confirm.", 400},
+		{"/watch", 5, "Usage: /watch", 400},
+	}
+	for _, step := range steps {
+		before := len(game.sent())
+		handleUpdate(context.Background(), client, cfg, cd, commandUpdate(step.text, step.from))
+		sent := game.sent()[before:]
+		if len(sent) != 1 || !strings.HasPrefix(sent[0], step.wantReply) {
+			t.Errorf("%s from %d: replies %q, want %q", step.text, step.from, sent, step.wantReply)
+		}
+		got := 0
+		if cd.watchFuel != nil {
+			got = cd.watchFuel.Price
+		}
+		if got != step.wantWatch {
+			t.Errorf("after %s from %d: fuel override %d, want %d", step.text, step.from, got, step.wantWatch)
+		}
+	}
+
+	// A change not confirmed in time is dropped
+	handleUpdate(context.Background(), client, cfg, cd, commandUpdate("/watch co2 8 1h", 5))
+	cd.pendingCommand.Until = formatStateTime(time.Now().Add(-time.Second))
+	handleUpdate(context.Background(), client, cfg, cd, commandUpdate("/confirm", 5))
+	if sent := game.sent(); sent[len(sent)-1] != "Nothing to confirm." || cd.watchCO2 != nil {
+		t.Errorf("expired change: reply %q, CO2 override %v, want it dropped", sent[len(sent)-1], cd.watchCO2)
+	}
+
+	// /setfuel changes the threshold for good, so it waits for /confirm too
+	handleUpdate(context.Background(), client, cfg, cd, commandUpdate("/setfuel 420", 5))
+	if cfg.FuelThreshold != 450 || cd.pendingCommand == nil || cd.pendingCommand.Command != "setfuel" {
+		t.Errorf("/setfuel before /confirm: threshold %d, pending %v, want it held back", cfg.FuelThreshold, cd.pendingCommand)
+	}
+	handleUpdate(context.Background(), client, cfg, cd, commandUpdate("/confirm", 5))
+	if cfg.FuelThreshold != 420 {
+		t.Errorf("threshold after /confirm = %d, want 420", cfg.FuelThreshold)
+	}
+
+	// Changing the check interval needs confirmation too
+	cfg.CheckInterval = 30 * time.Minute
+	handleUpdate(context.Background(), client, cfg, cd, commandUpdate("/interval 15m", 5))
+	if got := effectiveCheckInterval(cfg, cd); got != 30*time.Minute {
+		t.Errorf("interval %s before /confirm, want 30m", got)
+	}
+	handleUpdate(context.Background(), client, cfg, cd, commandUpdate("/confirm", 5))
+	if got := effectiveCheckInterval(cfg, cd); got != 15*time.Minute {
+		t.Errorf("interval %s after /confirm, want 15m", got)
+	}
+
+	// Without CONFIRM_COMMANDS the change applies at once and /confirm is unknown
+	cfg.ConfirmCommands = false
+	handleUpdate(context.Background(), client, cfg, cd, commandUpdate("/watch co2 8 1h", 5))
+	if cd.watchCO2 == nil || cd.watchCO2.Price != 8 {
+		t.Errorf("CO2 override = %v, want $8 applied without confirmation", cd.watchCO2)
+	}
+	before := len(game.sent())
+	handleUpdate(context.Background(), client, cfg, cd, commandUpdate("/confirm", 5))
+	if sent := game.sent()[before:]; len(sent) != 0 {
+		t.Errorf("/confirm without CONFIRM_COMMANDS replied %q", sent)
+	}
+}
+
+func TestCommandTimeout(t *testing.T) {
+	// The price API hangs until the request is cancelled
+	cancelled := make(chan struct{}, 1)
+	client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		cancelled <- struct{}{}
+	}))
+
+	notifier := &recordingNotifier{}
+	cfg := &Config{TelegramChatID: "-1001", CommandTimeout: 50 * time.Millisecond, SlotTimezone: time.UTC, SlotMinutes: 30, Notifier: notifier}
+	cd := &cooldown{store: &memoryStore{}}
+	update := telegramUpdate{UpdateID: 1, Message: &telegramIncoming{Text: "/slot 10:00"}}
+	update.Message.Chat.ID = -1001
+
+	start := time.Now()
+	handleUpdate(context.Background(), client, cfg, cd, update)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("handleUpdate took %s, want it bounded by COMMAND_TIMEOUT", elapsed)
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Error("the in-flight API request was not cancelled")
+	}
+
+	sent := notifier.sent()
+	if len(sent) != 1 || !strings.Contains(sent[0], "taking too long") {
+		t.Errorf("replies = %q, want one timeout reply", sent)
+	}
+}
+
+func TestCommandFromOtherChatIgnored(t *testing.T) {
+	notifier := &recordingNotifier{}
+	cfg := &Config{TelegramChatID: "-1001", CommandTimeout: time.Second, Notifier: notifier}
+	update := telegramUpdate{UpdateID: 1, Message: &telegramIncoming{Text: "/thresholds"}}
+	update.Message.Chat.ID = -2002
+
+	handleUpdate(context.Background(), http.DefaultClient, cfg, &cooldown{store: &memoryStore{}}, update)
+	if sent := notifier.sent(); len(sent) != 0 {
+		t.Errorf("replies = %q, want none for another chat", sent)
+	}
+}
+
+func TestUpdatesFixture(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "getUpdates.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp updatesResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		t.Fatalf("decode getUpdates response: %v", err)
+	}
+	if !resp.OK || len(resp.Result) != 2 {
+		t.Fatalf("decoded %d updates (ok %v), want 2", len(resp.Result), resp.OK)
+	}
+
+	msg := resp.Result[0].Message
+	if msg == nil || msg.Chat.ID != -1001234567890 || msg.From == nil || msg.From.ID != 123456789 ||
+		msg.Text != "/status@shippingmanager_alert_bot" {
+		t.Errorf("group message = %+v, want /status from 123456789 in -1001234567890", msg)
+	}
+	post := resp.Result[1].ChannelPost
+	if resp.Result[1].Message != nil || post == nil || post.From != nil || post.Chat.ID != -1009876543210 {
+		t.Errorf("channel post = %+v, want one without a sender in -1009876543210", post)
+	}
+}
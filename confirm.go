@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// confirmTimeout is how long a change waits for /confirm before it is dropped
+const confirmTimeout = 2 * time.Minute
+
+// confirmCommands are the commands that change thresholds or the check
+// schedule for the whole chat, with CONFIRM_COMMANDS=true they only run after /confirm
+var confirmCommands = map[string]bool{
+	"interval": true,
+	"setco2":   true,
+	"setfuel":  true,
+	"watch":    true,
+}
+
+// pendingCommand is a command waiting for /confirm from its sender
+type pendingCommand struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+	From    int64    `json:"from,omitempty"`
+	Until   string   `json:"until"`
+}
+
+// requestConfirmation stores a command until its sender replies /confirm.
+// A newer command replaces one that is still pending.
+func requestConfirmation(cd *cooldown, name string, args []string, from int64) string {
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+
+	cd.pendingCommand = &pendingCommand{
+		Command: name,
+		Args:    args,
+		From:    from,
+		Until:   formatStateTime(time.Now().Add(confirmTimeout)),
+	}
+	saveCooldown(cd)
+
+	log.Printf("Waiting for /confirm of /%s %s", name, strings.Join(args, " "))
+	return fmt.Sprintf("Reply /confirm within %s to apply: /%s %s",
+		formatDuration(confirmTimeout), name, strings.Join(args, " "))
+}
+
+// confirmPending runs the pending command if from is the user who sent it
+// and it has not timed out
+func confirmPending(ctx context.Context, client *http.Client, cfg *Config, cd *cooldown, from int64) string {
+	cd.mu.Lock()
+	pending := cd.pendingCommand
+	if pending != nil && !time.Now().Before(parseStateTime(pending.Until)) {
+		cd.pendingCommand = nil
+		saveCooldown(cd)
+		pending = nil
+	}
+	if pending == nil {
+		cd.mu.Unlock()
+		return "Nothing to confirm."
+	}
+	if pending.From != from {
+		cd.mu.Unlock()
+		return "Only the sender of the change can confirm it."
+	}
+	cd.pendingCommand = nil
+	saveCooldown(cd)
+	cd.mu.Unlock()
+
+	// The handler takes the lock itself
+	log.Printf("Confirmed /%s %s", pending.Command, strings.Join(pending.Args, " "))
+	return commandHandlers[pending.Command](ctx, client, cfg, cd, pending.Args)
+}
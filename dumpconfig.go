@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// redactedKeys hold credentials as a whole, their values are never printed
+var redactedKeys = []string{"TELEGRAM_BOT_TOKEN", "SESSION_TOKEN", "MATRIX_TOKEN", "SMTP_PASS", "SESSION_REFRESH_BODY", "API_HEADERS", "API_BODY"}
+
+// redactedURLKeys are URLs that may carry a password or a token in the query
+var redactedURLKeys = []string{"CONFIG_URL", "SESSION_REFRESH_URL", "REDIS_URL"}
+
+// dumpConfig writes the effective settings as a .env document with secrets
+// redacted: the merged files, environment and remote config, plus the chat ID
+// after a supergroup migration and thresholds and the check interval set by
+// command. Unset settings are listed commented out.
+func dumpConfig(out io.Writer, cfg *Config, cd *cooldown) {
+	vars := make(map[string]string, len(cfg.Source))
+	for key, value := range cfg.Source {
+		vars[key] = value
+	}
+	if to := targetChatID(cfg); to != configuredChatID(cfg) {
+		vars["TELEGRAM_CHAT_ID"] = to
+	}
+	// Thresholds and check interval in force, /setfuel, /setco2 and /interval included
+	vars["FUEL_THRESHOLD"] = thresholdSetting(cfg.FuelZoneLow, cfg.FuelThreshold)
+	vars["CO2_THRESHOLD"] = thresholdSetting(cfg.CO2ZoneLow, cfg.CO2Threshold)
+	if cd.checkInterval > 0 {
+		vars["CHECK_INTERVAL"] = formatInterval(cd.checkInterval)
+	}
+
+	fmt.Fprintf(out, "# Effective config of Shipping Manager Price Alert Bot %s, secrets redacted\n", currentVersion())
+	fmt.Fprintf(out, "# Generated %s\n", time.Now().In(cfg.Timezone).Format("2006-01-02 15:04:05 MST"))
+
+	var unset []string
+	for _, key := range configKeys {
+		keys := []string{key}
+		if slices.Contains(secretFileKeys, key) {
+			keys = append(keys, key+"_FILE")
+		}
+		for _, k := range keys {
+			value, ok := vars[k]
+			if !ok || value == "" {
+				if k == key {
+					unset = append(unset, k)
+				}
+				continue
+			}
+			fmt.Fprintf(out, "%s=%s\n", k, redactConfigValue(k, value))
+		}
+	}
+
+	if len(unset) > 0 {
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "# Not set, defaults apply")
+		for _, key := range unset {
+			fmt.Fprintf(out, "# %s=\n", key)
+		}
+	}
+}
+
+// thresholdSetting renders a threshold the way FUEL_THRESHOLD and CO2_THRESHOLD take it
+func thresholdSetting(zoneLow, threshold int) string {
+	if zoneLow > 0 {
+		return fmt.Sprintf("%d-%d", zoneLow, threshold)
+	}
+	return strconv.Itoa(threshold)
+}
+
+// redactConfigValue hides credentials in a setting's value
+func redactConfigValue(key, value string) string {
+	if slices.Contains(redactedKeys, key) {
+		return "<redacted>"
+	}
+	if !slices.Contains(redactedURLKeys, key) {
+		return value
+	}
+
+	u, err := url.Parse(value)
+	if err != nil {
+		return "<redacted>"
+	}
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "redacted")
+		} else {
+			u.User = url.User("redacted")
+		}
+	}
+	if u.RawQuery != "" {
+		query := u.Query()
+		for name := range query {
+			query.Set(name, "redacted")
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// emailNotifier sends alerts by SMTP, as a plain text and HTML email
+type emailNotifier struct {
+	host string
+	port string
+	user string
+	pass string
+	from string
+	to   []string
+}
+
+func (n *emailNotifier) Send(client *http.Client, message string, opts sendOptions) error {
+	plain := markdownToPlain(message)
+	msg := buildEmail(n.from, n.to, emailSubject(plain), plain, markdownToHTML(message))
+
+	if err := n.deliver(clientContext(client), msg); err != nil {
+		return err
+	}
+	log.Println("Email sent successfully")
+	return nil
+}
+
+func (n *emailNotifier) Target() string {
+	return fmt.Sprintf("email %s via %s:%s", strings.Join(n.to, ", "), n.host, n.port)
+}
+
+// deliver sends a raw message. Port 465 uses implicit TLS, other ports
+// upgrade with STARTTLS when the server offers it. The send ends at ctx's
+// deadline, so a stalling server can't outlast CHECK_BUDGET.
+func (n *emailNotifier) deliver(ctx context.Context, msg []byte) error {
+	addr := net.JoinHostPort(n.host, n.port)
+	tlsConfig := &tls.Config{ServerName: n.host}
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	if n.port == "465" {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("SMTP connection to %s failed: %w", addr, err)
+	}
+	// Bound the whole conversation, net/smtp has no timeouts of its own
+	deadline := time.Now().Add(time.Minute)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	c, err := smtp.NewClient(conn, n.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP handshake with %s failed: %w", addr, err)
+	}
+	defer c.Close()
+
+	if n.port != "465" {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(tlsConfig); err != nil {
+				return fmt.Errorf("SMTP STARTTLS failed: %w", err)
+			}
+		}
+	}
+
+	if n.user != "" {
+		// PlainAuth refuses to send credentials over an unencrypted connection
+		if err := c.Auth(smtp.PlainAuth("", n.user, n.pass, n.host)); err != nil {
+			return fmt.Errorf("SMTP authentication as %s failed: %w", n.user, err)
+		}
+	}
+
+	if err := c.Mail(n.from); err != nil {
+		return fmt.Errorf("SMTP sender %s rejected: %w", n.from, err)
+	}
+	for _, rcpt := range n.to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("SMTP recipient %s rejected: %w", rcpt, err)
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP server rejected the email: %w", err)
+	}
+	return c.Quit()
+}
+
+// emailSubject summarizes an alert from its price lines, e.g.
+// "Shipping Manager: Fuel: $450/t, CO2: $9/t", or its first line otherwise
+func emailSubject(plain string) string {
+	var prices []string
+	for _, line := range strings.Split(plain, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "Fuel: ") || strings.HasPrefix(line, "CO2: ") {
+			prices = append(prices, line)
+		}
+		if len(prices) == 2 {
+			break
+		}
+	}
+	if len(prices) > 0 {
+		return "Shipping Manager: " + strings.Join(prices, ", ")
+	}
+
+	first, _, _ := strings.Cut(strings.TrimSpace(plain), "\n")
+	return "Shipping Manager: " + first
+}
+
+// buildEmail renders a multipart/alternative email with text and HTML parts
+func buildEmail(from string, to []string, subject, plain, html string) []byte {
+	const boundary = "alertbot-alternative"
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+
+	// Quoted-printable keeps every line within the 998 character SMTP limit
+	for _, part := range []struct{ contentType, body string }{{"text/plain", plain}, {"text/html", html}} {
+		fmt.Fprintf(&b, "--%s\r\nContent-Type: %s; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n", boundary, part.contentType)
+		b.WriteString(quotedPrintable(part.body))
+		b.WriteString("\r\n")
+	}
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+
+	return []byte(b.String())
+}
+
+// quotedPrintable encodes an email body part, line breaks become CRLF
+func quotedPrintable(text string) string {
+	var b strings.Builder
+	w := quotedprintable.NewWriter(&b)
+	w.Write([]byte(text))
+	w.Close()
+	return b.String()
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestBuildEmailLineLength(t *testing.T) {
+	plain := "Fuel: $380/t\n" + strings.Repeat("x", 2000)
+	html := "<p>" + strings.Repeat("Fuel is cheap ✅ ", 200) + "</p>"
+	raw := buildEmail("bot@example.com", []string{"me@example.com"}, "Fuel $380/t", plain, html)
+
+	for i, line := range strings.Split(string(raw), "\r\n") {
+		if len(line) > 998 {
+			t.Fatalf("line %d is %d characters long", i+1, len(line))
+		}
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("ParseMediaType: %v", err)
+	}
+
+	// multipart.Reader decodes quoted-printable parts transparently
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	want := []string{strings.ReplaceAll(plain, "\n", "\r\n"), html}
+	for i := range want {
+		part, err := reader.NextPart()
+		if err != nil {
+			t.Fatalf("part %d: %v", i, err)
+		}
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatalf("part %d: %v", i, err)
+		}
+		if string(body) != want[i] {
+			t.Errorf("part %d decoded to %q, want %q", i, body[:min(len(body), 60)], want[i][:60])
+		}
+	}
+}
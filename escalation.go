@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+// escalationPollInterval is how often pending escalations are checked for being due
+const escalationPollInterval = 15 * time.Second
+
+// startEscalation records a sent price alert as waiting for /ack
+func startEscalation(cfg *Config, cd *cooldown, message string) {
+	cd.escalationMessage = message
+	cd.escalateAt = time.Now().Add(cfg.EscalateAfter)
+}
+
+// watchEscalations re-sends an unacknowledged price alert with notification
+// once ESCALATE_AFTER has passed, until ctx is cancelled
+func watchEscalations(ctx context.Context, client *http.Client, cfg *Config, cd *cooldown) {
+	ticker := time.NewTicker(escalationPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			escalateIfDue(client, cfg, cd)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// escalateIfDue sends the pending escalation when its deadline has passed
+func escalateIfDue(client *http.Client, cfg *Config, cd *cooldown) {
+	cd.mu.Lock()
+	pending := cd.escalationMessage
+	due := pending != "" && !time.Now().Before(cd.escalateAt)
+	cd.mu.Unlock()
+	if !due {
+		return
+	}
+
+	// Sent without the state lock, /ack and checks go on meanwhile
+	err := notify(client, cfg, "*Still not acknowledged, Captain!*\n\n"+pending)
+
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+	if err != nil {
+		log.Printf("ERROR sending escalation: %s", err)
+		cd.stats.SendErrors++
+		cd.recordError(err)
+		return
+	}
+
+	log.Println("Unacknowledged alert escalated")
+	// A newer alert may be waiting for /ack by now, keep that one
+	if cd.escalationMessage == pending {
+		cd.escalationMessage = ""
+		cd.escalateAt = time.Time{}
+		saveCooldown(cd)
+	}
+}
+
+// handleAck acknowledges the pending alert so it is not escalated
+func handleAck(ctx context.Context, client *http.Client, cfg *Config, cd *cooldown, args []string) string {
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+
+	if cd.escalationMessage == "" {
+		return "Nothing to acknowledge."
+	}
+
+	cd.escalationMessage = ""
+	cd.escalateAt = time.Time{}
+	saveCooldown(cd)
+	log.Println("Alert acknowledged via command")
+	return "Alert acknowledged, no escalation will be sent."
+}
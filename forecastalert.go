@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// checkForecastAlert announces upcoming forecast slots at or below threshold
+// with ALERT_ON_FORECAST, each predicted dip once per price type. Slots that
+// left the forecast are dropped from the announced list.
+func checkForecastAlert(client *http.Client, cfg *Config, cd *cooldown, prices []PriceSlot, slot *PriceSlot, fuelThreshold, co2Threshold int) {
+	if !cfg.AlertOnForecast {
+		return
+	}
+
+	start := -1
+	for i := range prices {
+		if prices[i].Time == slot.Time && prices[i].Day == slot.Day {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return
+	}
+
+	var keep, fresh, lines []string
+	for i := start + 1; i < len(prices); i++ {
+		p := &prices[i]
+		slotKey := fmt.Sprintf("%s-d%d", p.Time, p.Day)
+		var parts []string
+		for _, kind := range []string{"fuel", "co2"} {
+			var green bool
+			if kind == "fuel" {
+				green = p.FuelPrice > 0 && p.FuelPrice <= fuelThreshold
+			} else {
+				green = co2Valid(cfg, p) && p.CO2Price <= co2Threshold
+			}
+			if !green {
+				continue
+			}
+			key := kind + " " + slotKey
+			keep = append(keep, key)
+			if slices.Contains(cd.forecastAlerted, key) {
+				continue
+			}
+			fresh = append(fresh, key)
+			if kind == "fuel" {
+				parts = append(parts, "fuel *"+formatPrice(cfg, p.FuelPrice)+"*")
+			} else {
+				parts = append(parts, "CO2 *"+formatPrice(cfg, p.CO2Price)+"*")
+			}
+		}
+		if len(parts) > 0 {
+			lines = append(lines, fmt.Sprintf("%s (day %d): %s", p.Time, p.Day, strings.Join(parts, ", ")))
+		}
+	}
+
+	if len(fresh) == 0 {
+		cd.forecastAlerted = keep
+		return
+	}
+
+	message := "*🔭 Cheap prices ahead, Captain!*\n\nThe forecast has prices at or below your thresholds:\n\n" + strings.Join(lines, "\n")
+	message += gameLink(cfg)
+	if err := notify(client, cfg, message); err != nil {
+		log.Printf("ERROR sending forecast alert: %s", err)
+		cd.stats.SendErrors++
+		cd.recordError(err)
+		return
+	}
+	cd.forecastAlerted = keep
+	log.Printf("Forecast alert sent for %d upcoming slot price(s): %s", len(fresh), strings.Join(fresh, ", "))
+}
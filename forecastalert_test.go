@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestForecastAlert(t *testing.T) {
+	cfg := checkConfig(t)
+	cfg.AlertOnForecast = true
+	notifier := &recordingNotifier{}
+	cfg.Notifier = notifier
+	cd := &cooldown{store: &memoryStore{}}
+	forecast := []PriceSlot{
+		{Time: "23:00", Day: 1, FuelPrice: 380, CO2Price: 5}, // already past
+		{Time: "23:30", Day: 1, FuelPrice: 600, CO2Price: 20},
+		{Time: "00:00", Day: 2, FuelPrice: 400, CO2Price: 20},
+		{Time: "00:30", Day: 2, FuelPrice: 600, CO2Price: 20},
+		{Time: "01:00", Day: 2, FuelPrice: 600, CO2Price: 5},
+		{Time: "10:00", Day: 3, FuelPrice: 430, CO2Price: 8},
+	}
+	current := &forecast[1]
+	check := func() {
+		checkForecastAlert(nil, cfg, cd, forecast, current, 450, 10)
+	}
+
+	check()
+	sent := notifier.sent()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d alerts, want one for the whole forecast", len(sent))
+	}
+	for _, want := range []string{"00:00 (day 2): fuel *$400/t*", "01:00 (day 2): CO2 *$5/t*", "10:00 (day 3): fuel *$430/t*, CO2 *$8/t*"} {
+		if !strings.Contains(sent[0], want) {
+			t.Errorf("alert lacks %q:\n%s", want, sent[0])
+		}
+	}
+	for _, unwanted := range []string{"23:00", "23:30", "00:30"} {
+		if strings.Contains(sent[0], unwanted) {
+			t.Errorf("alert names slot %s:\n%s", unwanted, sent[0])
+		}
+	}
+
+	// The same dips are announced once
+	check()
+	if n := len(notifier.sent()); n != 1 {
+		t.Fatalf("sent %d alerts, want no repeat for known dips", n)
+	}
+
+	// A new dip alerts alone
+	forecast[3].FuelPrice = 420
+	check()
+	sent = notifier.sent()
+	if len(sent) != 2 || !strings.Contains(sent[1], "00:30 (day 2)") || strings.Contains(sent[1], "00:00") || strings.Contains(sent[1], "10:00") {
+		t.Fatalf("alerts = %q, want a second one for 00:30 only", sent)
+	}
+
+	// A dip that left the forecast and came back is announced again
+	forecast[2].FuelPrice = 600
+	check()
+	forecast[2].FuelPrice = 400
+	check()
+	sent = notifier.sent()
+	if len(sent) != 3 || !strings.Contains(sent[2], "00:00 (day 2)") {
+		t.Errorf("alerts = %q, want a third one for 00:00 again", sent)
+	}
+}
+
+func TestForecastAlertDisabled(t *testing.T) {
+	cfg := checkConfig(t)
+	notifier := &recordingNotifier{}
+	cfg.Notifier = notifier
+	cd := &cooldown{store: &memoryStore{}}
+	forecast := []PriceSlot{{Time: "10:00", Day: 1, FuelPrice: 600}, {Time: "10:30", Day: 1, FuelPrice: 300}}
+	checkForecastAlert(nil, cfg, cd, forecast, &forecast[0], 450, 10)
+	if sent := notifier.sent(); len(sent) != 0 {
+		t.Errorf("sent %q without ALERT_ON_FORECAST", sent)
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// alertFormula is a parsed ALERT_FORMULA such as "fuel + 3*co2 <= 600":
+// an arithmetic expression over fuel and co2 compared against another one
+type alertFormula struct {
+	source string
+	left   formulaExpr
+	op     string
+	right  formulaExpr
+}
+
+// formulaExpr is a node of the arithmetic expression tree
+type formulaExpr interface {
+	eval(fuel, co2 float64) float64
+}
+
+type formulaNumber float64
+
+func (n formulaNumber) eval(fuel, co2 float64) float64 { return float64(n) }
+
+type formulaVar string
+
+func (v formulaVar) eval(fuel, co2 float64) float64 {
+	if v == "fuel" {
+		return fuel
+	}
+	return co2
+}
+
+type formulaBinary struct {
+	op          byte
+	left, right formulaExpr
+}
+
+func (b *formulaBinary) eval(fuel, co2 float64) float64 {
+	l, r := b.left.eval(fuel, co2), b.right.eval(fuel, co2)
+	switch b.op {
+	case '+':
+		return l + r
+	case '-':
+		return l - r
+	case '*':
+		return l * r
+	default:
+		return l / r
+	}
+}
+
+// matches evaluates the formula for the given prices and also returns the
+// value of the left-hand side for the alert message. A division by zero, e.g.
+// fuel / co2 with free CO2, never matches.
+func (f *alertFormula) matches(fuel, co2 int) (bool, float64) {
+	l := f.left.eval(float64(fuel), float64(co2))
+	r := f.right.eval(float64(fuel), float64(co2))
+	if math.IsInf(l, 0) || math.IsNaN(l) || math.IsInf(r, 0) || math.IsNaN(r) {
+		return false, l
+	}
+	switch f.op {
+	case "<=":
+		return l <= r, l
+	case "<":
+		return l < r, l
+	case ">=":
+		return l >= r, l
+	default:
+		return l > r, l
+	}
+}
+
+// formulaParser is a recursive-descent parser over the formula tokens
+type formulaParser struct {
+	tokens []string
+	pos    int
+}
+
+// parseFormula parses an ALERT_FORMULA. Supported are the variables fuel and
+// co2, numbers, + - * /, parentheses and one comparison (<=, <, >=, >).
+func parseFormula(input string) (*alertFormula, error) {
+	tokens, err := tokenizeFormula(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &formulaParser{tokens: tokens}
+	left, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+
+	op := p.next()
+	if op == "" {
+		return nil, fmt.Errorf("missing a comparison (<=, <, >=, >)")
+	}
+	if op != "<=" && op != "<" && op != ">=" && op != ">" {
+		return nil, fmt.Errorf("unexpected %q, expected a comparison (<=, <, >=, >)", op)
+	}
+
+	right, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+
+	return &alertFormula{source: strings.TrimSpace(input), left: left, op: op, right: right}, nil
+}
+
+// tokenizeFormula splits a formula into numbers, names, operators and parentheses
+func tokenizeFormula(input string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(input); {
+		c := rune(input[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c) || c == '.':
+			j := i
+			for j < len(input) && (unicode.IsDigit(rune(input[j])) || input[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, input[i:j])
+			i = j
+		case unicode.IsLetter(c):
+			j := i
+			for j < len(input) && (unicode.IsLetter(rune(input[j])) || unicode.IsDigit(rune(input[j]))) {
+				j++
+			}
+			tokens = append(tokens, strings.ToLower(input[i:j]))
+			i = j
+		case (c == '<' || c == '>') && i+1 < len(input) && input[i+1] == '=':
+			tokens = append(tokens, input[i:i+2])
+			i += 2
+		case strings.ContainsRune("+-*/()<>", c):
+			tokens = append(tokens, string(c))
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	return tokens, nil
+}
+
+// next returns the next token, or "" at the end
+func (p *formulaParser) next() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	p.pos++
+	return p.tokens[p.pos-1]
+}
+
+// peek returns the next token without consuming it
+func (p *formulaParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+// parseSum parses terms joined by + and -
+func (p *formulaParser) parseSum() (formulaExpr, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "+" || p.peek() == "-" {
+		op := p.next()[0]
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = &formulaBinary{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseProduct parses factors joined by * and /
+func (p *formulaParser) parseProduct() (formulaExpr, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "*" || p.peek() == "/" {
+		op := p.next()[0]
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		left = &formulaBinary{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseFactor parses a number, a variable or a parenthesized expression
+func (p *formulaParser) parseFactor() (formulaExpr, error) {
+	tok := p.next()
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("unexpected end of formula")
+	case tok == "fuel" || tok == "co2":
+		return formulaVar(tok), nil
+	case tok == "(":
+		inner, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		return inner, nil
+	}
+
+	n, err := strconv.ParseFloat(tok, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected %q, expected a number, fuel or co2", tok)
+	}
+	return formulaNumber(n), nil
+}
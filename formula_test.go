@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseFormulaEval(t *testing.T) {
+	tests := []struct {
+		formula   string
+		fuel, co2 int
+		want      bool
+		value     float64
+	}{
+		{"fuel + 3*co2 <= 600", 500, 30, true, 590},
+		{"fuel + 3*co2 <= 600", 500, 40, false, 620},
+		{"3*co2 + fuel <= 600", 500, 30, true, 590},
+		{"(fuel + 3) * co2 > 0", 2, 10, true, 50},
+		{"fuel - co2 - 100 > 0", 300, 150, true, 50},
+		{"fuel / co2 / 2 >= 10", 400, 20, true, 10},
+		{"fuel * 2 / 4 <= 100", 200, 0, true, 100},
+		{"((fuel)) <= co2 * (1 + 1)", 20, 10, true, 20},
+		{"FUEL + CO2 <= 10", 4, 5, true, 9},
+		{"fuel + 0.5*co2 < 10", 8, 4, false, 10},
+	}
+	for _, tt := range tests {
+		f, err := parseFormula(tt.formula)
+		if err != nil {
+			t.Errorf("parseFormula(%q): %v", tt.formula, err)
+			continue
+		}
+		got, value := f.matches(tt.fuel, tt.co2)
+		if got != tt.want || value != tt.value {
+			t.Errorf("%q with fuel %d, co2 %d = %v (%g), want %v (%g)", tt.formula, tt.fuel, tt.co2, got, value, tt.want, tt.value)
+		}
+	}
+}
+
+func TestParseFormulaErrors(t *testing.T) {
+	tests := []struct {
+		formula string
+		want    string
+	}{
+		{"fuel + gas <= 600", `unexpected "gas"`},
+		{"fuel + 3*co2", "missing a comparison"},
+		{"fuel = 600", `unexpected character '='`},
+		{"fuel + <= 600", `unexpected "<="`},
+		{"(fuel + co2 <= 600", "missing closing parenthesis"},
+		{"fuel <= 600)", `unexpected ")"`},
+		{"fuel <= 600 <= 700", `unexpected "<="`},
+		{"fuel <=", "unexpected end of formula"},
+		{"", "unexpected end of formula"},
+	}
+	for _, tt := range tests {
+		_, err := parseFormula(tt.formula)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseFormula(%q) error = %v, want it to contain %q", tt.formula, err, tt.want)
+		}
+	}
+}
+
+func TestFormulaDivisionByZero(t *testing.T) {
+	tests := []struct {
+		formula   string
+		fuel, co2 int
+	}{
+		{"fuel / co2 > 40", 500, 0},
+		{"fuel / co2 <= 40", 500, 0},
+		{"co2 / co2 < 1", 0, 0},
+		{"fuel <= 600 / (co2 - 10)", 500, 10},
+	}
+	for _, tt := range tests {
+		f, err := parseFormula(tt.formula)
+		if err != nil {
+			t.Fatalf("parseFormula(%q): %v", tt.formula, err)
+		}
+		if got, value := f.matches(tt.fuel, tt.co2); got {
+			t.Errorf("%q with fuel %d, co2 %d matched (%g), a division by zero must not", tt.formula, tt.fuel, tt.co2, value)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits for /export, the window is capped in days and the file in rows
+const (
+	maxExportDays = 7
+	maxExportRows = 1000
+)
+
+// slotRecord is the price seen for one slot on one day
+type slotRecord struct {
+	FuelPrice int `json:"fuel_price"`
+	CO2Price  int `json:"co2_price"`
+}
+
+// slotHistoryKey identifies a slot on a given day, e.g. "2026-10-14 14:30"
+func slotHistoryKey(day time.Time, slot string) string {
+	return day.Format("2006-01-02") + " " + slot
+}
+
+// recordSlotPrice stores the current slot's prices for day-over-day comparison
+// and /export, and prunes the history once a day
+func recordSlotPrice(cd *cooldown, now time.Time, slot *PriceSlot, retention time.Duration) {
+	if cd.slotHistory == nil {
+		cd.slotHistory = make(map[string]slotRecord)
+	}
+	cd.slotHistory[slotHistoryKey(now, slot.Time)] = slotRecord{
+		FuelPrice: slot.FuelPrice,
+		CO2Price:  slot.CO2Price,
+	}
+
+	if today := now.Format("2006-01-02"); cd.historyPruned != today {
+		pruneSlotHistory(cd.slotHistory, now, retention)
+		cd.historyPruned = today
+	}
+}
+
+// pruneSlotHistory drops the records of days that ended more than retention
+// ago, a retention of 1d keeps today and yesterday
+func pruneSlotHistory(history map[string]slotRecord, now time.Time, retention time.Duration) {
+	oldest := now.Add(-retention).Format("2006-01-02")
+	for key := range history {
+		if key[:len("2006-01-02")] < oldest {
+			delete(history, key)
+		}
+	}
+}
+
+// dayOverDayNote compares the alerted prices with yesterday's same slot,
+// or returns an empty string when there is no data for yesterday
+func dayOverDayNote(cfg *Config, cd *cooldown, now time.Time, slot *PriceSlot, fuel, co2 bool) string {
+	prev, ok := cd.slotHistory[slotHistoryKey(now.AddDate(0, 0, -1), slot.Time)]
+	if !ok {
+		return ""
+	}
+
+	var lines []string
+	if fuel && prev.FuelPrice > 0 {
+		lines = append(lines, "Fuel: "+priceChange(cfg, slot.FuelPrice-prev.FuelPrice))
+	}
+	if co2 && prev.CO2Price > 0 {
+		lines = append(lines, "CO2: "+priceChange(cfg, slot.CO2Price-prev.CO2Price))
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("\n\nVs yesterday %s:\n%s", slot.Time, strings.Join(lines, "\n"))
+}
+
+// priceChange describes a price difference, e.g. "down $35/t"
+func priceChange(cfg *Config, diff int) string {
+	switch {
+	case diff < 0:
+		return "down " + formatPrice(cfg, -diff)
+	case diff > 0:
+		return "up " + formatPrice(cfg, diff)
+	default:
+		return "unchanged"
+	}
+}
+
+// handleExport sends the recorded slot prices as a CSV document.
+// Usage: /export [days], defaults to and is capped at maxExportDays.
+func handleExport(ctx context.Context, client *http.Client, cfg *Config, cd *cooldown, args []string) string {
+	days := maxExportDays
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			return fmt.Sprintf("Usage: /export [days], at most %d", maxExportDays)
+		}
+		days = min(n, maxExportDays)
+	}
+
+	cd.mu.Lock()
+	since := time.Now().In(cfg.SlotTimezone).AddDate(0, 0, -(days - 1))
+	data, rows := historyCSV(cd.slotHistory, since)
+	cd.mu.Unlock()
+
+	if rows == 0 {
+		return "No price history recorded yet."
+	}
+
+	caption := fmt.Sprintf("Price history, %d slots", rows)
+	if err := sendTelegramDocument(client, cfg, "price-history.csv", data, caption); err != nil {
+		log.Printf("ERROR sending price history export: %s", err)
+		return "Export failed: " + err.Error()
+	}
+	log.Printf("Exported %d price history slots via command", rows)
+	return ""
+}
+
+// historyCSV renders history records from since's day on as CSV, oldest first.
+// Only the newest maxExportRows records are kept.
+func historyCSV(history map[string]slotRecord, since time.Time) ([]byte, int) {
+	oldest := since.Format("2006-01-02")
+	var keys []string
+	for key := range history {
+		if key[:len("2006-01-02")] >= oldest {
+			keys = append(keys, key)
+		}
+	}
+	// Keys are "YYYY-MM-DD HH:MM", so they sort chronologically
+	sort.Strings(keys)
+	if len(keys) > maxExportRows {
+		keys = keys[len(keys)-maxExportRows:]
+	}
+	if len(keys) == 0 {
+		return nil, 0
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"date", "slot", "fuel_price", "co2_price"})
+	for _, key := range keys {
+		date, slot, _ := strings.Cut(key, " ")
+		rec := history[key]
+		w.Write([]string{date, slot, strconv.Itoa(rec.FuelPrice), strconv.Itoa(rec.CO2Price)})
+	}
+	w.Flush()
+	return buf.Bytes(), len(keys)
+}
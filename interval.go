@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// minCommandInterval is the shortest check interval /interval accepts, so a
+// typo in the chat can't hammer the price API
+const minCommandInterval = 5 * time.Minute
+
+// effectiveCheckInterval returns the check interval in force, the /interval
+// override or CHECK_INTERVAL
+func effectiveCheckInterval(cfg *Config, cd *cooldown) time.Duration {
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+	if cd.checkInterval > 0 {
+		return cd.checkInterval
+	}
+	return cfg.CheckInterval
+}
+
+// notifyIntervalChanged tells the scheduler to re-arm at the new check
+// interval. A change that is already pending covers this one too.
+func notifyIntervalChanged(cd *cooldown) {
+	select {
+	case cd.intervalChanged <- struct{}{}:
+	default:
+	}
+}
+
+// scheduleNextCheck logs and returns the next check one minute past a
+// multiple of interval, in the slot timezone
+func scheduleNextCheck(cfg *Config, interval time.Duration) <-chan time.Time {
+	nextCheck := nextCheckTime(time.Now().In(cfg.SlotTimezone), int(interval/time.Minute))
+	waitDuration := time.Until(nextCheck)
+	log.Printf("Next check at %s (%s) (in %s)",
+		nextCheck.In(cfg.Timezone).Format("15:04"), cfg.Timezone,
+		waitDuration.Truncate(time.Second))
+	return time.After(waitDuration)
+}
+
+// handleInterval changes how often prices are checked, persisted across restarts.
+// Usage: /interval 15m, /interval off to go back to CHECK_INTERVAL, or
+// /interval alone to show the current one.
+func handleInterval(ctx context.Context, client *http.Client, cfg *Config, cd *cooldown, args []string) string {
+	const usage = "Usage: /interval DURATION (e.g. /interval 15m), or /interval off"
+	if len(args) > 1 {
+		return usage
+	}
+
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+
+	if len(args) == 0 {
+		interval, source := cfg.CheckInterval, "CHECK_INTERVAL"
+		if cd.checkInterval > 0 {
+			interval, source = cd.checkInterval, "set with /interval"
+		}
+		return fmt.Sprintf("Checking every %s (%s), next check at %s.",
+			formatDuration(interval), source, nextCheckText(cfg, interval))
+	}
+
+	if strings.EqualFold(args[0], "off") {
+		cd.checkInterval = 0
+		saveCooldown(cd)
+		notifyIntervalChanged(cd)
+		log.Printf("Check interval override removed via command, back to %s", formatDuration(cfg.CheckInterval))
+		return fmt.Sprintf("Check interval back to %s (CHECK_INTERVAL), next check at %s.",
+			formatDuration(cfg.CheckInterval), nextCheckText(cfg, cfg.CheckInterval))
+	}
+
+	d, err := time.ParseDuration(args[0])
+	if err != nil {
+		return "The interval must be a duration like 15m, 30m or 1h"
+	}
+	if d%time.Minute != 0 || d <= 0 || time.Hour%d != 0 {
+		return "The interval must be whole minutes that evenly divide an hour, e.g. 10m, 15m, 20m, 30m or 1h"
+	}
+	if d < minCommandInterval {
+		return fmt.Sprintf("The interval must be at least %s", formatDuration(minCommandInterval))
+	}
+	if cfg.RecheckAfter > 0 && cfg.RecheckAfter >= d-time.Minute {
+		return fmt.Sprintf("The interval must be longer than %s with RECHECK_AFTER=%s",
+			formatDuration(cfg.RecheckAfter+time.Minute), formatDuration(cfg.RecheckAfter))
+	}
+
+	cd.checkInterval = d
+	saveCooldown(cd)
+	notifyIntervalChanged(cd)
+
+	log.Printf("Check interval set to %s via command", formatDuration(d))
+	return fmt.Sprintf("Checking every %s from now on, next check at %s.", formatDuration(d), nextCheckText(cfg, d))
+}
+
+// nextCheckText formats the next check at interval in the display timezone
+func nextCheckText(cfg *Config, interval time.Duration) string {
+	next := nextCheckTime(time.Now().In(cfg.SlotTimezone), int(interval/time.Minute))
+	return next.In(cfg.Timezone).Format("15:04 MST")
+}
+
+// formatInterval returns an /interval override as stored in the state, empty when unset
+func formatInterval(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return d.String()
+}
@@ -2,28 +2,139 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"math"
+	"math/rand/v2"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
+	"unicode"
 )
 
 // Config holds all settings loaded from .env
 type Config struct {
-	TelegramBotToken string
-	TelegramChatID   string
-	SessionToken     string
-	FuelThreshold    int
-	CO2Threshold     int
-	Timezone         *time.Location
+	TelegramBotToken   string
+	TelegramChatID     string
+	SessionToken       string
+	FuelThreshold      int
+	FuelZoneLow        int
+	BuyTiers           []buyTier
+	CO2ZoneLow         int
+	CO2Threshold       int
+	Timezone           *time.Location
+	SlotTimezone       *time.Location
+	SlotMinutes        int
+	CheckInterval      time.Duration
+	FetchRetries       int
+	FetchBackoff       time.Duration
+	RecheckAfter       time.Duration
+	APIMethod          string
+	APIBody            string
+	APIHeaders         map[string]string
+	UserAgents         []string
+	Budget             int
+	ProtectContent     bool
+	SpreadMode         string
+	SpreadMin          *float64
+	SpreadMax          *float64
+	CombineEitherNew   bool
+	CommandsEnabled    bool
+	CommandTimeout     time.Duration
+	CheckBudget        time.Duration
+	ForceHTTP1         bool
+	StatusFile         string
+	ReminderSlots      []string
+	ExtraChatIDs       []string
+	SendConcurrency    int
+	TierChats          []chatTier
+	MinTierImprovement int
+	SummaryTime        string
+	MaintenanceNotice  bool
+	EmptyNoticeAfter   int
+	GameLinkURL        string
+	SessionRefreshURL  string
+	SessionRefreshBody string
+	UpdateCheck        bool
+	VerifyTelegram     bool
+	VerifyChat         bool
+	VerifyInterval     time.Duration
+	EscalateAfter      time.Duration
+	ShowDayOverDay     bool
+	ShowPctBelow       bool
+	ShowDataMeta       bool
+	ShutdownAlert      bool
+	AlertOnForecast    bool
+	FallbackMode       string
+	UseFirstSlot       bool
+	TelegramSendFormat string
+	HoldWindow         time.Duration
+	HoldMinDrop        int
+	RecordLowAlert     bool
+	FuelVelocity       int
+	WaitSpread         int
+	MaxLogBody         int
+	MaxSendsPerMinute  int
+	FuelHours          *hoursWindow
+	MarketHours        *hoursWindow
+	CO2Hours           *hoursWindow
+	NotifierType       string
+	MatrixHomeserver   string
+	MatrixRoom         string
+	MatrixToken        string
+	Notifier           Notifier
+	FirstRunSilent     bool
+	HistoryRetention   time.Duration
+	ImprovementOnly    bool
+	AlertMode          string
+	RelativeWindow     int
+	RelativeDropPct    float64
+	ImprovementMargin  int
+	RecentAlerts       int
+	CO2AllowZero       bool
+	AlertFormula       *alertFormula
+	PinnedForecast     bool
+	ThreadAlerts       bool
+	AutoDeleteAfter    time.Duration
+	SpoolDir           string
+	FuelMinGap         time.Duration
+	FuelConfirmSlots   int
+	CO2ConfirmSlots    int
+	CO2MinGap          time.Duration
+	PriceUnit          string
+	ExcludeSlots       []string
+	ConfirmCommands    bool
+	SMTPHost           string
+	SMTPPort           string
+	SMTPUser           string
+	SMTPPass           string
+	EmailFrom          string
+	EmailTo            []string
+	StateBackend       string
+	RedisURL           string
+	RedisKey           string
+	StateStore         StateStore
+	Source             map[string]string
 }
 
 // PriceSlot represents a single price entry from the API
@@ -32,6 +143,37 @@ type PriceSlot struct {
 	CO2Price  int    `json:"co2_price"`
 	Time      string `json:"time"`
 	Day       int    `json:"day"`
+
+	// CO2Reported is set when the API sent a numeric co2_price, so an
+	// explicit 0 can be told apart from a missing or null field
+	CO2Reported bool `json:"-"`
+}
+
+// UnmarshalJSON decodes a price slot and records whether co2_price was present
+func (s *PriceSlot) UnmarshalJSON(data []byte) error {
+	type plain PriceSlot
+	var raw struct {
+		plain
+		CO2Price *int `json:"co2_price"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*s = PriceSlot(raw.plain)
+	if raw.CO2Price != nil {
+		s.CO2Price = *raw.CO2Price
+		s.CO2Reported = true
+	}
+	return nil
+}
+
+// co2Valid reports whether the slot's CO2 price is usable for alerts. Zero is
+// only valid with CO2_ALLOW_ZERO and when the API actually reported it.
+func co2Valid(cfg *Config, slot *PriceSlot) bool {
+	if slot.CO2Price > 0 {
+		return true
+	}
+	return cfg.CO2AllowZero && slot.CO2Price == 0 && slot.CO2Reported
 }
 
 // PriceResponse is the API response structure
@@ -41,255 +183,1486 @@ type PriceResponse struct {
 	} `json:"data"`
 }
 
+// telegramMessage is the sendMessage request payload, also used for
+// editMessageText and pinChatMessage which add the message ID
+type telegramMessage struct {
+	ChatID              string `json:"chat_id"`
+	MessageID           int64  `json:"message_id,omitempty"`
+	Text                string `json:"text,omitempty"`
+	ParseMode           string `json:"parse_mode,omitempty"`
+	ProtectContent      bool   `json:"protect_content,omitempty"`
+	DisableNotification bool   `json:"disable_notification,omitempty"`
+
+	ReplyParameters *replyParameters `json:"reply_parameters,omitempty"`
+}
+
+// replyParameters makes a message a reply. With AllowWithoutReply Telegram
+// sends it as a normal message when the replied-to message was deleted.
+type replyParameters struct {
+	MessageID         int64 `json:"message_id"`
+	AllowWithoutReply bool  `json:"allow_sending_without_reply,omitempty"`
+}
+
 // TelegramResponse is the Telegram Bot API response
 type TelegramResponse struct {
 	OK          bool   `json:"ok"`
 	Description string `json:"description"`
+	ErrorCode   int    `json:"error_code"`
+	Parameters  struct {
+		RetryAfter      int   `json:"retry_after"`
+		MigrateToChatID int64 `json:"migrate_to_chat_id"`
+	} `json:"parameters"`
+	// Sent message for sendMessage/editMessageText, true for pinChatMessage
+	Result json.RawMessage `json:"result"`
+}
+
+// sentMessage is the part of a sent Message result the bot keeps, to edit,
+// reply to or delete the message later
+type sentMessage struct {
+	MessageID int64 `json:"message_id"`
+	Chat      struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+}
+
+// sentMessage decodes the Message result of sendMessage or editMessageText
+func (r *TelegramResponse) sentMessage() (*sentMessage, error) {
+	var sent sentMessage
+	if err := json.Unmarshal(r.Result, &sent); err != nil {
+		return nil, fmt.Errorf("failed to parse sent message: %w", err)
+	}
+	if sent.MessageID == 0 {
+		return nil, fmt.Errorf("no message ID in response")
+	}
+	return &sent, nil
 }
 
 // cooldownState persists which price slot was last alerted
 type cooldownState struct {
-	LastFuelSlot string `json:"last_fuel_slot"`
-	LastCO2Slot  string `json:"last_co2_slot"`
-	LastCheck    string `json:"last_check"`
+	LastFuelSlot string                `json:"last_fuel_slot"`
+	LastCO2Slot  string                `json:"last_co2_slot"`
+	LastCheck    string                `json:"last_check"`
+	Stats        checkStats            `json:"stats"`
+	UpdateOffset int64                 `json:"update_offset,omitempty"`
+	LastSpread   string                `json:"last_spread_slot,omitempty"`
+	LastFuelSent string                `json:"last_fuel_alert,omitempty"`
+	LastCO2Sent  string                `json:"last_co2_alert,omitempty"`
+	LastReminder string                `json:"last_reminder,omitempty"`
+	Maintenance  bool                  `json:"maintenance,omitempty"`
+	SessionToken string                `json:"session_token,omitempty"`
+	SessionFrom  string                `json:"session_token_source,omitempty"`
+	UpdateCheck  string                `json:"last_update_check,omitempty"`
+	Notified     string                `json:"notified_version,omitempty"`
+	LastTier     *tierAlert            `json:"last_tier_alert,omitempty"`
+	Escalation   string                `json:"pending_escalation,omitempty"`
+	EscalateAt   string                `json:"escalate_at,omitempty"`
+	SlotHistory  map[string]slotRecord `json:"slot_history,omitempty"`
+	RecordFuel   int                   `json:"record_low_fuel,omitempty"`
+	RecordCO2    int                   `json:"record_low_co2,omitempty"`
+	Interval     string                `json:"check_interval,omitempty"`
+	FreeCO2Low   bool                  `json:"record_low_co2_free,omitempty"`
+	LastFormula  string                `json:"last_formula_slot,omitempty"`
+	PinnedID     int64                 `json:"pinned_message_id,omitempty"`
+	FuelAlertAt  int                   `json:"last_fuel_threshold,omitempty"`
+	CO2AlertAt   int                   `json:"last_co2_threshold,omitempty"`
+	MigratedFrom string                `json:"migrated_from_chat,omitempty"`
+	MigratedTo   string                `json:"migrated_to_chat,omitempty"`
+	WatchFuel    *thresholdOverride    `json:"watch_fuel,omitempty"`
+	WatchCO2     *thresholdOverride    `json:"watch_co2,omitempty"`
+	Pending      *pendingCommand       `json:"pending_command,omitempty"`
+	Snooze       int                   `json:"snooze_remaining,omitempty"`
+	RecentFuel   []slotPrice           `json:"recent_fuel,omitempty"`
+	LastVelocity string                `json:"last_velocity_slot,omitempty"`
+	LastWait     string                `json:"last_wait_slot,omitempty"`
+	EmptyStreak  int                   `json:"empty_streak,omitempty"`
+	FuelStreak   greenStreak           `json:"fuel_green_streak"`
+	CO2Streak    greenStreak           `json:"co2_green_streak"`
+	ThreadFuel   int64                 `json:"last_fuel_message_id,omitempty"`
+	ThreadCO2    int64                 `json:"last_co2_message_id,omitempty"`
+	Deletes      []pendingDelete       `json:"pending_deletes,omitempty"`
+	FuelAlerted  int                   `json:"last_fuel_alert_price,omitempty"`
+	CO2Alerted   int                   `json:"last_co2_alert_price,omitempty"`
+	RecentAlerts []sentAlert           `json:"recent_alerts,omitempty"`
+	ForecastSent []string              `json:"forecast_alerted,omitempty"`
+	DailyLows    dailyLows             `json:"daily_lows"`
+	SetFuel      *persistedThreshold   `json:"set_fuel_threshold,omitempty"`
+	SetCO2       *persistedThreshold   `json:"set_co2_threshold,omitempty"`
+	RelativeFuel []slotPrice           `json:"relative_fuel,omitempty"`
+	RelativeCO2  []slotPrice           `json:"relative_co2,omitempty"`
 }
 
-// cooldown tracks which price slot was last alerted per type
+// checkStats holds lifetime operational counters, persisted with the cooldown state
+type checkStats struct {
+	TotalChecks   int    `json:"total_checks"`
+	FuelAlerts    int    `json:"fuel_alerts"`
+	CO2Alerts     int    `json:"co2_alerts"`
+	SpreadAlerts  int    `json:"spread_alerts"`
+	FormulaAlerts int    `json:"formula_alerts,omitempty"`
+	FetchErrors   int    `json:"fetch_errors"`
+	SendErrors    int    `json:"send_errors"`
+	LastError     string `json:"last_error,omitempty"`
+	LastErrorTime string `json:"last_error_time,omitempty"`
+}
+
+// cooldown tracks which price slot was last alerted per type.
+// mu guards all fields when command polling runs alongside the checks,
+// checking is set while checkPrices runs so overlapping checks are skipped.
 type cooldown struct {
+	mu           sync.Mutex
+	checking     atomic.Bool
 	lastFuelSlot string
 	lastCO2Slot  string
 	lastCheck    time.Time
+	stats        checkStats
+	updateOffset int64
+	lastSpread   string
+	lastFormula  string
+	lastFuelSent time.Time
+	lastCO2Sent  time.Time
+	lastPrices   *PriceSlot
+	lastReminder string
+	maintenance  bool
+
+	// Session token from SESSION_REFRESH_URL and the hash of the .env token it replaced
+	sessionToken  string
+	sessionSource string
+
+	lastUpdateCheck time.Time
+	notifiedVersion string
+
+	// Last price alert sent with TIER_CHATS, for MIN_TIER_IMPROVEMENT
+	lastTier *tierAlert
+
+	// Last VERIFY_TELEGRAM result, not persisted so every start checks once
+	telegramVerifiedAt time.Time
+	telegramUsername   string
+	telegramError      string
+
+	// Price alert waiting for /ack and when it gets re-sent
+	escalationMessage string
+	escalateAt        time.Time
+
+	// Per-slot prices within HISTORY_RETENTION, keyed by slotHistoryKey
+	slotHistory map[string]slotRecord
+	// Day the history was last pruned, not persisted
+	historyPruned string
+
+	// Lowest prices ever seen, never reset. recordCO2Free marks a record of
+	// free CO2 (CO2_ALLOW_ZERO), as a zero recordCO2 means none is set yet.
+	recordFuel    int
+	recordCO2     int
+	recordCO2Free bool
+
+	// Forecast from the last successful fetch and when it was fetched, not persisted
+	lastForecast []PriceSlot
+	lastFetched  time.Time
+
+	// Check interval set with /interval, 0 for CHECK_INTERVAL. The scheduler
+	// re-arms when intervalChanged fires.
+	checkInterval   time.Duration
+	intervalChanged chan struct{}
+
+	// Thresholds the last fuel/CO2 dedup slots were recorded under
+	lastFuelThreshold int
+	lastCO2Threshold  int
+
+	// Prices of the last fuel/CO2 alert in the current green streak,
+	// cleared once the price goes above threshold (ALERT_ON_IMPROVEMENT_ONLY)
+	lastFuelAlertPrice int
+	lastCO2AlertPrice  int
+
+	// Last RECENT_ALERTS price alerts sent, oldest first, for /recent
+	recentAlerts []sentAlert
+
+	// Upcoming "fuel|co2 slotKey" dips already announced (ALERT_ON_FORECAST)
+	forecastAlerted []string
+
+	// Lowest prices of the current local day (SUMMARY_TIME)
+	dailyLows dailyLows
+
+	// Thresholds set with /setfuel and /setco2
+	setFuel *persistedThreshold
+	setCO2  *persistedThreshold
+
+	// Recent slot prices for the ALERT_MODE=relative average
+	relativeFuel []slotPrice
+	relativeCO2  []slotPrice
+
+	// Temporary thresholds set with /watch
+	watchFuel *thresholdOverride
+	watchCO2  *thresholdOverride
+
+	// Command waiting for /confirm (CONFIRM_COMMANDS)
+	pendingCommand *pendingCommand
+
+	// Alerts still to be skipped after /snooze
+	snoozeRemaining int
+
+	// Recent fuel prices for FUEL_VELOCITY and the last slot it alerted for
+	recentFuel   []slotPrice
+	lastVelocity string
+
+	// Forecast minimum slot the last WAIT_SPREAD advisory pointed to
+	lastWait string
+
+	// Consecutive empty price lists, see EMPTY_NOTICE_AFTER
+	emptyStreak int
+
+	// Consecutive green slots, see FUEL_CONFIRM_SLOTS and CO2_CONFIRM_SLOTS
+	fuelStreak greenStreak
+	co2Streak  greenStreak
+
+	// Message IDs of the last alert per type, for THREAD_ALERTS replies
+	lastFuelMessageID int64
+	lastCO2MessageID  int64
+
+	// Sent alerts waiting for AUTO_DELETE_AFTER
+	pendingDeletes []pendingDelete
+
+	// Supergroup migration of the configured chat, see chatMigration
+	migratedFrom string
+	migratedTo   string
+
+	// Message ID of the pinned forecast (PINNED_FORECAST)
+	pinnedMessageID int64
+
+	// Set once the thresholds were compared with the first fetched prices
+	thresholdsChecked bool
+
+	// Where the state is persisted (STATE_BACKEND)
+	store StateStore
 }
 
 func main() {
+	var envFiles envFileList
+	flag.Var(&envFiles, "env", "`path` of an env file to load instead of .env, repeat to merge several (later files win)")
+	report := flag.Bool("report", false, "fetch the prices once, print what the bot sees and would decide, and exit without sending anything")
+	dump := flag.Bool("dump-config", false, "print the effective config as a .env with secrets redacted, and exit")
+	flag.Parse()
+
 	log.SetFlags(log.Ldate | log.Ltime)
-	log.Println("Shipping Manager Price Alert Bot starting...")
+	log.Printf("Shipping Manager Price Alert Bot %s starting...", currentVersion())
 
-	cfg, err := loadConfig()
+	cfg, err := loadConfig(envFiles)
 	if err != nil {
 		log.Fatalf("Config error: %s", err)
 	}
+	ensureTimezones(cfg)
 
-	log.Printf("Config loaded - Fuel threshold: $%d/t, CO2 threshold: $%d/t, Timezone: %s", cfg.FuelThreshold, cfg.CO2Threshold, cfg.Timezone)
-	log.Printf("Telegram chat ID: %s", cfg.TelegramChatID)
+	log.Printf("Config loaded - Fuel threshold: $%d/t, CO2 threshold: $%d/t, Timezone: %s, Slot timezone: %s", cfg.FuelThreshold, cfg.CO2Threshold, cfg.Timezone, cfg.SlotTimezone)
+	log.Printf("Sending alerts to: %s", cfg.Notifier.Target())
+	if cfg.NotifierType == "file" {
+		if err := ensureSpoolDir(cfg.SpoolDir); err != nil {
+			log.Fatalf("Config error: %s", err)
+		}
+	}
+	log.Printf("State stored in: %s", cfg.StateStore.Name())
 
-	// Graceful shutdown
+	// Graceful shutdown, and config reload on SIGHUP
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
 
 	client := &http.Client{
-		Timeout: 30 * time.Second,
+		Timeout:   30 * time.Second,
+		Transport: newTransport(cfg),
 	}
 
-	cd := loadCooldown()
+	cd := loadCooldown(cfg.StateStore)
+	applyRefreshedSession(cfg, cd)
+	applyChatMigration(cfg, cd)
+	applyThresholdOverrides(cfg, cd)
+	resetDedupOnThresholdChange(cfg, cd)
+	if *report {
+		os.Exit(runReport(os.Stdout, client, cfg, cd))
+	}
+	if *dump {
+		dumpConfig(os.Stdout, cfg, cd)
+		return
+	}
 	log.Printf("Cooldown state loaded - last check: %s, last fuel slot: %s, last CO2 slot: %s",
 		formatCooldownTime(cd.lastCheck, cfg.Timezone),
 		formatSlot(cd.lastFuelSlot), formatSlot(cd.lastCO2Slot))
+	log.Printf("Stats - checks: %d, fuel alerts: %d, CO2 alerts: %d, fetch errors: %d, send errors: %d, last error: %s",
+		cd.stats.TotalChecks, cd.stats.FuelAlerts, cd.stats.CO2Alerts,
+		cd.stats.FetchErrors, cd.stats.SendErrors, formatLastError(cd.stats, cfg.Timezone))
+
+	// Refuse to run against a chat the bot can't post to
+	if cfg.VerifyChat {
+		if err := verifyChat(client, cfg); err != nil {
+			log.Fatalf("Chat check failed: %s", err)
+		}
+	}
 
-	// Run immediate check on startup
-	log.Println("Running initial price check...")
-	checkPrices(client, cfg, cd)
+	// Lifetime stats at startup, the shutdown summary reports the difference
+	started, startStats := time.Now(), cd.stats
 
-	// Calculate time until next :01 or :31 (UTC-based, prices change on UTC boundaries)
-	now := time.Now().UTC()
-	minute := now.Minute()
-	var nextCheck time.Time
+	// Handle chat commands in the background, stopped again on shutdown
+	stopBackground := startBackground(client, cfg, cd)
+	defer func() { stopBackground() }()
 
-	if minute < 1 {
-		nextCheck = time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 1, 0, 0, time.UTC)
-	} else if minute < 31 {
-		nextCheck = time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 31, 0, 0, time.UTC)
-	} else {
-		// Next hour :01
-		next := now.Add(time.Hour)
-		nextCheck = time.Date(next.Year(), next.Month(), next.Day(), next.Hour(), 1, 0, 0, time.UTC)
+	// Swap in a reloaded config between checks. The background tasks are
+	// restarted with it, so nothing reads the old config while it is replaced.
+	reload := func() {
+		newCfg, err := reloadConfig(cfg, cd, envFiles)
+		if err != nil {
+			log.Printf("ERROR reloading config, keeping the current one: %s", err)
+			return
+		}
+		stopBackground()
+		interval := effectiveCheckInterval(cfg, cd)
+		cfg = newCfg
+		stopBackground = startBackground(client, cfg, cd)
+		if effectiveCheckInterval(cfg, cd) != interval {
+			notifyIntervalChanged(cd)
+		}
+		log.Printf("Config reloaded - Fuel threshold: $%d/t, CO2 threshold: $%d/t, Timezone: %s, Slot timezone: %s",
+			cfg.FuelThreshold, cfg.CO2Threshold, cfg.Timezone, cfg.SlotTimezone)
+	}
+
+	// Delete old alerts in the background, stopped again on shutdown
+	if cfg.AutoDeleteAfter > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		go watchDeletions(ctx, client, cfg, cd)
+		defer cancel()
 	}
 
-	waitDuration := time.Until(nextCheck)
-	log.Printf("Next check at %s (%s) (in %s)",
-		nextCheck.In(cfg.Timezone).Format("15:04"), cfg.Timezone,
-		waitDuration.Truncate(time.Second))
+	// Run immediate check on startup
+	log.Println("Running initial price check...")
+	runScheduledCheck(client, cfg, cd)
+
+	// Wait until one minute after the next check interval boundary (:01 and :31 by default)
+	// in the slot timezone (UTC by default, prices change on UTC boundaries)
+	interval := effectiveCheckInterval(cfg, cd)
+	firstCheck := scheduleNextCheck(cfg, interval)
 
 	// Wait for first scheduled check or shutdown
-	select {
-	case <-time.After(waitDuration):
-	case sig := <-sigChan:
-		log.Printf("Received %s, shutting down", sig)
-		return
+	for waiting := true; waiting; {
+		select {
+		case <-firstCheck:
+			waiting = false
+		case <-cd.intervalChanged:
+			interval = effectiveCheckInterval(cfg, cd)
+			firstCheck = scheduleNextCheck(cfg, interval)
+		case <-hupChan:
+			reload()
+		case sig := <-sigChan:
+			log.Printf("Received %s, shutting down", sig)
+			logShutdownSummary(cd, started, startStats)
+			sendShutdownAlert(client, cfg, sig)
+			return
+		}
 	}
 
 	// Run the scheduled check
-	checkPrices(client, cfg, cd)
+	runScheduledCheck(client, cfg, cd)
+	recheck := scheduleRecheck(cfg)
 
-	// Then tick every 30 minutes
-	ticker := time.NewTicker(30 * time.Minute)
+	// Then tick every CHECK_INTERVAL (once per slot by default). A new interval
+	// from /interval or a reload stops the ticker until its next boundary.
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
+	var realign <-chan time.Time
 
 	for {
 		select {
 		case <-ticker.C:
+			runScheduledCheck(client, cfg, cd)
+			recheck = scheduleRecheck(cfg)
+		case <-cd.intervalChanged:
+			ticker.Stop()
+			select {
+			case <-ticker.C:
+			default:
+			}
+			interval = effectiveCheckInterval(cfg, cd)
+			realign = scheduleNextCheck(cfg, interval)
+		case <-realign:
+			realign = nil
+			ticker.Reset(interval)
+			runScheduledCheck(client, cfg, cd)
+			recheck = scheduleRecheck(cfg)
+		case <-recheck:
+			// Dedup only holds slots that were alerted, so a price that dropped
+			// below threshold since the first check still alerts
+			log.Println("Re-checking prices within the slot (RECHECK_AFTER)")
 			checkPrices(client, cfg, cd)
+			recheck = nil
+		case <-hupChan:
+			reload()
 		case sig := <-sigChan:
 			log.Printf("Received %s, shutting down", sig)
+			logShutdownSummary(cd, started, startStats)
+			sendShutdownAlert(client, cfg, sig)
 			return
 		}
 	}
 }
 
-// loadConfig reads .env file from the same directory as the executable
-func loadConfig() (*Config, error) {
-	envPath := findEnvFile()
-	if envPath == "" {
-		return nil, fmt.Errorf(".env file not found (checked executable dir and working dir)")
+// startBackground runs the chat command poller and, with ESCALATE_AFTER, the
+// escalation watcher for cfg. The returned function stops them and waits for
+// the poller to exit.
+func startBackground(client *http.Client, cfg *Config, cd *cooldown) func() {
+	if !cfg.CommandsEnabled {
+		return func() {}
 	}
 
-	log.Printf("Loading config from: %s", envPath)
-
-	f, err := os.Open(envPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open .env: %w", err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		pollCommands(ctx, client, cfg, cd)
+		close(done)
+	}()
+	if cfg.EscalateAfter > 0 {
+		go watchEscalations(ctx, client, cfg, cd)
 	}
-	defer f.Close()
+	return func() {
+		cancel()
+		<-done
+	}
+}
 
-	vars := make(map[string]string)
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
+// loadConfig reads .env file from the same directory as the executable.
+// When no .env exists and the bot runs in a terminal, it falls back to an
+// interactive setup prompt instead of failing. Files given with --env replace
+// .env and are merged in order, real environment variables override them all.
+func loadConfig(envFiles []string) (*Config, error) {
+	var vars map[string]string
+	envPath := findEnvFile()
+	if len(envFiles) > 0 {
+		// Later files override earlier ones
+		vars = make(map[string]string)
+		for _, path := range envFiles {
+			log.Printf("Loading config from: %s", path)
+			v, err := readEnvFile(path)
+			if err != nil {
+				return nil, err
+			}
+			for key, value := range v {
+				vars[key] = value
+			}
 		}
-		idx := strings.Index(line, "=")
-		if idx < 0 {
-			continue
+	} else if envPath == "" {
+		if !isInteractive() {
+			return nil, fmt.Errorf(".env file not found (checked executable dir and working dir)")
 		}
-		key := strings.TrimSpace(line[:idx])
-		value := strings.TrimSpace(line[idx+1:])
+
+		log.Println(".env file not found, starting interactive setup...")
+		v, err := runSetup(os.Stdin, os.Stdout)
+		if err != nil {
+			return nil, fmt.Errorf("interactive setup failed: %w", err)
+		}
+		vars = v
+	} else {
+		log.Printf("Loading config from: %s", envPath)
+
+		v, err := readEnvFile(envPath)
+		if err != nil {
+			return nil, err
+		}
+		vars = v
+	}
+
+	// Real environment variables override every file, and CONFIG_URL too
+	env := environmentVars()
+	for key, value := range env {
 		vars[key] = value
 	}
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("failed to read .env: %w", err)
+
+	if vars["CONFIG_URL"] != "" {
+		return loadRemoteConfig(vars, env)
+	}
+	return configFromVars(vars)
+}
+
+// newTransport returns the HTTP transport for all API calls. FORCE_HTTP1
+// pins HTTP/1.1 for networks where HTTP/2 requests hang, an empty
+// TLSNextProto map keeps the transport from ever upgrading.
+func newTransport(cfg *Config) http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.ForceHTTP1 {
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return transport
+}
+
+// envFileList collects the repeatable --env flag in the order given
+type envFileList []string
+
+func (l *envFileList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *envFileList) Set(path string) error {
+	*l = append(*l, path)
+	return nil
+}
+
+// configFromVars validates the .env values and builds the Config
+func configFromVars(vars map[string]string) (*Config, error) {
+	if err := loadSecretFiles(vars); err != nil {
+		return nil, err
+	}
+
+	// Pasted tokens often carry stray CR/LF, BOM or zero-width characters
+	// that break the Telegram URL and the session cookie
+	for _, key := range []string{"TELEGRAM_BOT_TOKEN", "TELEGRAM_CHAT_ID", "SESSION_TOKEN", "MATRIX_TOKEN", "MATRIX_ROOM", "SMTP_PASS"} {
+		vars[key] = cleanToken(vars[key])
+	}
+
+	// Where alerts go, each notifier has its own required settings. SINK is
+	// accepted as another name for NOTIFIER.
+	notifierType := strings.ToLower(vars["NOTIFIER"])
+	if sink := strings.ToLower(vars["SINK"]); sink != "" {
+		if notifierType != "" && notifierType != sink {
+			return nil, fmt.Errorf("NOTIFIER and SINK are the same setting, set only one (got %s and %s)", vars["NOTIFIER"], vars["SINK"])
+		}
+		notifierType = sink
+	}
+	if notifierType == "" {
+		notifierType = "telegram"
+	}
+	required := []string{"SESSION_TOKEN", "FUEL_THRESHOLD", "CO2_THRESHOLD"}
+	switch notifierType {
+	case "telegram":
+		required = append([]string{"TELEGRAM_BOT_TOKEN", "TELEGRAM_CHAT_ID"}, required...)
+	case "matrix":
+		required = append([]string{"MATRIX_HOMESERVER", "MATRIX_ROOM", "MATRIX_TOKEN"}, required...)
+	case "file":
+		required = append([]string{"SPOOL_DIR"}, required...)
+	case "email":
+		required = append([]string{"SMTP_HOST", "EMAIL_TO"}, required...)
+	default:
+		return nil, fmt.Errorf("NOTIFIER must be telegram, matrix, file or email, got: %s", notifierType)
 	}
 
 	// Validate required fields
-	required := []string{"TELEGRAM_BOT_TOKEN", "TELEGRAM_CHAT_ID", "SESSION_TOKEN", "FUEL_THRESHOLD", "CO2_THRESHOLD"}
 	for _, key := range required {
 		if vars[key] == "" {
 			return nil, fmt.Errorf("missing required .env value: %s", key)
 		}
 	}
 
-	fuelThreshold, err := strconv.Atoi(vars["FUEL_THRESHOLD"])
+	// SMTP settings, the sender defaults to the login user
+	smtpPort := vars["SMTP_PORT"]
+	if smtpPort == "" {
+		smtpPort = "587"
+	}
+	if _, err := strconv.Atoi(smtpPort); err != nil {
+		return nil, fmt.Errorf("SMTP_PORT must be a number: %w", err)
+	}
+	var emailTo []string
+	for _, addr := range strings.Split(vars["EMAIL_TO"], ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			emailTo = append(emailTo, addr)
+		}
+	}
+	emailFrom := vars["EMAIL_FROM"]
+	if emailFrom == "" {
+		emailFrom = vars["SMTP_USER"]
+	}
+	if notifierType == "email" && emailFrom == "" {
+		return nil, fmt.Errorf("EMAIL_FROM is required when SMTP_USER is not set")
+	}
+
+	// Where the cooldown state lives, Redis lets several instances share it
+	stateBackend := strings.ToLower(vars["STATE_BACKEND"])
+	if stateBackend == "" {
+		stateBackend = "file"
+	}
+	if stateBackend != "file" && stateBackend != "redis" {
+		return nil, fmt.Errorf("STATE_BACKEND must be file or redis, got: %s", vars["STATE_BACKEND"])
+	}
+	if stateBackend == "redis" {
+		if vars["REDIS_URL"] == "" {
+			return nil, fmt.Errorf("REDIS_URL is required when STATE_BACKEND=redis")
+		}
+		u, err := url.Parse(vars["REDIS_URL"])
+		if err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") || u.Hostname() == "" {
+			return nil, fmt.Errorf("REDIS_URL must be a redis:// or rediss:// URL, e.g. redis://localhost:6379/0")
+		}
+		if db := strings.Trim(u.Path, "/"); db != "" {
+			if _, err := strconv.Atoi(db); err != nil {
+				return nil, fmt.Errorf("REDIS_URL database must be a number, got: %s", db)
+			}
+		}
+	}
+	redisKey := vars["REDIS_KEY"]
+	if redisKey == "" {
+		redisKey = "shippingmanager_alertbot:state"
+	}
+
+	if notifierType == "matrix" {
+		if u, err := url.Parse(vars["MATRIX_HOMESERVER"]); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("MATRIX_HOMESERVER must be an http(s) URL, got: %s", vars["MATRIX_HOMESERVER"])
+		}
+	}
+
+	for _, key := range []string{"TELEGRAM_BOT_TOKEN", "SESSION_TOKEN", "MATRIX_TOKEN"} {
+		if strings.ContainsFunc(vars[key], unicode.IsSpace) {
+			return nil, fmt.Errorf("%s must not contain spaces, check for a partial or doubled paste", key)
+		}
+	}
+
+	// A range like 380-420 alerts at or below its top and marks a buy zone
+	fuelZoneLow, fuelThreshold, err := parseThreshold(vars, "FUEL_THRESHOLD")
 	if err != nil {
-		return nil, fmt.Errorf("FUEL_THRESHOLD must be a number: %w", err)
+		return nil, err
 	}
 
-	co2Threshold, err := strconv.Atoi(vars["CO2_THRESHOLD"])
+	co2ZoneLow, co2Threshold, err := parseThreshold(vars, "CO2_THRESHOLD")
 	if err != nil {
-		return nil, fmt.Errorf("CO2_THRESHOLD must be a number: %w", err)
+		return nil, err
 	}
 
-	tz := resolveTimezone(vars["TIMEZONE"])
+	// Optional buy quantity suggestion, tiered by how far below threshold a price is
+	buyAdvice, err := parseBool(vars, "BUY_ADVICE")
+	if err != nil {
+		return nil, err
+	}
+	var buyTiers []buyTier
+	if vars["BUY_ADVICE_TIERS"] != "" {
+		if buyTiers, err = parseBuyTiers(vars["BUY_ADVICE_TIERS"]); err != nil {
+			return nil, err
+		}
+	} else if buyAdvice {
+		buyTiers = defaultBuyTiers
+	}
 
-	return &Config{
-		TelegramBotToken: vars["TELEGRAM_BOT_TOKEN"],
-		TelegramChatID:   vars["TELEGRAM_CHAT_ID"],
-		SessionToken:     vars["SESSION_TOKEN"],
-		FuelThreshold:    fuelThreshold,
-		CO2Threshold:     co2Threshold,
-		Timezone:         tz,
-	}, nil
-}
+	strictTimezone, err := parseBool(vars, "STRICT_TIMEZONE")
+	if err != nil {
+		return nil, err
+	}
 
-// timezoneAbbreviations maps abbreviations to IANA timezone names.
-// Where abbreviations are ambiguous (e.g. IST, CST, GST), the most
-// populous region wins. Users needing the other meaning should use
-// the full IANA name (e.g. Asia/Kolkata, America/Chicago, Asia/Dubai).
-var timezoneAbbreviations = map[string]string{
-	// Universal
-	"UTC":  "UTC",
-	"GMT":  "Europe/London",
+	tz, err := loadTimezone("TIMEZONE", vars["TIMEZONE"], time.Now().Location(), strictTimezone)
+	if err != nil {
+		return nil, err
+	}
 
-	// Europe
-	"WET":  "Europe/Lisbon",
-	"WEST": "Europe/Lisbon",
-	"CET":  "Europe/Berlin",
-	"CEST": "Europe/Berlin",
-	"MET":  "Europe/Berlin",
-	"MEST": "Europe/Berlin",
-	"EET":  "Europe/Bucharest",
-	"EEST": "Europe/Bucharest",
-	"BST":  "Europe/London",
-	"IST":  "Asia/Kolkata",
-	"MSK":  "Europe/Moscow",
-	"SAMT": "Europe/Samara",
-	"YEKT": "Asia/Yekaterinburg",
-	"GET":  "Asia/Tbilisi",
-	"AZT":  "Asia/Baku",
-	"AMT":  "Asia/Yerevan",
-	"FET":  "Europe/Minsk",
-	"TRT":  "Europe/Istanbul",
+	// Slot timezone drives slot matching and check alignment, independent of display
+	slotTZ, err := loadTimezone("SLOT_TIMEZONE", vars["SLOT_TIMEZONE"], time.UTC, strictTimezone)
+	if err != nil {
+		return nil, err
+	}
 
-	// North America
-	"NST":  "America/St_Johns",
-	"NDT":  "America/St_Johns",
-	"AST":  "America/Halifax",
-	"ADT":  "America/Halifax",
-	"EST":  "America/New_York",
-	"EDT":  "America/New_York",
-	"CST":  "America/Chicago",
-	"CDT":  "America/Chicago",
-	"MST":  "America/Denver",
-	"MDT":  "America/Denver",
-	"PST":  "America/Los_Angeles",
-	"PDT":  "America/Los_Angeles",
-	"AKST": "America/Anchorage",
-	"AKDT": "America/Anchorage",
-	"HST":  "Pacific/Honolulu",
-	"HAST": "Pacific/Honolulu",
-	"HADT": "America/Adak",
+	// Price slot length, the game uses half-hour slots
+	slotMinutes := 30
+	if vars["SLOT_MINUTES"] != "" {
+		slotMinutes, err = strconv.Atoi(vars["SLOT_MINUTES"])
+		if err != nil {
+			return nil, fmt.Errorf("SLOT_MINUTES must be a number: %w", err)
+		}
+		if slotMinutes <= 0 || 60%slotMinutes != 0 {
+			return nil, fmt.Errorf("SLOT_MINUTES must evenly divide an hour (e.g. 15, 30, 60), got: %d", slotMinutes)
+		}
+	}
 
-	// Central America / Caribbean
-	"CST6": "America/Costa_Rica",
-	"ECT":  "America/Guayaquil",
-	"COT":  "America/Bogota",
-	"VET":  "America/Caracas",
-	"PET":  "America/Lima",
-	"CIDST":"America/Cayman",
-	"CUT":  "America/Havana",
+	// How often to check, one minute past each multiple of the interval.
+	// Defaults to once per slot, a shorter interval checks several times per slot.
+	checkInterval := time.Duration(slotMinutes) * time.Minute
+	if vars["CHECK_INTERVAL"] != "" {
+		checkInterval, err = time.ParseDuration(vars["CHECK_INTERVAL"])
+		if err != nil {
+			return nil, fmt.Errorf("CHECK_INTERVAL must be a duration like 15m or 1h: %w", err)
+		}
+		if checkInterval <= 0 || checkInterval%time.Minute != 0 || time.Hour%checkInterval != 0 {
+			return nil, fmt.Errorf("CHECK_INTERVAL must be whole minutes that evenly divide an hour (e.g. 15m, 30m, 1h), got: %s", vars["CHECK_INTERVAL"])
+		}
+	}
 
-	// South America
-	"BRT":  "America/Sao_Paulo",
-	"BRST": "America/Sao_Paulo",
-	"ART":  "America/Argentina/Buenos_Aires",
-	"CLT":  "America/Santiago",
-	"CLST": "America/Santiago",
-	"UYT":  "America/Montevideo",
-	"PYT":  "America/Asuncion",
-	"PYST": "America/Asuncion",
-	"BOT":  "America/La_Paz",
-	"GFT":  "America/Cayenne",
-	"SRT":  "America/Paramaribo",
-	"GYT":  "America/Guyana",
-	"FKT":  "Atlantic/Stanley",
+	// Optional second check after each scheduled one, to catch prices the API
+	// updates mid-slot. It must fall before the next check one minute past the boundary.
+	recheckAfter, err := parseDuration(vars, "RECHECK_AFTER")
+	if err != nil {
+		return nil, err
+	}
+	if maxRecheck := checkInterval - time.Minute; recheckAfter >= maxRecheck && recheckAfter > 0 {
+		return nil, fmt.Errorf("RECHECK_AFTER must be shorter than %s with checks every %s, got: %s", formatDuration(maxRecheck), formatDuration(checkInterval), vars["RECHECK_AFTER"])
+	}
 
-	// East Asia
-	"JST":  "Asia/Tokyo",
-	"KST":  "Asia/Seoul",
-	"CST8": "Asia/Shanghai",
-	"HKT":  "Asia/Hong_Kong",
-	"TWT":  "Asia/Taipei",
-	"PHT":  "Asia/Manila",
-	"PHST": "Asia/Manila",
-	"MYT":  "Asia/Kuala_Lumpur",
-	"SGT":  "Asia/Singapore",
-	"BNT":  "Asia/Brunei",
+	// Retries of a failed price fetch, so a network blip doesn't cost a whole slot
+	fetchRetries := 2
+	if vars["FETCH_RETRIES"] != "" {
+		fetchRetries, err = strconv.Atoi(vars["FETCH_RETRIES"])
+		if err != nil {
+			return nil, fmt.Errorf("FETCH_RETRIES must be a number: %w", err)
+		}
+		if fetchRetries < 0 || fetchRetries > 10 {
+			return nil, fmt.Errorf("FETCH_RETRIES must be between 0 and 10: %d", fetchRetries)
+		}
+	}
+	fetchBackoff, err := parseDuration(vars, "FETCH_BACKOFF")
+	if err != nil {
+		return nil, err
+	}
+	if fetchBackoff == 0 {
+		fetchBackoff = time.Second
+	}
 
-	// Southeast Asia
-	"ICT":  "Asia/Bangkok",
-	"WIB":  "Asia/Jakarta",
-	"WITA": "Asia/Makassar",
-	"WIT":  "Asia/Jayapura",
-	"MMT":  "Asia/Yangon",
+	// Safety limit against runaway alerting, far above what normal operation sends
+	maxSendsPerMinute := 20
+	if vars["MAX_SENDS_PER_MINUTE"] != "" {
+		maxSendsPerMinute, err = strconv.Atoi(vars["MAX_SENDS_PER_MINUTE"])
+		if err != nil {
+			return nil, fmt.Errorf("MAX_SENDS_PER_MINUTE must be a number: %w", err)
+		}
+		if maxSendsPerMinute < 0 {
+			return nil, fmt.Errorf("MAX_SENDS_PER_MINUTE must not be negative: %d", maxSendsPerMinute)
+		}
+	}
+
+	// Body encoding for sendMessage, Telegram accepts both
+	sendFormat := strings.ToLower(vars["TELEGRAM_SEND_FORMAT"])
+	if sendFormat == "" {
+		sendFormat = "json"
+	}
+	if sendFormat != "json" && sendFormat != "form" {
+		return nil, fmt.Errorf("TELEGRAM_SEND_FORMAT must be json or form, got: %s", vars["TELEGRAM_SEND_FORMAT"])
+	}
+
+	// What to use when the forecast has no slot for the current time
+	fallbackMode := strings.ToLower(vars["FALLBACK_MODE"])
+	if fallbackMode == "" {
+		fallbackMode = "last"
+	}
+	if fallbackMode != "last" && fallbackMode != "nearest" && fallbackMode != "none" {
+		return nil, fmt.Errorf("FALLBACK_MODE must be last, nearest or none, got: %s", vars["FALLBACK_MODE"])
+	}
+	useFirstSlot, err := parseBool(vars, "USE_FIRST_SLOT")
+	if err != nil {
+		return nil, err
+	}
+
+	// Request method and body for the price endpoint, defaults match the game client
+	apiMethod := strings.ToUpper(vars["API_METHOD"])
+	if apiMethod == "" {
+		apiMethod = http.MethodPost
+	}
+	switch apiMethod {
+	case http.MethodGet, http.MethodPost, http.MethodPut:
+	default:
+		return nil, fmt.Errorf("API_METHOD must be GET, POST or PUT, got: %s", vars["API_METHOD"])
+	}
+
+	apiHeaders, err := parseAPIHeaders(vars["API_HEADERS"])
+	if err != nil {
+		return nil, err
+	}
+
+	// Optional User-Agent rotation for the price request, off by default
+	userAgentRotate := strings.ToLower(vars["USER_AGENT_ROTATE"])
+	var userAgents []string
+	switch userAgentRotate {
+	case "", "off":
+		userAgentRotate = "off"
+	case "request", "process":
+		userAgents = defaultUserAgents
+		if vars["USER_AGENT_POOL"] != "" {
+			userAgents = nil
+			for _, ua := range strings.Split(vars["USER_AGENT_POOL"], "|") {
+				if ua = strings.TrimSpace(ua); ua != "" {
+					userAgents = append(userAgents, ua)
+				}
+			}
+			if len(userAgents) == 0 {
+				return nil, fmt.Errorf("USER_AGENT_POOL must list at least one User-Agent separated by |")
+			}
+		}
+		if userAgentRotate == "process" {
+			// Stable for the whole run, a new pick on each start
+			userAgents = []string{userAgents[rand.IntN(len(userAgents))]}
+		}
+	default:
+		return nil, fmt.Errorf("USER_AGENT_ROTATE must be off, request or process, got: %s", vars["USER_AGENT_ROTATE"])
+	}
+
+	// Response bodies quoted in errors are cut to this many characters
+	maxLogBody := 300
+	if vars["MAX_LOG_BODY"] != "" {
+		maxLogBody, err = strconv.Atoi(vars["MAX_LOG_BODY"])
+		if err != nil {
+			return nil, fmt.Errorf("MAX_LOG_BODY must be a number: %w", err)
+		}
+		if maxLogBody < 1 {
+			return nil, fmt.Errorf("MAX_LOG_BODY must be at least 1: %d", maxLogBody)
+		}
+	}
+
+	// Optional cash budget used to show how much can be bought at the alerted price
+	budget := 0
+	if vars["BUDGET"] != "" {
+		budget, err = strconv.Atoi(vars["BUDGET"])
+		if err != nil {
+			return nil, fmt.Errorf("BUDGET must be a number: %w", err)
+		}
+		if budget < 0 {
+			return nil, fmt.Errorf("BUDGET must not be negative: %d", budget)
+		}
+	}
+
+	// Optional combined alert condition, e.g. "fuel + 3*co2 <= 600"
+	var alertFormula *alertFormula
+	if vars["ALERT_FORMULA"] != "" {
+		alertFormula, err = parseFormula(vars["ALERT_FORMULA"])
+		if err != nil {
+			return nil, fmt.Errorf("ALERT_FORMULA is invalid: %w", err)
+		}
+	}
+
+	// Optional look-ahead for a cheaper slot coming up soon
+	holdWindow, err := parseDuration(vars, "HOLD_WINDOW")
+	if err != nil {
+		return nil, err
+	}
+	holdMinDrop := 1
+	if vars["HOLD_MIN_DROP"] != "" {
+		holdMinDrop, err = strconv.Atoi(vars["HOLD_MIN_DROP"])
+		if err != nil {
+			return nil, fmt.Errorf("HOLD_MIN_DROP must be a number: %w", err)
+		}
+		if holdMinDrop < 1 {
+			return nil, fmt.Errorf("HOLD_MIN_DROP must be at least 1: %d", holdMinDrop)
+		}
+	}
+
+	// Optional alert on fast fuel price moves, in $/t per slot
+	fuelVelocity := 0
+	if vars["FUEL_VELOCITY"] != "" {
+		fuelVelocity, err = strconv.Atoi(vars["FUEL_VELOCITY"])
+		if err != nil {
+			return nil, fmt.Errorf("FUEL_VELOCITY must be a number: %w", err)
+		}
+		if fuelVelocity < 1 {
+			return nil, fmt.Errorf("FUEL_VELOCITY must be at least 1: %d", fuelVelocity)
+		}
+	}
+
+	// Optional "wait" advisory when the forecast has a much cheaper fuel slot
+	waitSpread := 0
+	if vars["WAIT_SPREAD"] != "" {
+		waitSpread, err = strconv.Atoi(vars["WAIT_SPREAD"])
+		if err != nil {
+			return nil, fmt.Errorf("WAIT_SPREAD must be a number: %w", err)
+		}
+		if waitSpread < 1 {
+			return nil, fmt.Errorf("WAIT_SPREAD must be at least 1: %d", waitSpread)
+		}
+	}
+
+	// Optional alert on the fuel/CO2 spread leaving the SPREAD_MIN..SPREAD_MAX band
+	spreadMode := strings.ToLower(vars["SPREAD_MODE"])
+	if spreadMode == "" {
+		spreadMode = "ratio"
+	}
+	if spreadMode != "ratio" && spreadMode != "diff" {
+		return nil, fmt.Errorf("SPREAD_MODE must be ratio or diff, got: %s", vars["SPREAD_MODE"])
+	}
+	spreadMin, err := parseOptionalFloat(vars, "SPREAD_MIN")
+	if err != nil {
+		return nil, err
+	}
+	spreadMax, err := parseOptionalFloat(vars, "SPREAD_MAX")
+	if err != nil {
+		return nil, err
+	}
+	if spreadMin != nil && spreadMax != nil && *spreadMin > *spreadMax {
+		return nil, fmt.Errorf("SPREAD_MIN (%g) must not be greater than SPREAD_MAX (%g)", *spreadMin, *spreadMax)
+	}
+
+	// Optional daily digest of the lowest prices, in TIMEZONE
+	summaryTime := ""
+	if vars["SUMMARY_TIME"] != "" {
+		t, err := time.Parse("15:04", vars["SUMMARY_TIME"])
+		if err != nil {
+			return nil, fmt.Errorf("SUMMARY_TIME must be a time like 22:00, got: %s", vars["SUMMARY_TIME"])
+		}
+		summaryTime = t.Format("15:04")
+	}
+
+	reminderSlots, err := parseSlotList(vars, "REMINDER_SLOTS")
+	if err != nil {
+		return nil, err
+	}
+
+	// More Telegram chats that get the price alerts, sent in parallel
+	sendConcurrency := 4
+	if vars["SEND_CONCURRENCY"] != "" {
+		sendConcurrency, err = strconv.Atoi(vars["SEND_CONCURRENCY"])
+		if err != nil {
+			return nil, fmt.Errorf("SEND_CONCURRENCY must be a number: %w", err)
+		}
+		if sendConcurrency < 1 || sendConcurrency > 20 {
+			return nil, fmt.Errorf("SEND_CONCURRENCY must be between 1 and 20: %d", sendConcurrency)
+		}
+	}
+
+	// Deeper discounts go to more chats
+	tierChats, err := parseTierChats(vars["TIER_CHATS"])
+	if err != nil {
+		return nil, err
+	}
+	extraChatIDs := parseChatIDs(vars["EXTRA_CHAT_IDS"])
+	if (len(extraChatIDs) > 0 || len(tierChats) > 0) && notifierType != "telegram" {
+		return nil, fmt.Errorf("EXTRA_CHAT_IDS and TIER_CHATS require NOTIFIER=telegram, got: %s", notifierType)
+	}
+	// How much a price must improve on the last alert to reach a deeper tier
+	minTierImprovement := 0
+	if vars["MIN_TIER_IMPROVEMENT"] != "" {
+		minTierImprovement, err = strconv.Atoi(vars["MIN_TIER_IMPROVEMENT"])
+		if err != nil {
+			return nil, fmt.Errorf("MIN_TIER_IMPROVEMENT must be a number: %w", err)
+		}
+		if minTierImprovement < 0 {
+			return nil, fmt.Errorf("MIN_TIER_IMPROVEMENT must not be negative: %d", minTierImprovement)
+		}
+	}
+
+	excludeSlots, err := parseSlotList(vars, "EXCLUDE_SLOTS")
+	if err != nil {
+		return nil, err
+	}
+
+	// Unit suffix after prices in messages, "none" drops it
+	priceUnit := "/t"
+	switch unit := vars["PRICE_UNIT"]; {
+	case strings.EqualFold(unit, "none"):
+		priceUnit = ""
+	case unit == "":
+	case unicode.IsLetter([]rune(unit)[0]):
+		// Words read better spaced, "$500 per ton"
+		priceUnit = " " + unit
+	default:
+		priceUnit = unit
+	}
+
+	// Optional minimum time between alerts of the same type, across slots
+	fuelMinGap, err := parseDuration(vars, "FUEL_MIN_GAP")
+	if err != nil {
+		return nil, err
+	}
+	co2MinGap, err := parseDuration(vars, "CO2_MIN_GAP")
+	if err != nil {
+		return nil, err
+	}
+
+	// Consecutive green slots required before alerting, 0 or 1 alerts right away
+	confirmSlots := map[string]int{}
+	for _, key := range []string{"FUEL_CONFIRM_SLOTS", "CO2_CONFIRM_SLOTS"} {
+		if vars[key] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(vars[key])
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a number: %w", key, err)
+		}
+		if n < 0 {
+			return nil, fmt.Errorf("%s must not be negative: %d", key, n)
+		}
+		confirmSlots[key] = n
+	}
+
+	// Optional per-type alert hours in TIMEZONE
+	fuelHours, err := parseHoursWindow(vars, "FUEL_HOURS")
+	if err != nil {
+		return nil, err
+	}
+	co2Hours, err := parseHoursWindow(vars, "CO2_HOURS")
+	if err != nil {
+		return nil, err
+	}
+
+	// Optional market hours in SLOT_TIMEZONE, checks are skipped outside them
+	marketHours, err := parseHoursWindow(vars, "MARKET_HOURS")
+	if err != nil {
+		return nil, err
+	}
+
+	maintenanceNotice, err := parseBool(vars, "MAINTENANCE_NOTICE")
+	if err != nil {
+		return nil, err
+	}
+
+	// Notice after this many empty price lists in a row, 0 disables it
+	emptyNoticeAfter := 0
+	if vars["EMPTY_NOTICE_AFTER"] != "" {
+		emptyNoticeAfter, err = strconv.Atoi(vars["EMPTY_NOTICE_AFTER"])
+		if err != nil {
+			return nil, fmt.Errorf("EMPTY_NOTICE_AFTER must be a number: %w", err)
+		}
+		if emptyNoticeAfter < 0 {
+			return nil, fmt.Errorf("EMPTY_NOTICE_AFTER must not be negative: %d", emptyNoticeAfter)
+		}
+	}
+
+	// Game link appended to alerts, empty when disabled
+	includeGameLink, err := parseBool(vars, "INCLUDE_GAME_LINK")
+	if err != nil {
+		return nil, err
+	}
+	gameLinkURL := ""
+	if includeGameLink {
+		gameLinkURL = vars["GAME_LINK_URL"]
+		if gameLinkURL == "" {
+			gameLinkURL = "https://shippingmanager.cc/"
+		}
+		if u, err := url.Parse(gameLinkURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return nil, fmt.Errorf("GAME_LINK_URL must be an http(s) URL, got: %s", gameLinkURL)
+		}
+	}
+
+	updateCheck, err := parseBool(vars, "UPDATE_CHECK")
+	if err != nil {
+		return nil, err
+	}
+
+	verifyTelegram, err := parseBool(vars, "VERIFY_TELEGRAM")
+	if err != nil {
+		return nil, err
+	}
+	if verifyTelegram && notifierType != "telegram" {
+		return nil, fmt.Errorf("VERIFY_TELEGRAM requires NOTIFIER=telegram")
+	}
+	verifyTelegramInterval, err := parseDuration(vars, "VERIFY_TELEGRAM_INTERVAL")
+	if err != nil {
+		return nil, err
+	}
+	if verifyTelegramInterval == 0 {
+		verifyTelegramInterval = 6 * time.Hour
+	}
+
+	verifyChat, err := parseBool(vars, "VERIFY_CHAT")
+	if err != nil {
+		return nil, err
+	}
+	if verifyChat && notifierType != "telegram" {
+		return nil, fmt.Errorf("VERIFY_CHAT requires NOTIFIER=telegram")
+	}
+
+	commandsEnabled, err := parseBool(vars, "COMMANDS_ENABLED")
+	if err != nil {
+		return nil, err
+	}
+	if commandsEnabled && notifierType != "telegram" {
+		return nil, fmt.Errorf("COMMANDS_ENABLED requires NOTIFIER=telegram, commands are read from the Telegram chat")
+	}
+
+	// Threshold commands wait for /confirm from the same sender
+	confirmCommands, err := parseBool(vars, "CONFIRM_COMMANDS")
+	if err != nil {
+		return nil, err
+	}
+	if confirmCommands && !commandsEnabled {
+		return nil, fmt.Errorf("CONFIRM_COMMANDS requires COMMANDS_ENABLED=true")
+	}
+
+	forceHTTP1, err := parseBool(vars, "FORCE_HTTP1")
+	if err != nil {
+		return nil, err
+	}
+
+	checkBudget, err := parseDuration(vars, "CHECK_BUDGET")
+	if err != nil {
+		return nil, err
+	}
+
+	commandTimeout, err := parseDuration(vars, "COMMAND_TIMEOUT")
+	if err != nil {
+		return nil, err
+	}
+	if commandTimeout == 0 {
+		commandTimeout = 20 * time.Second
+	}
+
+	autoDeleteAfter, err := parseDuration(vars, "AUTO_DELETE_AFTER")
+	if err != nil {
+		return nil, err
+	}
+	if autoDeleteAfter > 0 && notifierType != "telegram" {
+		return nil, fmt.Errorf("AUTO_DELETE_AFTER requires NOTIFIER=telegram")
+	}
+	if autoDeleteAfter > 48*time.Hour {
+		// Bots can't delete their messages in groups after 48 hours
+		return nil, fmt.Errorf("AUTO_DELETE_AFTER can be at most 48h, got: %s", vars["AUTO_DELETE_AFTER"])
+	}
+
+	threadAlerts, err := parseBool(vars, "THREAD_ALERTS")
+	if err != nil {
+		return nil, err
+	}
+	if threadAlerts && notifierType != "telegram" {
+		return nil, fmt.Errorf("THREAD_ALERTS requires NOTIFIER=telegram")
+	}
+
+	pinnedForecast, err := parseBool(vars, "PINNED_FORECAST")
+	if err != nil {
+		return nil, err
+	}
+	if pinnedForecast && notifierType != "telegram" {
+		return nil, fmt.Errorf("PINNED_FORECAST requires NOTIFIER=telegram")
+	}
+
+	// Escalation of unacknowledged alerts needs /ack, so it requires commands
+	escalateAfter, err := parseDuration(vars, "ESCALATE_AFTER")
+	if err != nil {
+		return nil, err
+	}
+	if escalateAfter > 0 && !commandsEnabled {
+		return nil, fmt.Errorf("ESCALATE_AFTER requires COMMANDS_ENABLED=true for /ack")
+	}
+
+	firstRunSilent, err := parseBool(vars, "FIRST_RUN_SILENT")
+	if err != nil {
+		return nil, err
+	}
+
+	// Alert on fixed thresholds, or on a drop below the recent average
+	alertMode := strings.ToLower(vars["ALERT_MODE"])
+	if alertMode == "" {
+		alertMode = "absolute"
+	}
+	if alertMode != "absolute" && alertMode != "relative" {
+		return nil, fmt.Errorf("ALERT_MODE must be absolute or relative, got: %s", vars["ALERT_MODE"])
+	}
+	relativeWindow := 12
+	if vars["RELATIVE_WINDOW"] != "" {
+		relativeWindow, err = strconv.Atoi(vars["RELATIVE_WINDOW"])
+		if err != nil {
+			return nil, fmt.Errorf("RELATIVE_WINDOW must be a number: %w", err)
+		}
+		if relativeWindow < 1 || relativeWindow > 500 {
+			return nil, fmt.Errorf("RELATIVE_WINDOW must be between 1 and 500: %d", relativeWindow)
+		}
+	}
+	relativeDropPct := 10.0
+	if vars["RELATIVE_DROP_PCT"] != "" {
+		relativeDropPct, err = strconv.ParseFloat(vars["RELATIVE_DROP_PCT"], 64)
+		if err != nil {
+			return nil, fmt.Errorf("RELATIVE_DROP_PCT must be a number: %w", err)
+		}
+		if relativeDropPct <= 0 || relativeDropPct >= 100 {
+			return nil, fmt.Errorf("RELATIVE_DROP_PCT must be above 0 and below 100: %s", vars["RELATIVE_DROP_PCT"])
+		}
+	}
+
+	// Optionally re-alert within a green streak only on a lower price
+	improvementOnly, err := parseBool(vars, "ALERT_ON_IMPROVEMENT_ONLY")
+	if err != nil {
+		return nil, err
+	}
+	improvementMargin := 0
+	if vars["IMPROVEMENT_MARGIN"] != "" {
+		improvementMargin, err = strconv.Atoi(vars["IMPROVEMENT_MARGIN"])
+		if err != nil {
+			return nil, fmt.Errorf("IMPROVEMENT_MARGIN must be a number: %w", err)
+		}
+		if improvementMargin < 0 {
+			return nil, fmt.Errorf("IMPROVEMENT_MARGIN must not be negative: %d", improvementMargin)
+		}
+	}
+
+	// How many sent alerts /recent remembers
+	recentAlerts := 10
+	if vars["RECENT_ALERTS"] != "" {
+		recentAlerts, err = strconv.Atoi(vars["RECENT_ALERTS"])
+		if err != nil {
+			return nil, fmt.Errorf("RECENT_ALERTS must be a number: %w", err)
+		}
+		if recentAlerts < 1 || recentAlerts > 100 {
+			return nil, fmt.Errorf("RECENT_ALERTS must be between 1 and 100: %d", recentAlerts)
+		}
+	}
+
+	co2AllowZero, err := parseBool(vars, "CO2_ALLOW_ZERO")
+	if err != nil {
+		return nil, err
+	}
+
+	recordLowAlert, err := parseBool(vars, "RECORD_LOW_ALERT")
+	if err != nil {
+		return nil, err
+	}
+
+	showDayOverDay, err := parseBool(vars, "SHOW_DOD")
+	if err != nil {
+		return nil, err
+	}
+
+	// How long slot prices are kept for SHOW_DOD and /export, by default
+	// today and yesterday
+	historyRetention := 24 * time.Hour
+	if vars["HISTORY_RETENTION"] != "" {
+		historyRetention, err = parseDuration(vars, "HISTORY_RETENTION")
+		if err != nil {
+			return nil, err
+		}
+		if historyRetention < 24*time.Hour {
+			return nil, fmt.Errorf("HISTORY_RETENTION must be at least 1d, got: %s", vars["HISTORY_RETENTION"])
+		}
+	}
+
+	showPctBelow, err := parseBool(vars, "SHOW_PCT_BELOW")
+	if err != nil {
+		return nil, err
+	}
+
+	showDataMeta, err := parseBool(vars, "SHOW_DATA_META")
+	if err != nil {
+		return nil, err
+	}
+
+	alertOnForecast, err := parseBool(vars, "ALERT_ON_FORECAST")
+	if err != nil {
+		return nil, err
+	}
+
+	shutdownAlert, err := parseBool(vars, "SHUTDOWN_ALERT")
+	if err != nil {
+		return nil, err
+	}
+
+	protectContent, err := parseBool(vars, "PROTECT_CONTENT")
+	if err != nil {
+		return nil, err
+	}
+
+	combineEitherNew, err := parseBool(vars, "COMBINE_WHEN_EITHER_NEW")
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{
+		TelegramBotToken:   vars["TELEGRAM_BOT_TOKEN"],
+		TelegramChatID:     vars["TELEGRAM_CHAT_ID"],
+		SessionToken:       vars["SESSION_TOKEN"],
+		FuelThreshold:      fuelThreshold,
+		FuelZoneLow:        fuelZoneLow,
+		BuyTiers:           buyTiers,
+		CO2ZoneLow:         co2ZoneLow,
+		CO2Threshold:       co2Threshold,
+		Timezone:           tz,
+		SlotTimezone:       slotTZ,
+		SlotMinutes:        slotMinutes,
+		CheckInterval:      checkInterval,
+		FetchRetries:       fetchRetries,
+		FetchBackoff:       fetchBackoff,
+		RecheckAfter:       recheckAfter,
+		APIMethod:          apiMethod,
+		APIBody:            vars["API_BODY"],
+		APIHeaders:         apiHeaders,
+		UserAgents:         userAgents,
+		Budget:             budget,
+		ProtectContent:     protectContent,
+		SpreadMode:         spreadMode,
+		SpreadMin:          spreadMin,
+		SpreadMax:          spreadMax,
+		CombineEitherNew:   combineEitherNew,
+		CommandsEnabled:    commandsEnabled,
+		CommandTimeout:     commandTimeout,
+		CheckBudget:        checkBudget,
+		ForceHTTP1:         forceHTTP1,
+		StatusFile:         vars["STATUS_FILE"],
+		ReminderSlots:      reminderSlots,
+		ExtraChatIDs:       extraChatIDs,
+		SendConcurrency:    sendConcurrency,
+		TierChats:          tierChats,
+		MinTierImprovement: minTierImprovement,
+		SummaryTime:        summaryTime,
+		MaintenanceNotice:  maintenanceNotice,
+		EmptyNoticeAfter:   emptyNoticeAfter,
+		GameLinkURL:        gameLinkURL,
+		SessionRefreshURL:  vars["SESSION_REFRESH_URL"],
+		SessionRefreshBody: vars["SESSION_REFRESH_BODY"],
+		UpdateCheck:        updateCheck,
+		VerifyTelegram:     verifyTelegram,
+		VerifyInterval:     verifyTelegramInterval,
+		VerifyChat:         verifyChat,
+		EscalateAfter:      escalateAfter,
+		ShowDayOverDay:     showDayOverDay,
+		ShowPctBelow:       showPctBelow,
+		ShowDataMeta:       showDataMeta,
+		ShutdownAlert:      shutdownAlert,
+		AlertOnForecast:    alertOnForecast,
+		FallbackMode:       fallbackMode,
+		UseFirstSlot:       useFirstSlot,
+		TelegramSendFormat: sendFormat,
+		HoldWindow:         holdWindow,
+		HoldMinDrop:        holdMinDrop,
+		RecordLowAlert:     recordLowAlert,
+		FuelVelocity:       fuelVelocity,
+		WaitSpread:         waitSpread,
+		MaxLogBody:         maxLogBody,
+		MaxSendsPerMinute:  maxSendsPerMinute,
+		FuelHours:          fuelHours,
+		MarketHours:        marketHours,
+		CO2Hours:           co2Hours,
+		NotifierType:       notifierType,
+		MatrixHomeserver:   vars["MATRIX_HOMESERVER"],
+		MatrixRoom:         vars["MATRIX_ROOM"],
+		MatrixToken:        vars["MATRIX_TOKEN"],
+		FirstRunSilent:     firstRunSilent,
+		HistoryRetention:   historyRetention,
+		ImprovementOnly:    improvementOnly,
+		AlertMode:          alertMode,
+		RelativeWindow:     relativeWindow,
+		RelativeDropPct:    relativeDropPct,
+		ImprovementMargin:  improvementMargin,
+		RecentAlerts:       recentAlerts,
+		CO2AllowZero:       co2AllowZero,
+		AlertFormula:       alertFormula,
+		PinnedForecast:     pinnedForecast,
+		ThreadAlerts:       threadAlerts,
+		AutoDeleteAfter:    autoDeleteAfter,
+		SpoolDir:           vars["SPOOL_DIR"],
+		FuelMinGap:         fuelMinGap,
+		FuelConfirmSlots:   confirmSlots["FUEL_CONFIRM_SLOTS"],
+		CO2ConfirmSlots:    confirmSlots["CO2_CONFIRM_SLOTS"],
+		CO2MinGap:          co2MinGap,
+		PriceUnit:          priceUnit,
+		ExcludeSlots:       excludeSlots,
+		ConfirmCommands:    confirmCommands,
+		SMTPHost:           vars["SMTP_HOST"],
+		SMTPPort:           smtpPort,
+		SMTPUser:           vars["SMTP_USER"],
+		SMTPPass:           vars["SMTP_PASS"],
+		EmailFrom:          emailFrom,
+		EmailTo:            emailTo,
+		StateBackend:       stateBackend,
+		RedisURL:           vars["REDIS_URL"],
+		RedisKey:           redisKey,
+	}
+	cfg.Notifier = newNotifier(cfg)
+	cfg.StateStore = newStateStore(cfg)
+	cfg.Source = vars // merged settings, for --dump-config
+	return cfg, nil
+}
+
+// readEnvFile parses KEY=VALUE lines from an .env file, skipping blanks and comments
+func readEnvFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open .env: %w", err)
+	}
+	defer f.Close()
+
+	return parseEnv(f)
+}
+
+// parseEnv reads KEY=value lines, skipping blank lines and # comments
+func parseEnv(r io.Reader) (map[string]string, error) {
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		idx := strings.Index(line, "=")
+		if idx < 0 {
+			continue
+		}
+		key := strings.TrimSpace(line[:idx])
+		value := strings.TrimSpace(line[idx+1:])
+		vars[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	return vars, nil
+}
+
+// timezoneAbbreviations maps abbreviations to IANA timezone names.
+// Where abbreviations are ambiguous, one meaning wins (IST is India, CST is
+// US Central, GST is Gulf). Users needing the other meaning should use
+// the full IANA name (e.g. Europe/Dublin, Asia/Shanghai, Atlantic/South_Georgia).
+var timezoneAbbreviations = map[string]string{
+	// Universal
+	"UTC":  "UTC",
+	"GMT":  "Europe/London",
+
+	// Europe
+	"WET":  "Europe/Lisbon",
+	"WEST": "Europe/Lisbon",
+	"CET":  "Europe/Berlin",
+	"CEST": "Europe/Berlin",
+	"MET":  "Europe/Berlin",
+	"MEST": "Europe/Berlin",
+	"EET":  "Europe/Bucharest",
+	"EEST": "Europe/Bucharest",
+	"BST":  "Europe/London",
+	"IST":  "Asia/Kolkata",
+	"MSK":  "Europe/Moscow",
+	"SAMT": "Europe/Samara",
+	"YEKT": "Asia/Yekaterinburg",
+	"GET":  "Asia/Tbilisi",
+	"AZT":  "Asia/Baku",
+	"AMT":  "Asia/Yerevan",
+	"FET":  "Europe/Minsk",
+	"TRT":  "Europe/Istanbul",
+
+	// North America
+	"NST":  "America/St_Johns",
+	"NDT":  "America/St_Johns",
+	"AST":  "America/Halifax",
+	"ADT":  "America/Halifax",
+	"EST":  "America/New_York",
+	"EDT":  "America/New_York",
+	"CST":  "America/Chicago",
+	"CDT":  "America/Chicago",
+	"MST":  "America/Denver",
+	"MDT":  "America/Denver",
+	"PST":  "America/Los_Angeles",
+	"PDT":  "America/Los_Angeles",
+	"AKST": "America/Anchorage",
+	"AKDT": "America/Anchorage",
+	"HST":  "Pacific/Honolulu",
+	"HAST": "Pacific/Honolulu",
+	"HADT": "America/Adak",
+
+	// Central America / Caribbean
+	"CST6": "America/Costa_Rica",
+	"ECT":  "America/Guayaquil",
+	"COT":  "America/Bogota",
+	"VET":  "America/Caracas",
+	"PET":  "America/Lima",
+	"CIDST":"America/Cayman",
+	"CUT":  "America/Havana",
+
+	// South America
+	"BRT":  "America/Sao_Paulo",
+	"BRST": "America/Sao_Paulo",
+	"ART":  "America/Argentina/Buenos_Aires",
+	"CLT":  "America/Santiago",
+	"CLST": "America/Santiago",
+	"UYT":  "America/Montevideo",
+	"PYT":  "America/Asuncion",
+	"PYST": "America/Asuncion",
+	"BOT":  "America/La_Paz",
+	"GFT":  "America/Cayenne",
+	"SRT":  "America/Paramaribo",
+	"GYT":  "America/Guyana",
+	"FKT":  "Atlantic/Stanley",
+
+	// East Asia
+	"JST":  "Asia/Tokyo",
+	"KST":  "Asia/Seoul",
+	"CST8": "Asia/Shanghai",
+	"HKT":  "Asia/Hong_Kong",
+	"TWT":  "Asia/Taipei",
+	"PHT":  "Asia/Manila",
+	"PHST": "Asia/Manila",
+	"MYT":  "Asia/Kuala_Lumpur",
+	"SGT":  "Asia/Singapore",
+	"BNT":  "Asia/Brunei",
+
+	// Southeast Asia
+	"ICT":  "Asia/Bangkok",
+	"WIB":  "Asia/Jakarta",
+	"WITA": "Asia/Makassar",
+	"WIT":  "Asia/Jayapura",
+	"MMT":  "Asia/Yangon",
 
 	// South Asia
 	"PKT":  "Asia/Karachi",
@@ -298,296 +1671,1779 @@ var timezoneAbbreviations = map[string]string{
 	"MVT":  "Indian/Maldives",
 	"LKT":  "Asia/Colombo",
 
-	// Central Asia
-	"ALMT": "Asia/Almaty",
-	"QYZT": "Asia/Qyzylorda",
-	"ORAT": "Asia/Oral",
-	"UZT":  "Asia/Tashkent",
-	"TMT":  "Asia/Ashgabat",
-	"TJT":  "Asia/Dushanbe",
-	"KGT":  "Asia/Bishkek",
+	// Central Asia
+	"ALMT": "Asia/Almaty",
+	"QYZT": "Asia/Qyzylorda",
+	"ORAT": "Asia/Oral",
+	"UZT":  "Asia/Tashkent",
+	"TMT":  "Asia/Ashgabat",
+	"TJT":  "Asia/Dushanbe",
+	"KGT":  "Asia/Bishkek",
+
+	// West / Central Asia
+	"AFT":  "Asia/Kabul",
+	"IRST": "Asia/Tehran",
+	"IRDT": "Asia/Tehran",
+	"GST":  "Asia/Dubai",
+
+	// Middle East
+	"AST3": "Asia/Riyadh",
+	"IDT":  "Asia/Jerusalem",
+
+	// Australia
+	"AEST": "Australia/Sydney",
+	"AEDT": "Australia/Sydney",
+	"ACST": "Australia/Adelaide",
+	"ACDT": "Australia/Adelaide",
+	"AWST": "Australia/Perth",
+	"LHST": "Australia/Lord_Howe",
+	"LHDT": "Australia/Lord_Howe",
+	"NFDT": "Pacific/Norfolk",
+	"CXT":  "Indian/Christmas",
+	"CCT":  "Indian/Cocos",
+
+	// Pacific
+	"NZST":  "Pacific/Auckland",
+	"NZDT":  "Pacific/Auckland",
+	"CHAST": "Pacific/Chatham",
+	"CHADT": "Pacific/Chatham",
+	"FJT":   "Pacific/Fiji",
+	"FJST":  "Pacific/Fiji",
+	"TVT":   "Pacific/Funafuti",
+	"WST":   "Pacific/Apia",
+	"TOT":   "Pacific/Tongatapu",
+	"GILT":  "Pacific/Tarawa",
+	"MHT":   "Pacific/Majuro",
+	"PONT":  "Pacific/Pohnpei",
+	"KOST":  "Pacific/Kosrae",
+	"CHUT":  "Pacific/Chuuk",
+	"VUT":   "Pacific/Efate",
+	"SBT":   "Pacific/Guadalcanal",
+	"NCT":   "Pacific/Noumea",
+	"PGT":   "Pacific/Port_Moresby",
+	"NRT":   "Pacific/Nauru",
+	"SST":   "Pacific/Pago_Pago",
+	"TAHT":  "Pacific/Tahiti",
+	"CKT":   "Pacific/Rarotonga",
+	"NUT":   "Pacific/Niue",
+	"TKT":   "Pacific/Fakaofo",
+	"GALT":  "Pacific/Galapagos",
+	"MART":  "Pacific/Marquesas",
+	"GAMT":  "Pacific/Gambier",
+	"WAKT":  "Pacific/Wake",
+
+	// Africa
+	"CAT":  "Africa/Johannesburg",
+	"SAST": "Africa/Johannesburg",
+	"EAT":  "Africa/Nairobi",
+	"WAT":  "Africa/Lagos",
+	"WAST": "Africa/Windhoek",
+	"MUT":  "Indian/Mauritius",
+	"RET":  "Indian/Reunion",
+	"SCT":  "Indian/Mahe",
+	"CVT":  "Atlantic/Cape_Verde",
+
+	// Atlantic
+	"AZOT":  "Atlantic/Azores",
+	"AZOST": "Atlantic/Azores",
+	"FNT":   "America/Noronha",
+	"PMST":  "America/Miquelon",
+	"PMDT":  "America/Miquelon",
+	"WGT":   "America/Godthab",
+	"WGST":  "America/Godthab",
+	"EGT":   "America/Scoresbysund",
+	"EGST":  "America/Scoresbysund",
+}
+
+// configKeys are the settings read from .env, in the order --dump-config
+// prints them. Only these are taken from the real environment, the rest of it
+// (PATH, HOME, ...) is not config.
+var configKeys = []string{
+	"ALERT_FORMULA", "ALERT_MODE", "ALERT_ON_FORECAST", "ALERT_ON_IMPROVEMENT_ONLY",
+	"API_BODY", "API_HEADERS", "API_METHOD", "AUTO_DELETE_AFTER", "BUDGET", "BUY_ADVICE",
+	"BUY_ADVICE_TIERS", "CHECK_BUDGET", "CHECK_INTERVAL", "CO2_ALLOW_ZERO",
+	"CO2_CONFIRM_SLOTS", "CO2_HOURS", "CO2_MIN_GAP", "CO2_THRESHOLD",
+	"COMBINE_WHEN_EITHER_NEW", "COMMANDS_ENABLED", "COMMAND_TIMEOUT", "CONFIG_URL",
+	"CONFIRM_COMMANDS", "EMAIL_FROM", "EMAIL_TO", "EMPTY_NOTICE_AFTER", "ESCALATE_AFTER",
+	"EXCLUDE_SLOTS", "EXTRA_CHAT_IDS", "FALLBACK_MODE", "FETCH_BACKOFF", "FETCH_RETRIES",
+	"FIRST_RUN_SILENT", "FORCE_HTTP1", "FUEL_CONFIRM_SLOTS", "FUEL_HOURS", "FUEL_MIN_GAP",
+	"FUEL_THRESHOLD", "FUEL_VELOCITY", "GAME_LINK_URL", "HISTORY_RETENTION", "HOLD_MIN_DROP",
+	"HOLD_WINDOW", "IMPROVEMENT_MARGIN", "INCLUDE_GAME_LINK", "MAINTENANCE_NOTICE",
+	"MARKET_HOURS", "MATRIX_HOMESERVER", "MATRIX_ROOM", "MATRIX_TOKEN", "MAX_LOG_BODY",
+	"MAX_SENDS_PER_MINUTE", "MIN_TIER_IMPROVEMENT", "NOTIFIER", "PINNED_FORECAST",
+	"PRICE_UNIT", "PROTECT_CONTENT", "RECENT_ALERTS", "RECHECK_AFTER", "RECORD_LOW_ALERT",
+	"REDIS_KEY", "REDIS_URL", "RELATIVE_DROP_PCT", "RELATIVE_WINDOW", "REMINDER_SLOTS",
+	"SEND_CONCURRENCY", "SESSION_REFRESH_BODY", "SESSION_REFRESH_URL", "SESSION_TOKEN",
+	"SHOW_DATA_META", "SHOW_DOD", "SHOW_PCT_BELOW", "SHUTDOWN_ALERT", "SINK", "SLOT_MINUTES",
+	"SLOT_TIMEZONE", "SMTP_HOST", "SMTP_PASS", "SMTP_PORT", "SMTP_USER", "SPOOL_DIR",
+	"SPREAD_MAX", "SPREAD_MIN", "SPREAD_MODE", "STATE_BACKEND", "STATUS_FILE",
+	"STRICT_TIMEZONE", "SUMMARY_TIME", "TELEGRAM_BOT_TOKEN", "TELEGRAM_CHAT_ID",
+	"TELEGRAM_SEND_FORMAT", "THREAD_ALERTS", "TIER_CHATS", "TIMEZONE", "UPDATE_CHECK",
+	"USER_AGENT_POOL", "USER_AGENT_ROTATE", "USE_FIRST_SLOT", "VERIFY_CHAT", "VERIFY_TELEGRAM",
+	"VERIFY_TELEGRAM_INTERVAL", "WAIT_SPREAD",
+}
+
+// environmentVars returns the config settings, including the KEY_FILE
+// variants of secrets, that are set as real environment variables
+func environmentVars() map[string]string {
+	env := make(map[string]string)
+	for _, key := range configKeys {
+		if value, ok := os.LookupEnv(key); ok {
+			env[key] = value
+		}
+	}
+	for _, key := range secretFileKeys {
+		if value, ok := os.LookupEnv(key + "_FILE"); ok {
+			env[key+"_FILE"] = value
+		}
+	}
+	return env
+}
+
+// secretFileKeys are the settings that can also be read from a file via KEY_FILE
+var secretFileKeys = []string{"TELEGRAM_BOT_TOKEN", "SESSION_TOKEN", "MATRIX_TOKEN", "SMTP_PASS"}
+
+// loadSecretFiles reads secrets from KEY_FILE paths (the Docker secrets convention).
+// A file value takes precedence over the inline value.
+func loadSecretFiles(vars map[string]string) error {
+	for _, key := range secretFileKeys {
+		path := vars[key+"_FILE"]
+		if path == "" {
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s_FILE: %w", key, err)
+		}
+		value := strings.TrimSpace(string(data))
+		if value == "" {
+			return fmt.Errorf("%s_FILE is empty: %s", key, path)
+		}
+
+		vars[key] = value
+		log.Printf("Loaded %s from %s", key, path)
+	}
+	return nil
+}
+
+// cleanToken strips surrounding whitespace (including CR and LF), byte order
+// marks and zero-width characters from a pasted token
+func cleanToken(s string) string {
+	return strings.TrimFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '\ufeff' || r == '\u200b' || r == '\u200c' || r == '\u200d'
+	})
+}
+
+// ensureTimezones replaces nil timezones with UTC, since every .In() call
+// on a nil *time.Location would panic
+func ensureTimezones(cfg *Config) {
+	if cfg.Timezone == nil {
+		log.Println("WARNING: Display timezone not set, using UTC")
+		cfg.Timezone = time.UTC
+	}
+	if cfg.SlotTimezone == nil {
+		log.Println("WARNING: Slot timezone not set, using UTC")
+		cfg.SlotTimezone = time.UTC
+	}
+}
+
+// parseAPIHeaders parses the optional API_HEADERS JSON object of extra request headers
+func parseAPIHeaders(raw string) (map[string]string, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	var parsed map[string]string
+	if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
+		return nil, fmt.Errorf("API_HEADERS must be a JSON object of strings: %w", err)
+	}
+
+	headers := make(map[string]string, len(parsed))
+	for key, value := range parsed {
+		key = http.CanonicalHeaderKey(strings.TrimSpace(key))
+		if key == "" {
+			return nil, fmt.Errorf("API_HEADERS contains an empty header name")
+		}
+		headers[key] = value
+
+		if _, ok := defaultAPIHeaders[key]; ok || key == "Cookie" || key == "Content-Type" {
+			log.Printf("API_HEADERS overrides default header: %s", key)
+		} else {
+			log.Printf("API_HEADERS adds header: %s", key)
+		}
+	}
+
+	return headers, nil
+}
+
+// parseSlotList reads an optional comma-separated list of HH:MM slot times
+func parseSlotList(vars map[string]string, key string) ([]string, error) {
+	if vars[key] == "" {
+		return nil, nil
+	}
+
+	var slots []string
+	for _, part := range strings.Split(vars[key], ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		t, err := time.Parse("15:04", part)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a comma-separated list of HH:MM times, got: %s", key, part)
+		}
+		slots = append(slots, t.Format("15:04"))
+	}
+	return slots, nil
+}
+
+// hoursWindow is a daily time range in minutes since midnight, wrapping past
+// midnight when end is before start (22:00-06:00)
+type hoursWindow struct {
+	start int
+	end   int
+}
+
+// contains reports whether t's time of day is inside the window, end exclusive
+func (w *hoursWindow) contains(t time.Time) bool {
+	if w == nil {
+		return true
+	}
+	m := t.Hour()*60 + t.Minute()
+	if w.start <= w.end {
+		return m >= w.start && m < w.end
+	}
+	return m >= w.start || m < w.end
+}
+
+// parseHoursWindow reads an optional HH:MM-HH:MM range, nil when empty
+func parseHoursWindow(vars map[string]string, key string) (*hoursWindow, error) {
+	if vars[key] == "" {
+		return nil, nil
+	}
+
+	from, to, ok := strings.Cut(vars[key], "-")
+	start, err1 := parseClockMinutes(strings.TrimSpace(from))
+	end, err2 := parseClockMinutes(strings.TrimSpace(to))
+	if !ok || err1 != nil || err2 != nil {
+		return nil, fmt.Errorf("%s must be a HH:MM-HH:MM range, got: %s", key, vars[key])
+	}
+	if start == end {
+		return nil, fmt.Errorf("%s must not start and end at the same time: %s", key, vars[key])
+	}
+	if start == 0 && end == 24*60 {
+		// The whole day, same as no window
+		return nil, nil
+	}
+
+	return &hoursWindow{start: start, end: end}, nil
+}
+
+// parseClockMinutes reads HH:MM as minutes since midnight, accepting 24:00 as
+// the end of the day
+func parseClockMinutes(s string) (int, error) {
+	if s == "24:00" {
+		return 24 * 60, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// parseThreshold reads a threshold as a single price or a "LOW-HIGH" buy zone
+// and returns the zone bottom (0 without a range) and the alert ceiling
+func parseThreshold(vars map[string]string, key string) (int, int, error) {
+	lowText, highText, isRange := strings.Cut(vars[key], "-")
+	if !isRange {
+		high, err := strconv.Atoi(vars[key])
+		if err != nil {
+			return 0, 0, fmt.Errorf("%s must be a number: %w", key, err)
+		}
+		return 0, high, nil
+	}
+
+	low, err := strconv.Atoi(strings.TrimSpace(lowText))
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s must be a number or a range like 380-420: %w", key, err)
+	}
+	high, err := strconv.Atoi(strings.TrimSpace(highText))
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s must be a number or a range like 380-420: %w", key, err)
+	}
+	if low <= 0 || low >= high {
+		return 0, 0, fmt.Errorf("%s range must be LOW-HIGH with 0 < LOW < HIGH, got: %s", key, vars[key])
+	}
+	return low, high, nil
+}
+
+// parseOptionalFloat reads an optional decimal .env value, nil when empty
+func parseOptionalFloat(vars map[string]string, key string) (*float64, error) {
+	if vars[key] == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(vars[key], 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a number: %w", key, err)
+	}
+	return &f, nil
+}
+
+// parseDuration reads an optional Go duration .env value (e.g. "10m"), or a
+// number of days like "30d", zero when empty
+func parseDuration(vars map[string]string, key string) (time.Duration, error) {
+	if vars[key] == "" {
+		return 0, nil
+	}
+	var d time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(vars[key], "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(vars[key])
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a duration like 10m, 2h or 30d: %w", key, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("%s must not be negative: %s", key, vars[key])
+	}
+	return d, nil
+}
+
+// parseBool reads an optional true/false .env value, empty means false
+func parseBool(vars map[string]string, key string) (bool, error) {
+	if vars[key] == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(vars[key])
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false: %w", key, err)
+	}
+	return b, nil
+}
+
+// loadTimezone resolves a timezone config value, using fallback when it is empty.
+// Unknown timezones are a config error in strict mode, otherwise they log a
+// warning and use fallback.
+func loadTimezone(key, input string, fallback *time.Location, strict bool) (*time.Location, error) {
+	if input == "" {
+		return fallback, nil
+	}
+
+	loc, err := resolveTimezone(input)
+	if err == nil {
+		return loc, nil
+	}
+
+	if strict {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+
+	log.Printf("WARNING: %s: %s, falling back to %s", key, err, fallback)
+	return fallback, nil
+}
+
+// resolveTimezone resolves a timezone string (abbreviation or IANA name) to a *time.Location.
+// Returns local timezone if input is empty.
+func resolveTimezone(input string) (*time.Location, error) {
+	if input == "" {
+		return time.Now().Location(), nil
+	}
+
+	upper := strings.ToUpper(input)
+	if iana, ok := timezoneAbbreviations[upper]; ok {
+		loc, err := time.LoadLocation(iana)
+		if err == nil {
+			return loc, nil
+		}
+		return nil, fmt.Errorf("timezone '%s' maps to %s, which could not be loaded (missing tzdata?): %w", input, iana, err)
+	}
+
+	loc, err := time.LoadLocation(input)
+	if err == nil {
+		return loc, nil
+	}
+
+	if suggestions := suggestTimezones(upper); len(suggestions) > 0 {
+		return nil, fmt.Errorf("unknown timezone '%s' (did you mean %s? a full IANA name like Europe/Berlin also works)",
+			input, strings.Join(suggestions, ", "))
+	}
+	return nil, fmt.Errorf("unknown timezone '%s' (use a supported abbreviation like CET or a full IANA name like Europe/Berlin)", input)
+}
+
+// suggestTimezones returns up to 3 known abbreviations within one edit of input
+func suggestTimezones(input string) []string {
+	var matches []string
+	for abbr := range timezoneAbbreviations {
+		if editDistance(input, abbr) <= 1 {
+			matches = append(matches, abbr)
+		}
+	}
+	sort.Strings(matches)
+	if len(matches) > 3 {
+		matches = matches[:3]
+	}
+	return matches
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+// findEnvFile looks for .env in executable dir first, then working dir
+func findEnvFile() string {
+	// Try executable directory first
+	exe, err := os.Executable()
+	if err == nil {
+		p := filepath.Join(filepath.Dir(exe), ".env")
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+
+	// Try working directory
+	p := ".env"
+	if _, err := os.Stat(p); err == nil {
+		return p
+	}
+
+	return ""
+}
+
+// logShutdownSummary logs what happened since startup: uptime, checks, alerts
+// and errors of this run, and the last prices seen
+func logShutdownSummary(cd *cooldown, started time.Time, start checkStats) {
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+
+	// /reset stats during the run restarts the counters from zero
+	since := func(now, then int) int {
+		if now < then {
+			return now
+		}
+		return now - then
+	}
+
+	prices := "none"
+	if cd.lastPrices != nil {
+		prices = fmt.Sprintf("fuel $%d/t, CO2 $%d/t (slot %s, day %d)",
+			cd.lastPrices.FuelPrice, cd.lastPrices.CO2Price, cd.lastPrices.Time, cd.lastPrices.Day)
+	}
+	log.Printf("Session summary - uptime: %s, checks: %d, fuel alerts: %d, CO2 alerts: %d, fetch errors: %d, send errors: %d, last prices: %s",
+		formatDuration(time.Since(started).Truncate(time.Second)),
+		since(cd.stats.TotalChecks, start.TotalChecks),
+		since(cd.stats.FuelAlerts, start.FuelAlerts),
+		since(cd.stats.CO2Alerts, start.CO2Alerts),
+		since(cd.stats.FetchErrors, start.FetchErrors),
+		since(cd.stats.SendErrors, start.SendErrors),
+		prices)
+}
+
+// shutdownAlertTimeout bounds the SHUTDOWN_ALERT send, so a slow Telegram
+// doesn't hold up a service manager waiting for the bot to exit
+const shutdownAlertTimeout = 5 * time.Second
+
+// sendShutdownAlert announces a graceful shutdown with SHUTDOWN_ALERT
+func sendShutdownAlert(client *http.Client, cfg *Config, sig os.Signal) {
+	if !cfg.ShutdownAlert {
+		return
+	}
+
+	quick := *client
+	quick.Timeout = shutdownAlertTimeout
+	message := fmt.Sprintf("*Bot stopping*\n\nThe price alert bot received %s and is shutting down. No alerts are sent until it is started again.", sig)
+	if err := notifyWith(&quick, cfg, message, sendOptions{Silent: true, SkipThrottle: true}); err != nil {
+		log.Printf("ERROR sending shutdown alert: %s", err)
+	}
+}
+
+// resetDedupOnThresholdChange clears a type's dedup slot when it was recorded
+// under a different threshold, so a price that only qualifies under the new
+// threshold is not suppressed for the rest of the slot
+func resetDedupOnThresholdChange(cfg *Config, cd *cooldown) {
+	if cd.lastFuelSlot != "" && cd.lastFuelThreshold != 0 && cd.lastFuelThreshold != cfg.FuelThreshold {
+		log.Printf("FUEL_THRESHOLD changed from $%d/t to $%d/t, fuel cooldown reset", cd.lastFuelThreshold, cfg.FuelThreshold)
+		cd.lastFuelSlot = ""
+		cd.lastFuelThreshold = 0
+	}
+	if cd.lastCO2Slot != "" && cd.lastCO2Threshold != 0 && cd.lastCO2Threshold != cfg.CO2Threshold {
+		log.Printf("CO2_THRESHOLD changed from $%d/t to $%d/t, CO2 cooldown reset", cd.lastCO2Threshold, cfg.CO2Threshold)
+		cd.lastCO2Slot = ""
+		cd.lastCO2Threshold = 0
+	}
+}
+
+// runScheduledCheck runs the price check surrounded by the periodic background tasks
+func runScheduledCheck(client *http.Client, cfg *Config, cd *cooldown) {
+	verifyTelegram(client, cfg, cd)
+	checkPrices(client, cfg, cd)
+	checkDailySummary(client, cfg, cd)
+	checkForUpdate(client, cfg, cd)
+}
+
+// scheduleRecheck returns a channel firing RECHECK_AFTER from now, or nil
+// (never firing) when re-checks are off
+func scheduleRecheck(cfg *Config) <-chan time.Time {
+	if cfg.RecheckAfter <= 0 {
+		return nil
+	}
+	return time.After(cfg.RecheckAfter)
+}
+
+// slotTime returns the "HH:MM" start of the price slot containing t
+func slotTime(t time.Time, slotMinutes int) string {
+	return fmt.Sprintf("%02d:%02d", t.Hour(), t.Minute()/slotMinutes*slotMinutes)
+}
+
+// nextCheckTime returns the first time after now that is one minute past a
+// multiple of intervalMinutes within the hour
+func nextCheckTime(now time.Time, intervalMinutes int) time.Time {
+	slotStart := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(),
+		now.Minute()/intervalMinutes*intervalMinutes, 0, 0, now.Location())
+	next := slotStart.Add(time.Minute)
+	for !next.After(now) {
+		next = next.Add(time.Duration(intervalMinutes) * time.Minute)
+	}
+	return next
+}
+
+// timeNow is the clock checkPrices reads, replaced in tests
+var timeNow = time.Now
+
+// checkPrices fetches current prices and sends alerts if below threshold
+func checkPrices(client *http.Client, cfg *Config, cd *cooldown) {
+	now := timeNow().In(cfg.SlotTimezone)
+	if !cfg.MarketHours.contains(now) {
+		log.Printf("Outside MARKET_HOURS at %s (%s), skipping check", now.Format("15:04"), cfg.SlotTimezone)
+		return
+	}
+	log.Printf("Checking prices at %s (%s)...",
+		now.In(cfg.Timezone).Format("15:04:05"), cfg.Timezone)
+
+	// Skip rather than queue up when the previous check is still running
+	if !cd.checking.CompareAndSwap(false, true) {
+		log.Println("WARNING: Previous price check still running, skipping this one")
+		return
+	}
+	defer cd.checking.Store(false)
+
+	// Fetch without the state lock so retries and their backoff don't hold up
+	// commands, on a copy of the config a session refresh can't change mid-request
+	fetchCfg := sessionConfig(cfg, cd)
+
+	// All requests of this check, fetch retries and sends, share CHECK_BUDGET
+	client, ctx, cancel := withCheckBudget(client, fetchCfg)
+	defer cancel()
+
+	prices, err := fetchPrices(ctx, client, fetchCfg)
+	if errors.Is(err, errSessionExpired) && fetchCfg.SessionRefreshURL != "" {
+		log.Printf("Session rejected (%s), trying to refresh it...", err)
+		cd.mu.Lock()
+		refreshErr := refreshSession(client, cfg, cd)
+		cd.mu.Unlock()
+		if refreshErr != nil {
+			log.Printf("ERROR refreshing session: %s", refreshErr)
+		} else {
+			prices, err = fetchPrices(ctx, client, sessionConfig(cfg, cd))
+		}
+	}
+
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+	refreshSharedState(cd)
+
+	// Always persist counters, even when the check fails
+	cd.stats.TotalChecks++
+	defer saveCooldown(cd)
+
+	healthy := false
+	defer func() { writeStatusFile(cfg, cd, healthy) }()
+
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		log.Printf("WARNING: CHECK_BUDGET of %s used up while fetching prices, abandoning this check", formatDuration(cfg.CheckBudget))
+		cd.stats.FetchErrors++
+		cd.recordError(err)
+		return
+	}
+	if errors.Is(err, errSessionExpired) {
+		log.Println("WARNING: Session token rejected, log in again and update SESSION_TOKEN in .env")
+	}
+	if errors.Is(err, errMaintenance) {
+		enterMaintenance(client, cfg, cd)
+		return
+	}
+	if err != nil {
+		log.Printf("ERROR fetching prices: %s", err)
+		cd.stats.FetchErrors++
+		cd.recordError(err)
+		return
+	}
+
+	if cd.maintenance {
+		log.Println("Game maintenance is over, resuming alerts")
+		cd.maintenance = false
+	}
+
+	if len(prices) == 0 {
+		log.Println("WARNING: API returned empty price list")
+		recordEmptyPrices(client, cfg, cd)
+		return
+	}
+	if cd.emptyStreak > 0 {
+		if cfg.EmptyNoticeAfter > 0 && cd.emptyStreak >= cfg.EmptyNoticeAfter {
+			log.Printf("Price feed is back after %d empty responses", cd.emptyStreak)
+		}
+		cd.emptyStreak = 0
+	}
+
+	// Find current time slot
+	currentSlot := slotTime(now, cfg.SlotMinutes)
+
+	matched := matchSlot(prices, currentSlot)
+	if cfg.UseFirstSlot {
+		matched = &prices[0]
+	}
+	if matched == nil {
+		log.Printf("WARNING: No price found for time slot %s (fallback: %s)", currentSlot, cfg.FallbackMode)
+		matched = fallbackSlot(prices, now, cfg.FallbackMode)
+		if matched == nil {
+			log.Println("Skipping alerts for this check")
+			return
+		}
+		log.Printf("Using slot: %s (day %d)", matched.Time, matched.Day)
+	}
+
+	log.Printf("Current prices - Fuel: $%d/t, CO2: $%d/t (slot: %s, day: %d)",
+		matched.FuelPrice, matched.CO2Price, matched.Time, matched.Day)
+
+	current := *matched
+	cd.lastPrices = &current
+	cd.lastForecast = prices
+	cd.lastFetched = time.Now()
+	healthy = true
+	if cfg.ShowDayOverDay || cfg.CommandsEnabled {
+		recordSlotPrice(cd, now, matched, cfg.HistoryRetention)
+	}
+	if cfg.SummaryTime != "" {
+		recordDailyLow(cfg, cd, now, matched)
+	}
+	if cfg.PinnedForecast {
+		updatePinnedForecast(client, cfg, cd, prices, matched, now)
+	}
+	if !cd.thresholdsChecked {
+		warnHighThresholds(cfg, matched)
+		cd.thresholdsChecked = true
+	}
+
+	// Check thresholds
+	expireWatches(cfg, cd, now)
+	fuelThreshold, co2Threshold := effectiveThresholds(cfg, cd, now)
+	fuelGreen := matched.FuelPrice > 0 && matched.FuelPrice <= fuelThreshold
+	co2Green := co2Valid(cfg, matched) && matched.CO2Price <= co2Threshold
+
+	// No successful check recorded yet means a fresh start without state
+	firstRun := cd.lastCheck.IsZero()
+
+	// Price slot key used for dedup (slot = time + day)
+	slotKey := fmt.Sprintf("%s-d%d", matched.Time, matched.Day)
+	if cfg.AlertMode == "relative" {
+		fuelGreen, co2Green = relativeGreen(cfg, cd, slotKey, matched)
+	}
+	cd.fuelStreak.update(slotKey, fuelGreen)
+	cd.co2Streak.update(slotKey, co2Green)
+	if !fuelGreen {
+		cd.lastFuelAlertPrice = 0
+	}
+	if !co2Green {
+		cd.lastCO2AlertPrice = 0
+	}
+
+	// Record successful check timestamp
+	cd.lastCheck = timeNow()
+
+	// Establish a baseline on the first check instead of alerting on it
+	if firstRun && cfg.FirstRunSilent {
+		if fuelGreen {
+			cd.lastFuelSlot = slotKey
+			cd.lastFuelThreshold = cfg.FuelThreshold
+		}
+		if co2Green {
+			cd.lastCO2Slot = slotKey
+			cd.lastCO2Threshold = cfg.CO2Threshold
+		}
+		log.Printf("First run, recorded slot %s without sending alerts (FIRST_RUN_SILENT)", slotKey)
+		return
+	}
+
+	// Blocklisted slots are still fetched and recorded, just never alerted on
+	if slices.Contains(cfg.ExcludeSlots, matched.Time) {
+		log.Printf("Slot %s is in EXCLUDE_SLOTS, not alerting", matched.Time)
+		return
+	}
+
+	// Alerts independent of the thresholds
+	checkSpread(client, cfg, cd, matched, slotKey)
+	checkFormula(client, cfg, cd, matched, slotKey)
+	checkReminder(client, cfg, cd, matched, now, currentSlot)
+	checkRecordLow(client, cfg, cd, matched)
+	checkVelocity(client, cfg, cd, matched, slotKey)
+	checkWaitSpread(client, cfg, cd, prices, matched)
+	checkForecastAlert(client, cfg, cd, prices, matched, fuelThreshold, co2Threshold)
+
+	if !fuelGreen && !co2Green {
+		log.Println("Prices above threshold, no alert needed")
+		return
+	}
+
+	// Per-type alert hours, prices are still recorded above
+	localNow := now.In(cfg.Timezone)
+	if fuelGreen && !cfg.FuelHours.contains(localNow) {
+		log.Println("Fuel price is green but outside FUEL_HOURS, not alerting")
+		fuelGreen = false
+	}
+	if co2Green && !cfg.CO2Hours.contains(localNow) {
+		log.Println("CO2 price is green but outside CO2_HOURS, not alerting")
+		co2Green = false
+	}
+	if !fuelGreen && !co2Green {
+		return
+	}
+
+	// Wait until a green price has held for the required number of slots
+	if fuelGreen && cd.fuelStreak.Count < cfg.FuelConfirmSlots {
+		log.Printf("Fuel price is green for %d of %d slots, waiting for confirmation (FUEL_CONFIRM_SLOTS)", cd.fuelStreak.Count, cfg.FuelConfirmSlots)
+		fuelGreen = false
+	}
+	if co2Green && cd.co2Streak.Count < cfg.CO2ConfirmSlots {
+		log.Printf("CO2 price is green for %d of %d slots, waiting for confirmation (CO2_CONFIRM_SLOTS)", cd.co2Streak.Count, cfg.CO2ConfirmSlots)
+		co2Green = false
+	}
+	if !fuelGreen && !co2Green {
+		return
+	}
+
+	// Check if already alerted for this price slot
+	canAlertFuel := fuelGreen && cd.lastFuelSlot != slotKey
+	canAlertCO2 := co2Green && cd.lastCO2Slot != slotKey
+
+	if !canAlertFuel && !canAlertCO2 {
+		log.Printf("Prices are green but already alerted for slot %s", slotKey)
+		return
+	}
+
+	// Minimum time between alerts of the same type, across slots
+	if canAlertFuel && withinGap(cd.lastFuelSent, cfg.FuelMinGap) {
+		log.Printf("Fuel price is green but last fuel alert was less than %s ago (FUEL_MIN_GAP)", formatDuration(cfg.FuelMinGap))
+		canAlertFuel = false
+	}
+	if canAlertCO2 && withinGap(cd.lastCO2Sent, cfg.CO2MinGap) {
+		log.Printf("CO2 price is green but last CO2 alert was less than %s ago (CO2_MIN_GAP)", formatDuration(cfg.CO2MinGap))
+		canAlertCO2 = false
+	}
+	if !canAlertFuel && !canAlertCO2 {
+		return
+	}
+
+	// Within a green streak, only a price better than the last alert is new
+	if cfg.ImprovementOnly {
+		if canAlertFuel && !improved(matched.FuelPrice, cd.lastFuelAlertPrice, cfg.ImprovementMargin) {
+			log.Printf("Fuel price $%d/t is not below the last alert at $%d/t (ALERT_ON_IMPROVEMENT_ONLY)", matched.FuelPrice, cd.lastFuelAlertPrice)
+			canAlertFuel = false
+		}
+		if canAlertCO2 && !improved(matched.CO2Price, cd.lastCO2AlertPrice, cfg.ImprovementMargin) {
+			log.Printf("CO2 price $%d/t is not below the last alert at $%d/t (ALERT_ON_IMPROVEMENT_ONLY)", matched.CO2Price, cd.lastCO2AlertPrice)
+			canAlertCO2 = false
+		}
+		if !canAlertFuel && !canAlertCO2 {
+			return
+		}
+	}
+
+	// Skip this alert after /snooze, marking the slot so it is not sent later
+	if cd.snoozeRemaining > 0 {
+		cd.snoozeRemaining--
+		if canAlertFuel {
+			cd.lastFuelSlot = slotKey
+			cd.lastFuelThreshold = cfg.FuelThreshold
+		}
+		if canAlertCO2 {
+			cd.lastCO2Slot = slotKey
+			cd.lastCO2Threshold = cfg.CO2Threshold
+		}
+		log.Printf("Alert for slot %s snoozed, %d more to skip", slotKey, cd.snoozeRemaining)
+		return
+	}
+
+	// Another instance sharing the state may have alerted this slot meanwhile
+	canAlertFuel, canAlertCO2, releaseClaims := claimAlerts(cfg, cd, slotKey, canAlertFuel, canAlertCO2)
+	if !canAlertFuel && !canAlertCO2 {
+		return
+	}
 
-	// West / Central Asia
-	"AFT":  "Asia/Kabul",
-	"IRST": "Asia/Tehran",
-	"IRDT": "Asia/Tehran",
-	"GST":  "Asia/Dubai",
+	// Decide which prices the message shows. When both are green, optionally show
+	// both even if only one is new, dedup below still only marks the new one.
+	showFuel, showCO2 := canAlertFuel, canAlertCO2
+	if cfg.CombineEitherNew && fuelGreen && co2Green {
+		showFuel, showCO2 = true, true
+	}
 
-	// Middle East
-	"AST3": "Asia/Riyadh",
-	"IDT":  "Asia/Jerusalem",
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		log.Printf("WARNING: CHECK_BUDGET of %s used up, abandoning this check before sending the alert", formatDuration(cfg.CheckBudget))
+		releaseClaims()
+		return
+	}
 
-	// Australia
-	"AEST": "Australia/Sydney",
-	"AEDT": "Australia/Sydney",
-	"ACST": "Australia/Adelaide",
-	"ACDT": "Australia/Adelaide",
-	"AWST": "Australia/Perth",
-	"LHST": "Australia/Lord_Howe",
-	"LHDT": "Australia/Lord_Howe",
-	"NFDT": "Pacific/Norfolk",
-	"CXT":  "Indian/Christmas",
-	"CCT":  "Indian/Cocos",
+	message := alertMessage(cfg, cd, now, matched, showFuel, showCO2)
+
+	// Send the alert. With escalation on, the first alert is silent and a
+	// loud re-send follows unless it is acknowledged with /ack in time.
+	opts := sendOptions{Silent: cfg.EscalateAfter > 0}
+
+	// The sent message is kept for THREAD_ALERTS and AUTO_DELETE_AFTER, the
+	// alert is threaded under the previous one of the same type
+	var sent sentMessage
+	opts.Sent = &sent
+	if cfg.ThreadAlerts {
+		if canAlertFuel {
+			opts.ReplyTo = cd.lastFuelMessageID
+		} else {
+			opts.ReplyTo = cd.lastCO2MessageID
+		}
+	}
+	err = notifyWith(client, cfg, message, opts)
+	if err != nil {
+		log.Printf("ERROR sending price alert: %s", err)
+		cd.stats.SendErrors++
+		cd.recordError(err)
+		releaseClaims()
+		return
+	}
+	// The alert counts as sent once TELEGRAM_CHAT_ID has it, failed extra
+	// chats are logged but don't make the slot alert again
+	discount := alertDiscount(cfg, matched, showFuel, showCO2)
+	tier := selectTier(cfg, cd.lastTier, discount, matched, showFuel, showCO2)
+	if tier != nil {
+		log.Printf("Alert is %.0f%% below threshold, also sending to the %g%% tier chats", discount, tier.MinDiscount)
+	}
+	if err := sendToChats(client, cfg, alertChatIDs(cfg, tier), message, opts); err != nil {
+		log.Printf("ERROR sending Telegram alert to EXTRA_CHAT_IDS or TIER_CHATS: %s", err)
+		cd.stats.SendErrors++
+		cd.recordError(err)
+	}
+	if len(cfg.TierChats) > 0 {
+		cd.lastTier = nextTierAlert(cd.lastTier, tier, matched, showFuel, showCO2)
+	}
 
-	// Pacific
-	"NZST":  "Pacific/Auckland",
-	"NZDT":  "Pacific/Auckland",
-	"CHAST": "Pacific/Chatham",
-	"CHADT": "Pacific/Chatham",
-	"FJT":   "Pacific/Fiji",
-	"FJST":  "Pacific/Fiji",
-	"TVT":   "Pacific/Funafuti",
-	"WST":   "Pacific/Apia",
-	"TOT":   "Pacific/Tongatapu",
-	"GILT":  "Pacific/Tarawa",
-	"MHT":   "Pacific/Majuro",
-	"PONT":  "Pacific/Pohnpei",
-	"KOST":  "Pacific/Kosrae",
-	"CHUT":  "Pacific/Chuuk",
-	"VUT":   "Pacific/Efate",
-	"SBT":   "Pacific/Guadalcanal",
-	"NCT":   "Pacific/Noumea",
-	"PGT":   "Pacific/Port_Moresby",
-	"NRT":   "Pacific/Nauru",
-	"SST":   "Pacific/Pago_Pago",
-	"TAHT":  "Pacific/Tahiti",
-	"CKT":   "Pacific/Rarotonga",
-	"NUT":   "Pacific/Niue",
-	"TKT":   "Pacific/Fakaofo",
-	"GALT":  "Pacific/Galapagos",
-	"MART":  "Pacific/Marquesas",
-	"GAMT":  "Pacific/Gambier",
-	"WAKT":  "Pacific/Wake",
+	// Mark slot as alerted
+	if canAlertFuel {
+		cd.lastFuelSlot = slotKey
+		cd.lastFuelThreshold = cfg.FuelThreshold
+		cd.lastFuelSent = timeNow()
+		cd.lastFuelAlertPrice = matched.FuelPrice
+		recordSentAlert(cfg, cd, "fuel", matched.FuelPrice, slotKey, cd.lastFuelSent)
+		if cfg.ThreadAlerts && sent.MessageID != 0 {
+			cd.lastFuelMessageID = sent.MessageID
+		}
+		cd.stats.FuelAlerts++
+		log.Printf("Fuel alert sent ($%d/t <= $%d/t threshold, slot %s)", matched.FuelPrice, fuelThreshold, slotKey)
+	}
+	if canAlertCO2 {
+		cd.lastCO2Slot = slotKey
+		cd.lastCO2Threshold = cfg.CO2Threshold
+		cd.lastCO2Sent = timeNow()
+		cd.lastCO2AlertPrice = matched.CO2Price
+		recordSentAlert(cfg, cd, "co2", matched.CO2Price, slotKey, cd.lastCO2Sent)
+		if cfg.ThreadAlerts && sent.MessageID != 0 {
+			cd.lastCO2MessageID = sent.MessageID
+		}
+		cd.stats.CO2Alerts++
+		log.Printf("CO2 alert sent ($%d/t <= $%d/t threshold, slot %s)", matched.CO2Price, co2Threshold, slotKey)
+	}
 
-	// Africa
-	"CAT":  "Africa/Johannesburg",
-	"SAST": "Africa/Johannesburg",
-	"EAT":  "Africa/Nairobi",
-	"WAT":  "Africa/Lagos",
-	"WAST": "Africa/Windhoek",
-	"MUT":  "Indian/Mauritius",
-	"RET":  "Indian/Reunion",
-	"SCT":  "Indian/Mahe",
-	"CVT":  "Atlantic/Cape_Verde",
+	if cfg.AutoDeleteAfter > 0 && sent.MessageID != 0 {
+		scheduleDelete(cfg, cd, &sent)
+	}
+	if cfg.EscalateAfter > 0 {
+		startEscalation(cfg, cd, message)
+	}
+}
 
-	// Atlantic
-	"AZOT":  "Atlantic/Azores",
-	"AZOST": "Atlantic/Azores",
-	"FNT":   "America/Noronha",
-	"PMST":  "America/Miquelon",
-	"PMDT":  "America/Miquelon",
-	"WGT":   "America/Godthab",
-	"WGST":  "America/Godthab",
-	"EGT":   "America/Scoresbysund",
-	"EGST":  "America/Scoresbysund",
+// greenStreak counts consecutive slots with a price at or below threshold
+type greenStreak struct {
+	Slot  string `json:"slot,omitempty"`
+	Count int    `json:"count,omitempty"`
+}
+
+// update counts slotKey once when green and resets the streak otherwise
+func (s *greenStreak) update(slotKey string, green bool) {
+	if !green {
+		*s = greenStreak{}
+		return
+	}
+	if s.Slot != slotKey {
+		s.Slot = slotKey
+		s.Count++
+	}
+}
+
+// improved reports whether price beats the last alerted price by more than
+// margin, always true without an alert earlier in the streak
+func improved(price, last, margin int) bool {
+	return last == 0 || price < last-margin
+}
+
+// withinGap reports whether last is less than gap ago, always false when gap is 0
+func withinGap(last time.Time, gap time.Duration) bool {
+	return gap > 0 && !last.IsZero() && timeNow().Sub(last) < gap
+}
+
+// alertMessage renders the full price alert as sent by checkPrices, including
+// the optional notes, the game link and the /ack prompt
+func alertMessage(cfg *Config, cd *cooldown, now time.Time, slot *PriceSlot, fuel, co2 bool) string {
+	message := buildMessage(*slot, cfg, fuel, co2)
+	if cfg.ShowDayOverDay {
+		message += dayOverDayNote(cfg, cd, now, slot, fuel, co2)
+	}
+	message += buyZoneNote(cfg, slot, fuel, co2)
+	message += holdNote(cfg, cd.lastForecast, slot, fuel, co2)
+	if cfg.AlertMode == "relative" {
+		message += relativeNote(cfg, cd, slot, fuel, co2)
+	}
+	if cfg.ShowDataMeta {
+		message += dataMetaNote(cfg, cd.lastFetched, slot)
+	}
+	message += gameLink(cfg)
+	if cfg.EscalateAfter > 0 {
+		message += fmt.Sprintf("\n\nReply /ack within %s to acknowledge.", formatDuration(cfg.EscalateAfter))
+	}
+	return message
+}
+
+// buildMessage renders the alert text for the given price types (matching the
+// existing Node.js format), followed by the affordability and buy advice notes
+func buildMessage(slot PriceSlot, cfg *Config, fuel, co2 bool) string {
+	// With ALERT_MODE=relative the thresholds did not trigger the alert,
+	// relativeNote compares against the rolling averages instead
+	fuelThreshold, co2Threshold := cfg.FuelThreshold, cfg.CO2Threshold
+	if cfg.AlertMode == "relative" {
+		fuelThreshold, co2Threshold = 0, 0
+	}
+
+	var message string
+	if fuel && co2 {
+		message = fmt.Sprintf("*Great news, Captain!*\n\nBoth fuel and CO2 prices are looking fantastic right now!\n\nFuel: *%s*%s\nCO2: %s%s\n\nTime to stock up!",
+			formatPrice(cfg, slot.FuelPrice), pctBelow(cfg, slot.FuelPrice, fuelThreshold),
+			co2PriceText(cfg, slot.CO2Price), pctBelow(cfg, slot.CO2Price, co2Threshold))
+	} else if fuel {
+		message = fmt.Sprintf("*Ahoy, Captain!*\n\nFuel prices have dropped to a great level!\n\nFuel: *%s*%s\n\nMight be a good time to fill up your tanks!",
+			formatPrice(cfg, slot.FuelPrice), pctBelow(cfg, slot.FuelPrice, fuelThreshold))
+	} else if co2 {
+		message = fmt.Sprintf("*Ahoy, Captain!*\n\nCO2 certificate prices are looking good!\n\nCO2: %s%s\n\nA fine opportunity to stock up on certificates!",
+			co2PriceText(cfg, slot.CO2Price), pctBelow(cfg, slot.CO2Price, co2Threshold))
+	}
+	return message + affordabilityNote(cfg.Budget, &slot, fuel, co2) + buyAdviceNote(cfg, &slot, fuel, co2)
+}
+
+// pctBelow renders how far a price is below its threshold with SHOW_PCT_BELOW,
+// e.g. " - 10% below your $450/t threshold", and an empty string otherwise
+func pctBelow(cfg *Config, price, threshold int) string {
+	if !cfg.ShowPctBelow || threshold <= 0 || price > threshold {
+		return ""
+	}
+	if price == threshold {
+		return fmt.Sprintf(" - right at your %s threshold", formatPrice(cfg, threshold))
+	}
+
+	pct := math.Round(float64(threshold-price) / float64(threshold) * 100)
+	if pct < 1 {
+		return fmt.Sprintf(" - <1%% below your %s threshold", formatPrice(cfg, threshold))
+	}
+	return fmt.Sprintf(" - %.0f%% below your %s threshold", pct, formatPrice(cfg, threshold))
+}
+
+// buyZoneNote says where alerted prices sit relative to a FUEL_THRESHOLD or
+// CO2_THRESHOLD range, or returns an empty string without ranges
+func buyZoneNote(cfg *Config, slot *PriceSlot, fuel, co2 bool) string {
+	zone := func(label string, price, low, high int) string {
+		switch {
+		case low == 0 || price > high:
+			return ""
+		case price < low:
+			return fmt.Sprintf("%s is below your buy zone (%s-%s), even better!", label, formatPrice(cfg, low), formatPrice(cfg, high))
+		default:
+			return fmt.Sprintf("%s is entering your buy zone (%s-%s).", label, formatPrice(cfg, low), formatPrice(cfg, high))
+		}
+	}
+
+	var lines []string
+	if fuel {
+		if line := zone("Fuel", slot.FuelPrice, cfg.FuelZoneLow, cfg.FuelThreshold); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if co2 {
+		if line := zone("CO2", slot.CO2Price, cfg.CO2ZoneLow, cfg.CO2Threshold); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return "\n\n" + strings.Join(lines, "\n")
+}
+
+// warnHighThresholds logs a hint when a threshold is at least twice the
+// current price. Such a threshold matches nearly every slot, so the bot would
+// alert on almost every price change.
+func warnHighThresholds(cfg *Config, slot *PriceSlot) {
+	if slot.FuelPrice > 0 && cfg.FuelThreshold >= 2*slot.FuelPrice {
+		log.Printf("WARNING: FUEL_THRESHOLD ($%d/t) is far above the current fuel price ($%d/t), your threshold may be set too high - nearly all prices will alert",
+			cfg.FuelThreshold, slot.FuelPrice)
+	}
+	if slot.CO2Price > 0 && cfg.CO2Threshold >= 2*slot.CO2Price {
+		log.Printf("WARNING: CO2_THRESHOLD ($%d/t) is far above the current CO2 price ($%d/t), your threshold may be set too high - nearly all prices will alert",
+			cfg.CO2Threshold, slot.CO2Price)
+	}
+}
+
+// matchSlot returns the first forecast slot starting at currentSlot, or nil
+func matchSlot(prices []PriceSlot, currentSlot string) *PriceSlot {
+	for i := range prices {
+		if prices[i].Time == currentSlot {
+			return &prices[i]
+		}
+	}
+	return nil
+}
+
+// fallbackSlot picks the slot to use when none matches the current time:
+// "last" takes the last slot in the list, "nearest" the slot whose time of day
+// is closest to now, and "none" returns nil so the check skips alerting
+func fallbackSlot(prices []PriceSlot, now time.Time, mode string) *PriceSlot {
+	switch mode {
+	case "last":
+		return &prices[len(prices)-1]
+	case "nearest":
+		nowMinutes := now.Hour()*60 + now.Minute()
+		var best *PriceSlot
+		bestDist := 0
+		for i := range prices {
+			t, err := time.Parse("15:04", prices[i].Time)
+			if err != nil {
+				continue
+			}
+			// Distance on the 24h clock, so 23:45 is close to 00:00
+			dist := t.Hour()*60 + t.Minute() - nowMinutes
+			if dist < 0 {
+				dist = -dist
+			}
+			if dist > 720 {
+				dist = 1440 - dist
+			}
+			if best == nil || dist < bestDist {
+				best, bestDist = &prices[i], dist
+			}
+		}
+		return best
+	default:
+		return nil
+	}
+}
+
+// enterMaintenance switches to the quiet maintenance state: alerts and fetch
+// errors are suppressed until the next good fetch. The optional notice is only
+// sent when maintenance starts.
+func enterMaintenance(client *http.Client, cfg *Config, cd *cooldown) {
+	if cd.maintenance {
+		log.Println("Game still in maintenance, skipping check")
+		return
+	}
+
+	cd.maintenance = true
+	log.Println("Game is in maintenance, pausing alerts until prices are available again")
+
+	if !cfg.MaintenanceNotice {
+		return
+	}
+	message := "*Heads up, Captain!*\n\nShipping Manager is in maintenance. Price alerts are paused until the game is back."
+	if err := notify(client, cfg, message); err != nil {
+		log.Printf("ERROR sending maintenance notice: %s", err)
+		cd.stats.SendErrors++
+		cd.recordError(err)
+	}
+}
+
+// recordEmptyPrices counts an empty price list and, after EMPTY_NOTICE_AFTER
+// in a row, sends a single notice. An occasional empty list is just a blip,
+// a persistent one usually means an account or session problem.
+func recordEmptyPrices(client *http.Client, cfg *Config, cd *cooldown) {
+	cd.emptyStreak++
+	if cfg.EmptyNoticeAfter == 0 || cd.emptyStreak != cfg.EmptyNoticeAfter {
+		return
+	}
+
+	log.Printf("WARNING: API returned %d empty price lists in a row", cd.emptyStreak)
+	message := fmt.Sprintf("*Heads up, Captain!*\n\nThe price feed returned no prices %d times in a row. Check your account and session token, alerts can't fire until prices are back.", cd.emptyStreak)
+	if err := notify(client, cfg, message); err != nil {
+		log.Printf("ERROR sending empty price list notice: %s", err)
+		cd.stats.SendErrors++
+		cd.recordError(err)
+	}
+}
+
+// checkSpread alerts once per slot when the fuel/CO2 spread leaves the configured band
+func checkSpread(client *http.Client, cfg *Config, cd *cooldown, slot *PriceSlot, slotKey string) {
+	if cfg.SpreadMin == nil && cfg.SpreadMax == nil {
+		return
+	}
+	if slot.FuelPrice <= 0 || !co2Valid(cfg, slot) {
+		return
+	}
+	// Free CO2 has no fuel/CO2 ratio
+	if cfg.SpreadMode != "diff" && slot.CO2Price == 0 {
+		return
+	}
+
+	spread, label := float64(slot.FuelPrice)/float64(slot.CO2Price), "Fuel/CO2 ratio"
+	if cfg.SpreadMode == "diff" {
+		spread, label = float64(slot.FuelPrice-slot.CO2Price), "Fuel - CO2 difference"
+	}
+
+	var bound string
+	switch {
+	case cfg.SpreadMin != nil && spread < *cfg.SpreadMin:
+		bound = fmt.Sprintf("below your minimum of %g", *cfg.SpreadMin)
+	case cfg.SpreadMax != nil && spread > *cfg.SpreadMax:
+		bound = fmt.Sprintf("above your maximum of %g", *cfg.SpreadMax)
+	default:
+		return
+	}
+
+	if cd.lastSpread == slotKey {
+		log.Printf("Spread is out of band but already alerted for slot %s", slotKey)
+		return
+	}
+
+	message := fmt.Sprintf("*Spread alert, Captain!*\n\n%s is *%.2f*, %s.\n\nFuel: *%s*\nCO2: *%s*",
+		label, spread, bound, formatPrice(cfg, slot.FuelPrice), formatPrice(cfg, slot.CO2Price))
+	message += gameLink(cfg)
+	if err := notify(client, cfg, message); err != nil {
+		log.Printf("ERROR sending spread alert: %s", err)
+		cd.stats.SendErrors++
+		cd.recordError(err)
+		return
+	}
+
+	cd.lastSpread = slotKey
+	cd.stats.SpreadAlerts++
+	log.Printf("Spread alert sent (%s %.2f %s, slot %s)", label, spread, bound, slotKey)
+}
+
+// checkFormula sends an alert when the slot's prices satisfy ALERT_FORMULA,
+// once per price slot. It runs alongside the plain thresholds.
+func checkFormula(client *http.Client, cfg *Config, cd *cooldown, slot *PriceSlot, slotKey string) {
+	if cfg.AlertFormula == nil || slot.FuelPrice <= 0 || !co2Valid(cfg, slot) {
+		return
+	}
+
+	ok, value := cfg.AlertFormula.matches(slot.FuelPrice, slot.CO2Price)
+	if !ok {
+		return
+	}
+	if cd.lastFormula == slotKey {
+		log.Printf("Formula matches but already alerted for slot %s", slotKey)
+		return
+	}
+
+	message := fmt.Sprintf("*Formula alert, Captain!*\n\nYour formula `%s` matches, effective cost *%g*.\n\nFuel: *%s*\nCO2: *%s*",
+		cfg.AlertFormula.source, value, formatPrice(cfg, slot.FuelPrice), formatPrice(cfg, slot.CO2Price))
+	message += gameLink(cfg)
+	if err := notify(client, cfg, message); err != nil {
+		log.Printf("ERROR sending formula alert: %s", err)
+		cd.stats.SendErrors++
+		cd.recordError(err)
+		return
+	}
+
+	cd.lastFormula = slotKey
+	cd.stats.FormulaAlerts++
+	log.Printf("Formula alert sent (%s, value %g, slot %s)", cfg.AlertFormula.source, value, slotKey)
+}
+
+// checkRecordLow tracks the lowest fuel and CO2 prices ever seen and, with
+// RECORD_LOW_ALERT, announces each new record. The first price seen only sets
+// the baseline, and a record is kept unsaved until its alert went out.
+func checkRecordLow(client *http.Client, cfg *Config, cd *cooldown, slot *PriceSlot) {
+	if cd.recordFuel == 0 && slot.FuelPrice > 0 {
+		cd.recordFuel = slot.FuelPrice
+	}
+	co2 := co2Valid(cfg, slot)
+	if cd.recordCO2 == 0 && !cd.recordCO2Free && co2 {
+		cd.recordCO2 = slot.CO2Price
+		cd.recordCO2Free = slot.CO2Price == 0
+	}
+
+	newFuel := slot.FuelPrice > 0 && slot.FuelPrice < cd.recordFuel
+	newCO2 := co2 && !cd.recordCO2Free && slot.CO2Price < cd.recordCO2
+	if !newFuel && !newCO2 {
+		return
+	}
+
+	if cfg.RecordLowAlert {
+		var lines []string
+		if newFuel {
+			lines = append(lines, fmt.Sprintf("Fuel: *%s* (previous low %s)", formatPrice(cfg, slot.FuelPrice), formatPrice(cfg, cd.recordFuel)))
+		}
+		if newCO2 {
+			lines = append(lines, fmt.Sprintf("CO2: *%s* (previous low %s)", formatPrice(cfg, slot.CO2Price), formatPrice(cfg, cd.recordCO2)))
+		}
+		message := "*📉 Record low, Captain!*\n\nThe lowest price this bot has ever seen:\n\n" + strings.Join(lines, "\n")
+		message += gameLink(cfg)
+		if err := notify(client, cfg, message); err != nil {
+			log.Printf("ERROR sending record low alert: %s", err)
+			cd.stats.SendErrors++
+			cd.recordError(err)
+			return
+		}
+	}
+
+	if newFuel {
+		log.Printf("New fuel record low: $%d/t (was $%d/t)", slot.FuelPrice, cd.recordFuel)
+		cd.recordFuel = slot.FuelPrice
+	}
+	if newCO2 {
+		log.Printf("New CO2 record low: $%d/t (was $%d/t)", slot.CO2Price, cd.recordCO2)
+		cd.recordCO2 = slot.CO2Price
+		cd.recordCO2Free = slot.CO2Price == 0
+	}
+}
+
+// checkWaitSpread advises waiting when the current fuel price is at least
+// WAIT_SPREAD above the cheapest upcoming forecast slot, once per such slot
+func checkWaitSpread(client *http.Client, cfg *Config, cd *cooldown, prices []PriceSlot, slot *PriceSlot) {
+	if cfg.WaitSpread <= 0 || slot.FuelPrice <= 0 {
+		return
+	}
+
+	start := -1
+	for i := range prices {
+		if prices[i].Time == slot.Time && prices[i].Day == slot.Day {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return
+	}
+
+	var best *PriceSlot
+	for i := start + 1; i < len(prices); i++ {
+		if p := prices[i].FuelPrice; p > 0 && (best == nil || p < best.FuelPrice) {
+			best = &prices[i]
+		}
+	}
+	if best == nil || slot.FuelPrice-best.FuelPrice < cfg.WaitSpread {
+		return
+	}
+
+	key := fmt.Sprintf("%s-d%d", best.Time, best.Day)
+	if cd.lastWait == key {
+		return
+	}
+
+	message := fmt.Sprintf("*⏳ Wait, Captain!*\n\nFuel is *%s* now but drops to *%s* at %s (day %d). Better to wait.",
+		formatPrice(cfg, slot.FuelPrice), formatPrice(cfg, best.FuelPrice), best.Time, best.Day)
+	if err := notify(client, cfg, message); err != nil {
+		log.Printf("ERROR sending wait advisory: %s", err)
+		cd.stats.SendErrors++
+		cd.recordError(err)
+		return
+	}
+	cd.lastWait = key
+	log.Printf("Wait advisory sent (fuel $%d/t now, $%d/t at slot %s)", slot.FuelPrice, best.FuelPrice, key)
+}
+
+// checkReminder sends a "watch window" message with the current prices when the
+// current slot is one of REMINDER_SLOTS, at most once per slot per day
+func checkReminder(client *http.Client, cfg *Config, cd *cooldown, slot *PriceSlot, now time.Time, currentSlot string) {
+	if !slices.Contains(cfg.ReminderSlots, currentSlot) {
+		return
+	}
+
+	key := fmt.Sprintf("%s %s", now.Format("2006-01-02"), currentSlot)
+	if cd.lastReminder == key {
+		return
+	}
+
+	message := fmt.Sprintf("*Watch window, Captain!*\n\nIt's %s, one of your reminder slots.\n\nFuel: *%s*\nCO2: *%s*",
+		currentSlot, formatPrice(cfg, slot.FuelPrice), formatPrice(cfg, slot.CO2Price))
+	message += gameLink(cfg)
+	if err := notify(client, cfg, message); err != nil {
+		log.Printf("ERROR sending reminder: %s", err)
+		cd.stats.SendErrors++
+		cd.recordError(err)
+		return
+	}
+
+	cd.lastReminder = key
+	log.Printf("Reminder sent for slot %s", currentSlot)
+}
+
+// gameLink returns the Markdown "Open Shipping Manager" link appended to alerts,
+// or an empty string when INCLUDE_GAME_LINK is off
+func gameLink(cfg *Config) string {
+	if cfg.GameLinkURL == "" {
+		return ""
+	}
+	return fmt.Sprintf("\n\n[Open Shipping Manager](%s)", cfg.GameLinkURL)
+}
+
+// affordabilityNote returns how many tons the configured budget buys at the
+// alerted prices, or an empty string when no budget is configured
+func affordabilityNote(budget int, slot *PriceSlot, fuel, co2 bool) string {
+	if budget <= 0 {
+		return ""
+	}
+
+	var lines []string
+	if fuel && slot.FuelPrice > 0 {
+		lines = append(lines, fmt.Sprintf("Fuel: ~%st", formatThousands(budget/slot.FuelPrice)))
+	}
+	if co2 && slot.CO2Price > 0 {
+		lines = append(lines, fmt.Sprintf("CO2: ~%st", formatThousands(budget/slot.CO2Price)))
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("\n\nWith your $%s budget you can buy:\n%s", formatThousands(budget), strings.Join(lines, "\n"))
 }
 
-// resolveTimezone resolves a timezone string (abbreviation or IANA name) to a *time.Location.
-// Returns local timezone if input is empty.
-func resolveTimezone(input string) *time.Location {
-	if input == "" {
-		return time.Now().Location()
+// holdNote warns when the forecast has a clearly cheaper slot within HOLD_WINDOW,
+// e.g. "Hold off: fuel drops to $450/t in 1h". Forecast slots are in time order,
+// each SLOT_MINUTES long.
+func holdNote(cfg *Config, forecast []PriceSlot, slot *PriceSlot, fuel, co2 bool) string {
+	if cfg.HoldWindow <= 0 {
+		return ""
 	}
 
-	upper := strings.ToUpper(input)
-	if iana, ok := timezoneAbbreviations[upper]; ok {
-		loc, err := time.LoadLocation(iana)
-		if err == nil {
-			return loc
+	start := -1
+	for i := range forecast {
+		if forecast[i].Time == slot.Time && forecast[i].Day == slot.Day {
+			start = i
+			break
 		}
 	}
-
-	loc, err := time.LoadLocation(input)
-	if err == nil {
-		return loc
+	if start < 0 {
+		return ""
 	}
 
-	log.Printf("WARNING: Unknown timezone '%s', falling back to local system timezone", input)
-	return time.Now().Location()
-}
+	slotLength := time.Duration(cfg.SlotMinutes) * time.Minute
+	ahead := int(cfg.HoldWindow / slotLength)
 
-// findEnvFile looks for .env in executable dir first, then working dir
-func findEnvFile() string {
-	// Try executable directory first
-	exe, err := os.Executable()
-	if err == nil {
-		p := filepath.Join(filepath.Dir(exe), ".env")
-		if _, err := os.Stat(p); err == nil {
-			return p
+	// Cheapest upcoming price and how many slots away it is
+	lowest := func(price func(PriceSlot) int) (int, int) {
+		best, bestOffset := price(*slot), 0
+		for offset := 1; offset <= ahead && start+offset < len(forecast); offset++ {
+			if p := price(forecast[start+offset]); p > 0 && p < best {
+				best, bestOffset = p, offset
+			}
 		}
+		return best, bestOffset
 	}
 
-	// Try working directory
-	p := ".env"
-	if _, err := os.Stat(p); err == nil {
-		return p
+	var lines []string
+	if fuel {
+		if best, offset := lowest(func(s PriceSlot) int { return s.FuelPrice }); offset > 0 && slot.FuelPrice-best >= cfg.HoldMinDrop {
+			lines = append(lines, fmt.Sprintf("fuel drops to %s in %s", formatPrice(cfg, best), formatDuration(time.Duration(offset)*slotLength)))
+		}
+	}
+	if co2 {
+		if best, offset := lowest(func(s PriceSlot) int { return s.CO2Price }); offset > 0 && slot.CO2Price-best >= cfg.HoldMinDrop {
+			lines = append(lines, fmt.Sprintf("CO2 drops to %s in %s", formatPrice(cfg, best), formatDuration(time.Duration(offset)*slotLength)))
+		}
+	}
+	if len(lines) == 0 {
+		return ""
 	}
 
-	return ""
+	return "\n\n*Hold off:* " + strings.Join(lines, ", ")
 }
 
-// checkPrices fetches current prices and sends alerts if below threshold
-func checkPrices(client *http.Client, cfg *Config, cd *cooldown) {
-	now := time.Now().UTC()
-	log.Printf("Checking prices at %s (%s)...",
-		now.In(cfg.Timezone).Format("15:04:05"), cfg.Timezone)
+// dataMetaNote tells when the prices were fetched and for which game day,
+// e.g. "(as of 14:32 CET, game day 3)", so stale data is easy to spot
+func dataMetaNote(cfg *Config, fetched time.Time, slot *PriceSlot) string {
+	if fetched.IsZero() {
+		return fmt.Sprintf("\n\n_(game day %d)_", slot.Day)
+	}
+	return fmt.Sprintf("\n\n_(as of %s, game day %d)_", fetched.In(cfg.Timezone).Format("15:04 MST"), slot.Day)
+}
+
+// defaultUserAgents is the USER_AGENT_ROTATE pool when USER_AGENT_POOL is not set
+var defaultUserAgents = []string{
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/141.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/141.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:143.0) Gecko/20100101 Firefox/143.0",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.6 Safari/605.1.15",
+}
+
+// defaultAPIHeaders mimic the game client, API_HEADERS entries override them
+var defaultAPIHeaders = map[string]string{
+	"Accept":       "application/json, text/plain, */*",
+	"Game-Version": "1.0.313",
+	"User-Agent":   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/141.0.0.0 Safari/537.36",
+	"Origin":       "https://shippingmanager.cc",
+	"Referer":      "https://shippingmanager.cc/loading",
+}
+
+// errMaintenance is returned by fetchPrices when the game reports a maintenance window
+var errMaintenance = errors.New("game is in maintenance")
+
+// isMaintenanceResponse detects the game's maintenance responses: an error or
+// non-JSON page that mentions maintenance. A bare 503 only counts as
+// maintenance once it outlasts the fetch retries.
+func isMaintenanceResponse(body []byte) bool {
+	return bytes.Contains(bytes.ToLower(body), []byte("maintenance"))
+}
 
-	prices, err := fetchPrices(client, cfg)
+// transientError marks a fetch failure worth retrying: a network error or a
+// 5xx response other than a maintenance page. maintenance is set for a 503,
+// which is reported as errMaintenance when it's still there after the retries.
+type transientError struct {
+	err         error
+	maintenance bool
+}
+
+func (e *transientError) Error() string { return e.err.Error() }
+func (e *transientError) Unwrap() error { return e.err }
+
+// fetchPrices calls the game API and returns price slots. Network errors and
+// 5xx responses are retried up to FETCH_RETRIES times, waiting FETCH_BACKOFF
+// doubled on each retry plus up to half of it as jitter.
+func fetchPrices(ctx context.Context, client *http.Client, cfg *Config) ([]PriceSlot, error) {
+	delay := cfg.FetchBackoff
+	for attempt := 1; ; attempt++ {
+		prices, err := fetchPricesOnce(ctx, client, cfg)
+		var transient *transientError
+		if err == nil || !errors.As(err, &transient) {
+			return prices, err
+		}
+		if attempt > cfg.FetchRetries || ctx.Err() != nil {
+			if transient.maintenance {
+				return nil, fmt.Errorf("%w (%s)", errMaintenance, err)
+			}
+			return nil, err
+		}
+
+		wait := delay + rand.N(delay/2+1)
+		log.Printf("WARNING: Price fetch attempt %d of %d failed, retrying in %s: %s",
+			attempt, cfg.FetchRetries+1, wait.Round(100*time.Millisecond), err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, err
+		}
+		delay *= 2
+	}
+}
+
+// fetchPricesOnce makes a single price API request
+func fetchPricesOnce(ctx context.Context, client *http.Client, cfg *Config) ([]PriceSlot, error) {
+	req, err := http.NewRequestWithContext(ctx, cfg.APIMethod, "https://shippingmanager.cc/api/bunker/get-prices", strings.NewReader(cfg.APIBody))
 	if err != nil {
-		log.Printf("ERROR fetching prices: %s", err)
-		return
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	if len(prices) == 0 {
-		log.Println("WARNING: API returned empty price list")
-		return
+	if cfg.APIMethod != http.MethodGet {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for key, value := range defaultAPIHeaders {
+		req.Header.Set(key, value)
+	}
+	if len(cfg.UserAgents) > 0 {
+		req.Header.Set("User-Agent", cfg.UserAgents[rand.IntN(len(cfg.UserAgents))])
+	}
+	req.Header.Set("Cookie", fmt.Sprintf("shipping_manager_session=%s", cfg.SessionToken))
+	for key, value := range cfg.APIHeaders {
+		req.Header.Set(key, value)
 	}
 
-	// Find current time slot
-	hour := now.Hour()
-	var slotMinute string
-	if now.Minute() < 30 {
-		slotMinute = "00"
-	} else {
-		slotMinute = "30"
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, &transientError{err: fmt.Errorf("API request failed: %w", err)}
 	}
-	currentSlot := fmt.Sprintf("%02d:%s", hour, slotMinute)
+	defer resp.Body.Close()
 
-	var matched *PriceSlot
-	for i := range prices {
-		if prices[i].Time == currentSlot {
-			matched = &prices[i]
-			break
-		}
+	body, err := readResponseBody(resp)
+	if err != nil {
+		return nil, &transientError{err: fmt.Errorf("failed to read response: %w", err)}
 	}
 
-	if matched == nil {
-		log.Printf("WARNING: No price found for time slot %s, using first available slot", currentSlot)
-		// Fall back to the last slot in the list (most recent)
-		matched = &prices[len(prices)-1]
-		log.Printf("Using slot: %s (day %d)", matched.Time, matched.Day)
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == 419 {
+		return nil, fmt.Errorf("%w (status %d)", errSessionExpired, resp.StatusCode)
 	}
 
-	log.Printf("Current prices - Fuel: $%d/t, CO2: $%d/t (slot: %s, day: %d)",
-		matched.FuelPrice, matched.CO2Price, matched.Time, matched.Day)
+	if resp.StatusCode != 200 {
+		if isMaintenanceResponse(body) {
+			return nil, fmt.Errorf("%w (status %d)", errMaintenance, resp.StatusCode)
+		}
+		err := fmt.Errorf("API returned status %d: %s", resp.StatusCode, truncateBody(body, cfg.MaxLogBody))
+		if resp.StatusCode >= 500 {
+			return nil, &transientError{err: err, maintenance: resp.StatusCode == http.StatusServiceUnavailable}
+		}
+		return nil, err
+	}
 
-	// Check thresholds
-	fuelGreen := matched.FuelPrice > 0 && matched.FuelPrice <= cfg.FuelThreshold
-	co2Green := matched.CO2Price > 0 && matched.CO2Price <= cfg.CO2Threshold
+	var priceResp PriceResponse
+	if err := json.Unmarshal(body, &priceResp); err != nil {
+		if isMaintenanceResponse(body) {
+			return nil, errMaintenance
+		}
+		return nil, fmt.Errorf("failed to parse response: %w (body: %s)", err, truncateBody(body, cfg.MaxLogBody))
+	}
 
-	// Always persist check timestamp
-	cd.lastCheck = time.Now()
-	defer saveCooldown(cd)
+	return priceResp.Data.Prices, nil
+}
 
-	if !fuelGreen && !co2Green {
-		log.Println("Prices above threshold, no alert needed")
-		return
+// readResponseBody reads a response body, decompressing gzip itself when the
+// transport didn't. Go only decodes gzip transparently when it added
+// Accept-Encoding on its own, which an API_HEADERS entry turns off.
+func readResponseBody(resp *http.Response) ([]byte, error) {
+	if resp.Uncompressed || !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return io.ReadAll(resp.Body)
 	}
 
-	// Check if already alerted for this price slot (slot = time + day)
-	slotKey := fmt.Sprintf("%s-d%d", matched.Time, matched.Day)
-	canAlertFuel := fuelGreen && cd.lastFuelSlot != slotKey
-	canAlertCO2 := co2Green && cd.lastCO2Slot != slotKey
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip body: %w", err)
+	}
+	defer gz.Close()
+	return io.ReadAll(gz)
+}
 
-	if !canAlertFuel && !canAlertCO2 {
-		log.Printf("Prices are green but already alerted for slot %s", slotKey)
-		return
+// Telegram parse modes for sendOptions.ParseMode. Messages are written in
+// Markdown unless a message says otherwise.
+const (
+	defaultParseMode = "Markdown"
+	parseModePlain   = "plain" // no parse_mode, the text is sent as is
+)
+
+// sendOptions are per-message sendMessage settings
+type sendOptions struct {
+	Silent       bool         // deliver without a notification sound
+	ChatID       string       // send to this chat instead of TELEGRAM_CHAT_ID
+	SkipThrottle bool         // not counted against MAX_SENDS_PER_MINUTE
+	ParseMode    string       // "" for defaultParseMode, parseModePlain, or a Telegram parse mode like "HTML"
+	ReplyTo      int64        // reply to this message, Telegram only
+	Sent         *sentMessage // receives the sent message, Telegram only
+}
+
+// telegramParseMode returns the parse_mode to send for opts, "" for none
+func telegramParseMode(opts sendOptions) string {
+	switch opts.ParseMode {
+	case "":
+		return defaultParseMode
+	case parseModePlain:
+		return ""
+	default:
+		return opts.ParseMode
 	}
+}
 
-	// Build message (matching existing Node.js format)
-	var message string
-	if canAlertFuel && canAlertCO2 {
-		message = fmt.Sprintf("*Great news, Captain!*\n\nBoth fuel and CO2 prices are looking fantastic right now!\n\nFuel: *$%d/t*\nCO2: *$%d/t*\n\nTime to stock up!",
-			matched.FuelPrice, matched.CO2Price)
-	} else if canAlertFuel {
-		message = fmt.Sprintf("*Ahoy, Captain!*\n\nFuel prices have dropped to a great level!\n\nFuel: *$%d/t*\n\nMight be a good time to fill up your tanks!",
-			matched.FuelPrice)
-	} else if canAlertCO2 {
-		message = fmt.Sprintf("*Ahoy, Captain!*\n\nCO2 certificate prices are looking good!\n\nCO2: *$%d/t*\n\nA fine opportunity to stock up on certificates!",
-			matched.CO2Price)
+// sendTelegramWith sends a message via Telegram Bot API with per-message options
+// and returns the sent message
+func sendTelegramWith(client *http.Client, cfg *Config, message string, opts sendOptions) (*sentMessage, error) {
+	chatID := targetChatID(cfg)
+	if opts.ChatID != "" {
+		chatID = opts.ChatID
+	}
+	payload := telegramMessage{
+		ChatID:              chatID,
+		Text:                message,
+		ParseMode:           telegramParseMode(opts),
+		ProtectContent:      cfg.ProtectContent,
+		DisableNotification: opts.Silent,
+	}
+	if opts.ReplyTo != 0 {
+		payload.ReplyParameters = &replyParameters{MessageID: opts.ReplyTo, AllowWithoutReply: true}
 	}
 
-	// Send Telegram alert
-	err = sendTelegram(client, cfg, message)
+	// Supergroup migrations are only followed for TELEGRAM_CHAT_ID
+	send := callTelegram
+	if opts.ChatID != "" {
+		send = postTelegram
+	}
+	resp, err := send(client, cfg, "sendMessage", payload)
 	if err != nil {
-		log.Printf("ERROR sending Telegram alert: %s", err)
-		return
+		return nil, err
 	}
 
-	// Mark slot as alerted
-	if canAlertFuel {
-		cd.lastFuelSlot = slotKey
-		log.Printf("Fuel alert sent ($%d/t <= $%d/t threshold, slot %s)", matched.FuelPrice, cfg.FuelThreshold, slotKey)
+	sent, err := resp.sentMessage()
+	if err != nil {
+		// Delivered all the same, only editing or replying to it won't work
+		log.Printf("WARNING: Telegram message sent but %s", err)
+		return nil, nil
 	}
-	if canAlertCO2 {
-		cd.lastCO2Slot = slotKey
-		log.Printf("CO2 alert sent ($%d/t <= $%d/t threshold, slot %s)", matched.CO2Price, cfg.CO2Threshold, slotKey)
+	log.Printf("Telegram message sent successfully (message %d)", sent.MessageID)
+	return sent, nil
+}
+
+// callTelegram posts a payload to a Bot API method. On an API error the
+// response is returned along with the error, so callers can check the description.
+// When the group was upgraded to a supergroup, it switches to the new chat ID
+// and retries once.
+func callTelegram(client *http.Client, cfg *Config, method string, payload telegramMessage) (*TelegramResponse, error) {
+	resp, err := postTelegram(client, cfg, method, payload)
+	if err != nil && resp != nil && resp.Parameters.MigrateToChatID != 0 && payload.ChatID != "" {
+		payload.ChatID = recordChatMigration(payload.ChatID, resp.Parameters.MigrateToChatID)
+		return postTelegram(client, cfg, method, payload)
 	}
+	return resp, err
 }
 
-// fetchPrices calls the game API and returns price slots
-func fetchPrices(client *http.Client, cfg *Config) ([]PriceSlot, error) {
-	req, err := http.NewRequest("POST", "https://shippingmanager.cc/api/bunker/get-prices", strings.NewReader(""))
+// postTelegram makes a single Bot API call, waiting for flood control first
+func postTelegram(client *http.Client, cfg *Config, method string, payload telegramMessage) (*TelegramResponse, error) {
+	ctx := clientContext(client)
+	if err := waitForFloodControl(ctx); err != nil {
+		return nil, err
+	}
+
+	data, contentType, err := encodeTelegramMessage(payload, cfg.TelegramSendFormat)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
 
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("Accept", "application/json, text/plain, */*")
-	req.Header.Set("Game-Version", "1.0.313")
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/141.0.0.0 Safari/537.36")
-	req.Header.Set("Origin", "https://shippingmanager.cc")
-	req.Header.Set("Referer", "https://shippingmanager.cc/loading")
-	req.Header.Set("Cookie", fmt.Sprintf("shipping_manager_session=%s", cfg.SessionToken))
+	apiURL := fmt.Sprintf("https://api.telegram.org/bot%s/%s", cfg.TelegramBotToken, method)
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, strings.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("API request failed: %w", err)
+		return nil, fmt.Errorf("Telegram request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, fmt.Errorf("failed to read Telegram response: %w", err)
 	}
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+	var tgResp TelegramResponse
+	if err := json.Unmarshal(body, &tgResp); err != nil {
+		return nil, fmt.Errorf("failed to parse Telegram response: %w (status %d, body: %s)", err, resp.StatusCode, truncateBody(body, cfg.MaxLogBody))
 	}
 
-	var priceResp PriceResponse
-	if err := json.Unmarshal(body, &priceResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w (body: %s)", err, string(body))
+	if !tgResp.OK {
+		if wait := floodWait(&tgResp); wait > 0 {
+			pauseSends(wait)
+			return &tgResp, fmt.Errorf("Telegram flood control, all sends paused for %s: %s", wait, tgResp.Description)
+		}
+		return &tgResp, fmt.Errorf("Telegram API error: %s", tgResp.Description)
 	}
 
-	return priceResp.Data.Prices, nil
+	return &tgResp, nil
 }
 
-// sendTelegram sends a message via Telegram Bot API
-func sendTelegram(client *http.Client, cfg *Config, message string) error {
-	chatID := cfg.TelegramChatID
-	// Auto-prefix numeric-only chat IDs with "-" for group chats
-	if isNumericOnly(chatID) {
-		chatID = "-" + chatID
+// encodeTelegramMessage builds the sendMessage request body and its content type,
+// as JSON or, for proxies that mangle JSON, as a URL-encoded form
+func encodeTelegramMessage(payload telegramMessage, format string) (string, string, error) {
+	if format == "form" {
+		form := url.Values{}
+		form.Set("chat_id", payload.ChatID)
+		if payload.MessageID != 0 {
+			form.Set("message_id", strconv.FormatInt(payload.MessageID, 10))
+		}
+		if payload.Text != "" {
+			form.Set("text", payload.Text)
+		}
+		if payload.ParseMode != "" {
+			form.Set("parse_mode", payload.ParseMode)
+		}
+		if payload.ProtectContent {
+			form.Set("protect_content", "true")
+		}
+		if payload.DisableNotification {
+			form.Set("disable_notification", "true")
+		}
+		if payload.ReplyParameters != nil {
+			reply, err := json.Marshal(payload.ReplyParameters)
+			if err != nil {
+				return "", "", fmt.Errorf("failed to marshal reply parameters: %w", err)
+			}
+			form.Set("reply_parameters", string(reply))
+		}
+		return form.Encode(), "application/x-www-form-urlencoded", nil
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to marshal payload: %w", err)
 	}
+	return string(jsonData), "application/json", nil
+}
 
-	payload := map[string]string{
-		"chat_id":    chatID,
-		"text":       message,
-		"parse_mode": "Markdown",
+// sendTelegramDocument uploads an in-memory file to the chat via sendDocument
+func sendTelegramDocument(client *http.Client, cfg *Config, filename string, data []byte, caption string) error {
+	ctx := clientContext(client)
+	if err := waitForFloodControl(ctx); err != nil {
+		return err
+	}
+	if !allowSend(cfg.MaxSendsPerMinute) {
+		notifyThrottleTripped(client, cfg)
+		return fmt.Errorf("send throttle of %d messages per minute exceeded, document dropped", cfg.MaxSendsPerMinute)
 	}
 
-	jsonData, err := json.Marshal(payload)
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("chat_id", targetChatID(cfg))
+	if caption != "" {
+		form.WriteField("caption", caption)
+	}
+	if cfg.ProtectContent {
+		form.WriteField("protect_content", "true")
+	}
+	part, err := form.CreateFormFile("document", filename)
 	if err != nil {
-		return fmt.Errorf("failed to marshal payload: %w", err)
+		return fmt.Errorf("failed to create upload: %w", err)
+	}
+	part.Write(data)
+	if err := form.Close(); err != nil {
+		return fmt.Errorf("failed to create upload: %w", err)
 	}
 
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", cfg.TelegramBotToken)
-	req, err := http.NewRequest("POST", url, strings.NewReader(string(jsonData)))
+	apiURL := fmt.Sprintf("https://api.telegram.org/bot%s/sendDocument", cfg.TelegramBotToken)
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, &body)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
-	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Type", form.FormDataContentType())
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -595,24 +3451,165 @@ func sendTelegram(client *http.Client, cfg *Config, message string) error {
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return fmt.Errorf("failed to read Telegram response: %w", err)
 	}
 
 	var tgResp TelegramResponse
-	if err := json.Unmarshal(body, &tgResp); err != nil {
+	if err := json.Unmarshal(respBody, &tgResp); err != nil {
 		return fmt.Errorf("failed to parse Telegram response: %w", err)
 	}
 
 	if !tgResp.OK {
+		if wait := floodWait(&tgResp); wait > 0 {
+			pauseSends(wait)
+			return fmt.Errorf("Telegram flood control, all sends paused for %s: %s", wait, tgResp.Description)
+		}
 		return fmt.Errorf("Telegram API error: %s", tgResp.Description)
 	}
 
-	log.Println("Telegram message sent successfully")
+	log.Printf("Telegram document %s sent successfully", filename)
 	return nil
 }
 
+// maxFloodWait is the longest a send waits for flood control to lift,
+// longer pauses fail the send instead of blocking the check
+const maxFloodWait = time.Minute
+
+// floodControl holds Telegram's flood-wait deadline, shared by all sends
+var floodControl struct {
+	mu        sync.Mutex
+	notBefore time.Time
+}
+
+// floodWaitPattern extracts the wait from "retry after N" and FLOOD_WAIT_N descriptions
+var floodWaitPattern = regexp.MustCompile(`(?i)(?:retry after |FLOOD_WAIT_)(\d+)`)
+
+// floodWait returns the mandated wait for a 429/420 flood response, 0 otherwise
+func floodWait(resp *TelegramResponse) time.Duration {
+	if resp.ErrorCode != 429 && resp.ErrorCode != 420 {
+		return 0
+	}
+	if resp.Parameters.RetryAfter > 0 {
+		return time.Duration(resp.Parameters.RetryAfter) * time.Second
+	}
+	if m := floodWaitPattern.FindStringSubmatch(resp.Description); m != nil {
+		if secs, err := strconv.Atoi(m[1]); err == nil {
+			return time.Duration(secs) * time.Second
+		}
+	}
+	// Flood response without a wait, back off a little anyway
+	return 5 * time.Second
+}
+
+// pauseSends stops all Telegram sends for the given duration
+func pauseSends(wait time.Duration) {
+	floodControl.mu.Lock()
+	defer floodControl.mu.Unlock()
+
+	until := time.Now().Add(wait)
+	if until.After(floodControl.notBefore) {
+		floodControl.notBefore = until
+	}
+	log.Printf("WARNING: Telegram flood control, pausing all sends until %s", until.Format("15:04:05"))
+}
+
+// waitForFloodControl blocks until sends are allowed again, or fails if that is
+// more than maxFloodWait away or ctx ends first
+func waitForFloodControl(ctx context.Context) error {
+	floodControl.mu.Lock()
+	wait := time.Until(floodControl.notBefore)
+	floodControl.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	if wait > maxFloodWait {
+		return fmt.Errorf("Telegram sends paused by flood control for another %s", wait.Truncate(time.Second))
+	}
+
+	log.Printf("Waiting %s for Telegram flood control", wait.Truncate(time.Second))
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("gave up waiting for Telegram flood control: %w", ctx.Err())
+	}
+}
+
+// sendThrottle is the MAX_SENDS_PER_MINUTE sliding window, shared by all sends.
+// tripped is set while the limit is exceeded so the notice goes out only once.
+var sendThrottle struct {
+	mu      sync.Mutex
+	sent    []time.Time
+	tripped bool
+}
+
+// allowSend records a send in the one-minute window, or reports false when
+// the limit is reached. A limit of 0 disables the throttle.
+func allowSend(limit int) bool {
+	if limit <= 0 {
+		return true
+	}
+
+	sendThrottle.mu.Lock()
+	defer sendThrottle.mu.Unlock()
+
+	cutoff := time.Now().Add(-time.Minute)
+	recent := sendThrottle.sent[:0]
+	for _, t := range sendThrottle.sent {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	sendThrottle.sent = recent
+
+	if len(recent) >= limit {
+		return false
+	}
+	sendThrottle.sent = append(sendThrottle.sent, time.Now())
+	sendThrottle.tripped = false
+	return true
+}
+
+// notifyThrottleTripped logs and announces the first dropped message of a burst,
+// later drops in the same burst stay quiet
+func notifyThrottleTripped(client *http.Client, cfg *Config) {
+	sendThrottle.mu.Lock()
+	first := !sendThrottle.tripped
+	sendThrottle.tripped = true
+	sendThrottle.mu.Unlock()
+
+	if !first {
+		return
+	}
+
+	log.Printf("WARNING: More than %d messages in the last minute, pausing sends. Check your config for a runaway alert.", cfg.MaxSendsPerMinute)
+	notice := fmt.Sprintf("*Safety limit reached*\n\nThe bot tried to send more than %d messages within a minute and is holding back further messages. Check your thresholds and alert settings.", cfg.MaxSendsPerMinute)
+	if err := notifyWith(client, cfg, notice, sendOptions{SkipThrottle: true}); err != nil {
+		log.Printf("ERROR sending throttle notice: %s", err)
+	}
+}
+
+// targetChatID returns the chat ID alerts are sent to, following a
+// supergroup migration if one happened
+func targetChatID(cfg *Config) string {
+	return migratedChatID(configuredChatID(cfg))
+}
+
+// configuredChatID returns TELEGRAM_CHAT_ID as sent to the API
+func configuredChatID(cfg *Config) string {
+	chatID := cfg.TelegramChatID
+	// Auto-prefix numeric-only chat IDs with "-" for group chats
+	if isNumericOnly(chatID) {
+		chatID = "-" + chatID
+	}
+	return chatID
+}
+
 // cooldownFilePath returns the path to the .cooldown file next to the executable
 func cooldownFilePath() string {
 	exe, err := os.Executable()
@@ -622,52 +3619,183 @@ func cooldownFilePath() string {
 	return filepath.Join(filepath.Dir(exe), ".cooldown")
 }
 
-// loadCooldown reads persisted cooldown timestamps from disk
-func loadCooldown() *cooldown {
-	cd := &cooldown{}
-	p := cooldownFilePath()
+// loadCooldown reads persisted cooldown timestamps from the state store
+func loadCooldown(store StateStore) *cooldown {
+	cd := &cooldown{store: store, intervalChanged: make(chan struct{}, 1)}
 
-	data, err := os.ReadFile(p)
-	if err != nil {
+	state, err := store.Load()
+	if errors.Is(err, errNoState) {
 		return cd
 	}
-
-	var state cooldownState
-	if err := json.Unmarshal(data, &state); err != nil {
-		log.Printf("WARNING: Failed to parse .cooldown file: %s", err)
+	if err != nil {
+		log.Printf("WARNING: No usable state in %s, starting with empty state: %s", store.Name(), err)
 		return cd
 	}
 
 	cd.lastFuelSlot = state.LastFuelSlot
 	cd.lastCO2Slot = state.LastCO2Slot
-	if state.LastCheck != "" {
-		if t, err := time.Parse(time.RFC3339, state.LastCheck); err == nil {
-			cd.lastCheck = t
-		}
-	}
+	cd.stats = state.Stats
+	cd.updateOffset = state.UpdateOffset
+	cd.lastSpread = state.LastSpread
+	cd.lastFormula = state.LastFormula
+	cd.pinnedMessageID = state.PinnedID
+	cd.lastFuelThreshold = state.FuelAlertAt
+	cd.migratedFrom = state.MigratedFrom
+	cd.watchFuel = state.WatchFuel
+	cd.watchCO2 = state.WatchCO2
+	cd.pendingCommand = state.Pending
+	cd.snoozeRemaining = state.Snooze
+	cd.recentFuel = state.RecentFuel
+	cd.lastVelocity = state.LastVelocity
+	cd.lastWait = state.LastWait
+	cd.emptyStreak = state.EmptyStreak
+	cd.fuelStreak = state.FuelStreak
+	cd.co2Streak = state.CO2Streak
+	cd.lastFuelMessageID = state.ThreadFuel
+	cd.lastCO2MessageID = state.ThreadCO2
+	cd.pendingDeletes = state.Deletes
+	cd.lastFuelAlertPrice = state.FuelAlerted
+	cd.lastCO2AlertPrice = state.CO2Alerted
+	cd.recentAlerts = state.RecentAlerts
+	cd.forecastAlerted = state.ForecastSent
+	cd.dailyLows = state.DailyLows
+	cd.setFuel = state.SetFuel
+	cd.setCO2 = state.SetCO2
+	cd.relativeFuel = state.RelativeFuel
+	cd.relativeCO2 = state.RelativeCO2
+	cd.migratedTo = state.MigratedTo
+	cd.lastCO2Threshold = state.CO2AlertAt
+	cd.lastReminder = state.LastReminder
+	cd.maintenance = state.Maintenance
+	cd.sessionToken = state.SessionToken
+	cd.sessionSource = state.SessionFrom
+	cd.lastUpdateCheck = parseStateTime(state.UpdateCheck)
+	cd.notifiedVersion = state.Notified
+	cd.lastTier = state.LastTier
+	cd.escalationMessage = state.Escalation
+	cd.escalateAt = parseStateTime(state.EscalateAt)
+	cd.slotHistory = state.SlotHistory
+	cd.recordFuel = state.RecordFuel
+	cd.recordCO2 = state.RecordCO2
+	cd.checkInterval, _ = time.ParseDuration(state.Interval)
+	cd.recordCO2Free = state.FreeCO2Low
+	cd.lastCheck = parseStateTime(state.LastCheck)
+	cd.lastFuelSent = parseStateTime(state.LastFuelSent)
+	cd.lastCO2Sent = parseStateTime(state.LastCO2Sent)
 
 	return cd
 }
 
-// saveCooldown writes cooldown timestamps to disk
+// readCooldownState reads and parses a state file
+func readCooldownState(path string) (cooldownState, error) {
+	var state cooldownState
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("failed to parse %s: %w", filepath.Base(path), err)
+	}
+	return state, nil
+}
+
+// saveCooldown writes cooldown timestamps to the state store
 func saveCooldown(cd *cooldown) {
+	syncChatMigration(cd)
 	state := cooldownState{
 		LastFuelSlot: cd.lastFuelSlot,
 		LastCO2Slot:  cd.lastCO2Slot,
+		Stats:        cd.stats,
+		UpdateOffset: cd.updateOffset,
+		LastSpread:   cd.lastSpread,
+		LastFormula:  cd.lastFormula,
+		PinnedID:     cd.pinnedMessageID,
+		FuelAlertAt:  cd.lastFuelThreshold,
+		MigratedFrom: cd.migratedFrom,
+		WatchFuel:    cd.watchFuel,
+		WatchCO2:     cd.watchCO2,
+		Pending:      cd.pendingCommand,
+		Snooze:       cd.snoozeRemaining,
+		RecentFuel:   cd.recentFuel,
+		LastVelocity: cd.lastVelocity,
+		LastWait:     cd.lastWait,
+		EmptyStreak:  cd.emptyStreak,
+		FuelStreak:   cd.fuelStreak,
+		CO2Streak:    cd.co2Streak,
+		ThreadFuel:   cd.lastFuelMessageID,
+		ThreadCO2:    cd.lastCO2MessageID,
+		Deletes:      cd.pendingDeletes,
+		FuelAlerted:  cd.lastFuelAlertPrice,
+		CO2Alerted:   cd.lastCO2AlertPrice,
+		RecentAlerts: cd.recentAlerts,
+		ForecastSent: cd.forecastAlerted,
+		DailyLows:    cd.dailyLows,
+		SetFuel:      cd.setFuel,
+		SetCO2:       cd.setCO2,
+		RelativeFuel: cd.relativeFuel,
+		RelativeCO2:  cd.relativeCO2,
+		MigratedTo:   cd.migratedTo,
+		CO2AlertAt:   cd.lastCO2Threshold,
+		LastReminder: cd.lastReminder,
+		Maintenance:  cd.maintenance,
+		SessionToken: cd.sessionToken,
+		SessionFrom:  cd.sessionSource,
+		UpdateCheck:  formatStateTime(cd.lastUpdateCheck),
+		Notified:     cd.notifiedVersion,
+		LastTier:     cd.lastTier,
+		Escalation:   cd.escalationMessage,
+		EscalateAt:   formatStateTime(cd.escalateAt),
+		SlotHistory:  cd.slotHistory,
+		RecordFuel:   cd.recordFuel,
+		RecordCO2:    cd.recordCO2,
+		Interval:     formatInterval(cd.checkInterval),
+		FreeCO2Low:   cd.recordCO2Free,
+		LastCheck:    formatStateTime(cd.lastCheck),
+		LastFuelSent: formatStateTime(cd.lastFuelSent),
+		LastCO2Sent:  formatStateTime(cd.lastCO2Sent),
 	}
-	if !cd.lastCheck.IsZero() {
-		state.LastCheck = cd.lastCheck.Format(time.RFC3339)
+
+	if err := cd.store.Save(state); err != nil {
+		log.Printf("WARNING: Failed to save state to %s: %s", cd.store.Name(), err)
 	}
+}
 
-	data, err := json.Marshal(state)
+// parseStateTime parses an RFC3339 timestamp from the state file, zero if empty or invalid
+func parseStateTime(s string) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, s)
 	if err != nil {
-		log.Printf("WARNING: Failed to marshal cooldown state: %s", err)
-		return
+		return time.Time{}
+	}
+	return t
+}
+
+// formatStateTime formats a timestamp for the state file, empty if zero
+func formatStateTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
 	}
+	return t.Format(time.RFC3339)
+}
+
+// recordError stores the most recent error and when it happened
+func (cd *cooldown) recordError(err error) {
+	cd.stats.LastError = err.Error()
+	cd.stats.LastErrorTime = time.Now().Format(time.RFC3339)
+}
 
-	if err := os.WriteFile(cooldownFilePath(), data, 0644); err != nil {
-		log.Printf("WARNING: Failed to save .cooldown file: %s", err)
+// formatLastError formats the last recorded error for logging, returns "none" if there is none
+func formatLastError(stats checkStats, tz *time.Location) string {
+	if stats.LastError == "" {
+		return "none"
+	}
+	t, err := time.Parse(time.RFC3339, stats.LastErrorTime)
+	if err != nil {
+		return stats.LastError
 	}
+	return fmt.Sprintf("%s (%s)", stats.LastError, formatCooldownTime(t, tz))
 }
 
 // formatSlot returns the slot key or "none" if empty
@@ -683,9 +3811,60 @@ func formatCooldownTime(t time.Time, tz *time.Location) string {
 	if t.IsZero() {
 		return "never"
 	}
+	if tz == nil {
+		tz = time.UTC
+	}
 	return t.In(tz).Format("2006-01-02 15:04:05")
 }
 
+// formatDuration formats a duration without trailing zero units ("10m" instead of "10m0s")
+func formatDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// formatPrice formats a price for messages, "$500/t" by default or with the PRICE_UNIT suffix
+func formatPrice(cfg *Config, price int) string {
+	return fmt.Sprintf("$%d%s", price, cfg.PriceUnit)
+}
+
+// co2PriceText renders the bold CO2 price for alerts, calling out free certificates
+func co2PriceText(cfg *Config, price int) string {
+	if price == 0 {
+		return fmt.Sprintf("*%s* (free!)", formatPrice(cfg, price))
+	}
+	return "*" + formatPrice(cfg, price) + "*"
+}
+
+// truncateBody shortens a response body quoted in an error to max characters,
+// noting the original length, so HTML error pages don't flood the log
+func truncateBody(body []byte, max int) string {
+	text := []rune(string(body))
+	if len(text) <= max {
+		return string(text)
+	}
+	return fmt.Sprintf("%s... (%d bytes total)", string(text[:max]), len(body))
+}
+
+// formatThousands formats a non-negative number with comma thousands separators
+func formatThousands(n int) string {
+	digits := strconv.Itoa(n)
+	var b strings.Builder
+	for i, c := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
 // isNumericOnly checks if a string contains only digits
 func isNumericOnly(s string) bool {
 	for _, c := range s {
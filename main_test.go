@@ -0,0 +1,1772 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+// memoryStore is a StateStore keeping the last saved state in memory
+type memoryStore struct {
+	state *cooldownState
+	saves int
+}
+
+func (s *memoryStore) Load() (cooldownState, error) {
+	if s.state == nil {
+		return cooldownState{}, errNoState
+	}
+	return *s.state, nil
+}
+
+func (s *memoryStore) Save(state cooldownState) error {
+	s.state = &state
+	s.saves++
+	return nil
+}
+
+func (s *memoryStore) Name() string { return "memory" }
+
+// redirectTransport sends every request to a test server, keeping path and query
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// testClient returns a client whose requests to any host, Telegram and the game
+// API included, are served by handler
+func testClient(t *testing.T, handler http.Handler) *http.Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("parse test server URL: %v", err)
+	}
+	return &http.Client{Transport: redirectTransport{target: target}}
+}
+
+// fakeGame serves the price API and the Telegram Bot API for a check. The
+// forecast is built around the slot that is current at request time, and the
+// sent Telegram messages are recorded.
+type fakeGame struct {
+	mu       sync.Mutex
+	prices   func(current string) []PriceSlot
+	messages []string
+}
+
+func newFakeGame(t *testing.T, prices func(current string) []PriceSlot) (*http.Client, *fakeGame) {
+	game := &fakeGame{prices: prices}
+	client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		game.mu.Lock()
+		defer game.mu.Unlock()
+		if strings.HasSuffix(r.URL.Path, "/sendMessage") {
+			var msg telegramMessage
+			json.NewDecoder(r.Body).Decode(&msg)
+			game.messages = append(game.messages, msg.Text)
+			w.Write([]byte(`{"ok":true,"result":{}}`))
+			return
+		}
+		var resp PriceResponse
+		resp.Data.Prices = game.prices(slotTime(timeNow().UTC(), 30))
+		json.NewEncoder(w).Encode(resp)
+	}))
+	return client, game
+}
+
+// setClock fixes the clock checkPrices reads to at until the test ends
+func setClock(t *testing.T, at time.Time) {
+	t.Helper()
+	t.Cleanup(func() { timeNow = time.Now })
+	timeNow = func() time.Time { return at }
+}
+
+// recordingNotifier is a Notifier that keeps the sent messages instead of
+// delivering them, or fails every send with err
+type recordingNotifier struct {
+	mu       sync.Mutex
+	messages []string
+	err      error
+}
+
+func (n *recordingNotifier) Send(client *http.Client, message string, opts sendOptions) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.err != nil {
+		return n.err
+	}
+	n.messages = append(n.messages, message)
+	return nil
+}
+
+func (n *recordingNotifier) Target() string { return "test" }
+
+// sent returns the messages sent so far
+func (n *recordingNotifier) sent() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]string(nil), n.messages...)
+}
+
+// sent returns the Telegram messages sent so far
+func (g *fakeGame) sent() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]string(nil), g.messages...)
+}
+
+// checkConfig returns a config for checkPrices with the test thresholds
+func checkConfig(t *testing.T) *Config {
+	t.Cleanup(func() { os.Remove(cooldownFilePath()) })
+	cfg := &Config{
+		TelegramBotToken: "123:abc",
+		TelegramChatID:   "-1001",
+		FuelThreshold:    450,
+		CO2Threshold:     10,
+		Timezone:         time.UTC,
+		SlotTimezone:     time.UTC,
+		APIMethod:        http.MethodPost,
+		SlotMinutes:      30,
+		PriceUnit:        "/t",
+		CommandTimeout:   20 * time.Second,
+	}
+	cfg.Notifier = newNotifier(cfg)
+	return cfg
+}
+
+func TestSuggestTimezones(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"CETT", []string{"CEST", "CET"}},
+		{"ESTT", []string{"EST"}},
+		{"XYZXYZ", nil},
+	}
+	for _, tt := range tests {
+		got := suggestTimezones(tt.input)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("suggestTimezones(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestResolveTimezoneSuggestion(t *testing.T) {
+	_, err := resolveTimezone("CETT")
+	if err == nil || !strings.Contains(err.Error(), "did you mean CEST, CET?") {
+		t.Errorf("resolveTimezone(CETT) error = %v, want a did-you-mean suggestion", err)
+	}
+
+	_, err = resolveTimezone("Mars/Olympus")
+	if err == nil || strings.Contains(err.Error(), "did you mean") {
+		t.Errorf("resolveTimezone(Mars/Olympus) error = %v, want no suggestion", err)
+	}
+}
+
+func TestLoadTimezoneStrict(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		strict  bool
+		want    *time.Location
+		wantErr bool
+	}{
+		{"empty uses the fallback", "", true, time.UTC, false},
+		{"known name", "Europe/Berlin", true, berlin, false},
+		{"unknown falls back", "CETT", false, time.UTC, false},
+		{"unknown rejected with STRICT_TIMEZONE", "CETT", true, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := loadTimezone("TIMEZONE", tt.input, time.UTC, tt.strict)
+			if tt.wantErr {
+				if err == nil || !strings.HasPrefix(err.Error(), "TIMEZONE: ") {
+					t.Errorf("loadTimezone error = %v, want one naming TIMEZONE", err)
+				}
+				return
+			}
+			if err != nil || loc.String() != tt.want.String() {
+				t.Errorf("loadTimezone = %v, %v, want %v", loc, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimezoneAbbreviationsLoad(t *testing.T) {
+	abbrs := make([]string, 0, len(timezoneAbbreviations))
+	for abbr := range timezoneAbbreviations {
+		abbrs = append(abbrs, abbr)
+	}
+	sort.Strings(abbrs)
+
+	for _, abbr := range abbrs {
+		iana := timezoneAbbreviations[abbr]
+		if _, err := time.LoadLocation(iana); err != nil {
+			t.Errorf("%s maps to %s, which does not load: %v", abbr, iana, err)
+		}
+	}
+}
+
+func TestResolveTimezoneOffsets(t *testing.T) {
+	winter := time.Date(2026, time.January, 15, 12, 0, 0, 0, time.UTC)
+	summer := time.Date(2026, time.July, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		input string
+		at    time.Time
+		hours float64
+	}{
+		{"UTC", winter, 0},
+		{"GMT", winter, 0},
+		{"BST", summer, 1},
+		{"CET", winter, 1},
+		{"cest", summer, 2},
+		{"EET", winter, 2},
+		{"MSK", winter, 3},
+		{"IST", winter, 5.5},
+		{"NPT", winter, 5.75},
+		{"GST", winter, 4},
+		{"JST", winter, 9},
+		{"AEST", summer, 10},
+		{"AEDT", winter, 11},
+		{"EST", winter, -5},
+		{"EDT", summer, -4},
+		{"CST", winter, -6},
+		{"PST", winter, -8},
+		{"HST", summer, -10},
+		{"NST", winter, -3.5},
+		{"Europe/Berlin", summer, 2},
+	}
+	for _, tt := range tests {
+		loc, err := resolveTimezone(tt.input)
+		if err != nil {
+			t.Errorf("resolveTimezone(%q): %v", tt.input, err)
+			continue
+		}
+		_, offset := tt.at.In(loc).Zone()
+		if got := float64(offset) / 3600; got != tt.hours {
+			t.Errorf("%s on %s: UTC%+g, want UTC%+g", tt.input, tt.at.Format("2006-01-02"), got, tt.hours)
+		}
+	}
+}
+
+func TestCombineWhenEitherNew(t *testing.T) {
+	client, game := newFakeGame(t, func(current string) []PriceSlot {
+		return []PriceSlot{{Time: current, Day: 1, FuelPrice: 400, CO2Price: 8}}
+	})
+
+	tests := []struct {
+		name              string
+		combine           bool
+		fuelOld, co2Old   bool
+		wantFuel, wantCO2 bool
+	}{
+		{name: "fuel new, CO2 old", combine: true, co2Old: true, wantFuel: true, wantCO2: true},
+		{name: "fuel old, CO2 new", combine: true, fuelOld: true, wantFuel: true, wantCO2: true},
+		{name: "both new", combine: true, wantFuel: true, wantCO2: true},
+		{name: "neither new", combine: true, fuelOld: true, co2Old: true},
+		{name: "fuel new, CO2 old without combining", co2Old: true, wantFuel: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := checkConfig(t)
+			cfg.CombineEitherNew = tt.combine
+			before := len(game.sent())
+
+			// An earlier check in this slot already alerted the "old" types
+			cd := &cooldown{store: &memoryStore{}}
+			setClock(t, time.Date(2026, 3, 1, 10, 5, 0, 0, time.UTC))
+			slotKey := "10:00-d1"
+			if tt.fuelOld {
+				cd.lastFuelSlot = slotKey
+			}
+			if tt.co2Old {
+				cd.lastCO2Slot = slotKey
+			}
+			checkPrices(client, cfg, cd)
+
+			sent := game.sent()[before:]
+			if !tt.wantFuel && !tt.wantCO2 {
+				if len(sent) != 0 {
+					t.Errorf("sent %q, want no alert", sent)
+				}
+				return
+			}
+			if len(sent) != 1 {
+				t.Fatalf("sent %d alerts, want 1", len(sent))
+			}
+			if got := strings.Contains(sent[0], "Fuel: *$400/t*"); got != tt.wantFuel {
+				t.Errorf("alert shows fuel: %v, want %v\n%s", got, tt.wantFuel, sent[0])
+			}
+			if got := strings.Contains(sent[0], "CO2: *$8/t*"); got != tt.wantCO2 {
+				t.Errorf("alert shows CO2: %v, want %v\n%s", got, tt.wantCO2, sent[0])
+			}
+
+			// Afterwards both types are marked for the slot, whichever was new
+			if cd.lastFuelSlot != slotKey || cd.lastCO2Slot != slotKey {
+				t.Errorf("marked slots fuel %q, CO2 %q, want %q", cd.lastFuelSlot, cd.lastCO2Slot, slotKey)
+			}
+		})
+	}
+}
+
+func TestOverlappingCheckSkipped(t *testing.T) {
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		<-release
+		w.Write([]byte(`{"data":{"prices":[]}}`))
+	}))
+	cfg := checkConfig(t)
+	cd := &cooldown{store: &memoryStore{}}
+
+	// The first check hangs on a slow price API
+	done := make(chan struct{})
+	go func() {
+		checkPrices(client, cfg, cd)
+		close(done)
+	}()
+	for fetches.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// A tick firing meanwhile returns at once instead of queueing up
+	second := make(chan struct{})
+	go func() {
+		checkPrices(client, cfg, cd)
+		close(second)
+	}()
+	select {
+	case <-second:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the overlapping check waited for the running one")
+	}
+
+	// The state lock is free during the fetch, commands answer meanwhile
+	replied := make(chan string)
+	go func() {
+		replied <- handleSnooze(context.Background(), client, cfg, cd, nil)
+	}()
+	select {
+	case <-replied:
+	case <-time.After(2 * time.Second):
+		t.Fatal("a command waited for the price fetch of the running check")
+	}
+
+	close(release)
+	<-done
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("price API requested %d times, want the overlapping check dropped", n)
+	}
+	if cd.stats.TotalChecks != 1 {
+		t.Errorf("TotalChecks = %d, want 1", cd.stats.TotalChecks)
+	}
+}
+
+func TestNilTimezone(t *testing.T) {
+	at := time.Date(2026, time.March, 1, 14, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		t    time.Time
+		tz   *time.Location
+		want string
+	}{
+		{"nil timezone formats in UTC", at, nil, "2026-03-01 14:30:00"},
+		{"configured timezone", at, time.FixedZone("UTC+2", 2*3600), "2026-03-01 16:30:00"},
+		{"zero time", time.Time{}, nil, "never"},
+	}
+	for _, tt := range tests {
+		if got := formatCooldownTime(tt.t, tt.tz); got != tt.want {
+			t.Errorf("%s: formatCooldownTime = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	cfg := &Config{}
+	ensureTimezones(cfg)
+	if cfg.Timezone != time.UTC || cfg.SlotTimezone != time.UTC {
+		t.Errorf("ensureTimezones left %v and %v, want UTC for both", cfg.Timezone, cfg.SlotTimezone)
+	}
+}
+
+func TestSlotMinutes(t *testing.T) {
+	tests := []struct {
+		minutes   int
+		now       string
+		wantSlot  string
+		wantCheck string
+	}{
+		{15, "14:00", "14:00", "14:01"},
+		{15, "14:14", "14:00", "14:16"},
+		{15, "14:15", "14:15", "14:16"},
+		{15, "14:59", "14:45", "15:01"},
+		{30, "14:00", "14:00", "14:01"},
+		{30, "14:29", "14:00", "14:31"},
+		{30, "14:30", "14:30", "14:31"},
+		{30, "14:31", "14:30", "15:01"},
+		{60, "14:00", "14:00", "14:01"},
+		{60, "14:01", "14:00", "15:01"},
+		{60, "14:59", "14:00", "15:01"},
+		{60, "23:30", "23:00", "00:01"},
+	}
+	for _, tt := range tests {
+		now, err := time.Parse("15:04", tt.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := slotTime(now, tt.minutes); got != tt.wantSlot {
+			t.Errorf("slotTime(%s, %d) = %s, want %s", tt.now, tt.minutes, got, tt.wantSlot)
+		}
+		if got := nextCheckTime(now, tt.minutes).Format("15:04"); got != tt.wantCheck {
+			t.Errorf("nextCheckTime(%s, %d) = %s, want %s", tt.now, tt.minutes, got, tt.wantCheck)
+		}
+	}
+}
+
+func TestFallbackMode(t *testing.T) {
+	prices := []PriceSlot{
+		{Time: "00:00", FuelPrice: 400},
+		{Time: "06:00", FuelPrice: 500},
+		{Time: "14:00", FuelPrice: 600},
+	}
+	tests := []struct {
+		name string
+		mode string
+		now  string
+		want string // chosen slot time, "" for none
+	}{
+		{"last takes the last slot", "last", "05:10", "14:00"},
+		{"nearest takes the closest slot", "nearest", "05:10", "06:00"},
+		{"nearest looks back too", "nearest", "08:00", "06:00"},
+		{"nearest wraps around midnight", "nearest", "23:40", "00:00"},
+		{"none skips the check", "none", "05:10", ""},
+	}
+	for _, tt := range tests {
+		now, err := time.Parse("15:04", tt.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := fallbackSlot(prices, now, tt.mode)
+		gotTime := ""
+		if got != nil {
+			gotTime = got.Time
+		}
+		if gotTime != tt.want {
+			t.Errorf("%s: fallbackSlot(%s, %s) = %q, want %q", tt.name, tt.mode, tt.now, gotTime, tt.want)
+		}
+	}
+
+	// A forecast without the current slot alerts on the fallback, or not at all with "none"
+	client, game := newFakeGame(t, func(current string) []PriceSlot {
+		return []PriceSlot{{Time: "99:99", Day: 1, FuelPrice: 400, CO2Price: 50}}
+	})
+	for _, mode := range []string{"last", "none"} {
+		cfg := checkConfig(t)
+		cfg.FallbackMode = mode
+		before := len(game.sent())
+		checkPrices(client, cfg, &cooldown{store: &memoryStore{}})
+		sent := len(game.sent()) - before
+		if want := map[string]int{"last": 1, "none": 0}[mode]; sent != want {
+			t.Errorf("FALLBACK_MODE=%s sent %d alerts, want %d", mode, sent, want)
+		}
+	}
+}
+
+func TestBuildMessage(t *testing.T) {
+	slot := PriceSlot{Time: "10:00", Day: 3, FuelPrice: 405, CO2Price: 9}
+	plain := &Config{FuelThreshold: 450, CO2Threshold: 10, PriceUnit: "/t"}
+	budget := &Config{FuelThreshold: 450, CO2Threshold: 10, PriceUnit: "/t", Budget: 810000}
+
+	tests := []struct {
+		name      string
+		cfg       *Config
+		fuel, co2 bool
+		want      string
+	}{
+		{
+			name: "fuel only",
+			cfg:  plain, fuel: true,
+			want: "*Ahoy, Captain!*\n\nFuel prices have dropped to a great level!\n\nFuel: *$405/t*\n\nMight be a good time to fill up your tanks!",
+		},
+		{
+			name: "CO2 only",
+			cfg:  plain, co2: true,
+			want: "*Ahoy, Captain!*\n\nCO2 certificate prices are looking good!\n\nCO2: *$9/t*\n\nA fine opportunity to stock up on certificates!",
+		},
+		{
+			name: "both",
+			cfg:  plain, fuel: true, co2: true,
+			want: "*Great news, Captain!*\n\nBoth fuel and CO2 prices are looking fantastic right now!\n\nFuel: *$405/t*\nCO2: *$9/t*\n\nTime to stock up!",
+		},
+		{
+			name: "fuel only with BUDGET",
+			cfg:  budget, fuel: true,
+			want: "*Ahoy, Captain!*\n\nFuel prices have dropped to a great level!\n\nFuel: *$405/t*\n\nMight be a good time to fill up your tanks!\n\nWith your $810,000 budget you can buy:\nFuel: ~2,000t",
+		},
+		{
+			name: "neither",
+			cfg:  plain,
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildMessage(slot, tt.cfg, tt.fuel, tt.co2); got != tt.want {
+				t.Errorf("buildMessage() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHoldNote(t *testing.T) {
+	forecast := []PriceSlot{
+		{Time: "10:00", Day: 1, FuelPrice: 440, CO2Price: 9},
+		{Time: "10:30", Day: 1, FuelPrice: 445, CO2Price: 9},
+		{Time: "11:00", Day: 1, FuelPrice: 410, CO2Price: 8},
+		{Time: "11:30", Day: 1, FuelPrice: 390, CO2Price: 9},
+	}
+	tests := []struct {
+		name    string
+		window  time.Duration
+		minDrop int
+		fuel    bool
+		co2     bool
+		want    string
+	}{
+		{"cheaper fuel within the window", time.Hour, 1, true, false, "\n\n*Hold off:* fuel drops to $410/t in 1h"},
+		{"cheapest slot within a longer window", 2 * time.Hour, 1, true, false, "\n\n*Hold off:* fuel drops to $390/t in 1h30m"},
+		{"both types", time.Hour, 1, true, true, "\n\n*Hold off:* fuel drops to $410/t in 1h, CO2 drops to $8/t in 1h"},
+		{"no cheaper slot within the window", 30 * time.Minute, 1, true, false, ""},
+		{"drop below HOLD_MIN_DROP", time.Hour, 50, true, false, ""},
+		{"disabled", 0, 1, true, false, ""},
+	}
+	for _, tt := range tests {
+		cfg := &Config{SlotMinutes: 30, HoldWindow: tt.window, HoldMinDrop: tt.minDrop, PriceUnit: "/t"}
+		if got := holdNote(cfg, forecast, &forecast[0], tt.fuel, tt.co2); got != tt.want {
+			t.Errorf("%s: holdNote = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// The current slot missing from the forecast gives no note
+	cfg := &Config{SlotMinutes: 30, HoldWindow: time.Hour, HoldMinDrop: 1, PriceUnit: "/t"}
+	if got := holdNote(cfg, forecast, &PriceSlot{Time: "09:30", Day: 1, FuelPrice: 500}, true, false); got != "" {
+		t.Errorf("slot outside the forecast: holdNote = %q, want none", got)
+	}
+}
+
+// writeTestEnv writes a .env with the given content to a temp dir and makes it
+// the working directory, so loadConfig picks it up
+func writeTestEnv(t *testing.T, content string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestCleanToken(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"123:abc", "123:abc"},
+		{"123:abc\r", "123:abc"},
+		{"  123:abc\r\n", "123:abc"},
+		{"\ufeff123:abc", "123:abc"},
+		{"\u200b123:abc\u200d", "123:abc"},
+		{"123 :abc", "123 :abc"},
+	}
+	for _, tt := range tests {
+		if got := cleanToken(tt.input); got != tt.want {
+			t.Errorf("cleanToken(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestLoadConfigTokens(t *testing.T) {
+	base := "TELEGRAM_CHAT_ID=-1001\r\nFUEL_THRESHOLD=450\r\nCO2_THRESHOLD=10\r\n"
+
+	// Windows line endings and pasted BOM or zero-width characters must not end
+	// up in the tokens, neither inline nor from a _FILE secret
+	secret := filepath.Join(t.TempDir(), "session")
+	if err := os.WriteFile(secret, []byte("\ufeffsession\u200b\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	writeTestEnv(t, "TELEGRAM_BOT_TOKEN=\ufeff123:abc\r\nSESSION_TOKEN_FILE="+secret+"\r\n"+base)
+	cfg, err := loadConfig(nil)
+	if err != nil {
+		t.Fatalf("loadConfig with CRLF line endings: %v", err)
+	}
+	if cfg.TelegramBotToken != "123:abc" || cfg.SessionToken != "session" || cfg.TelegramChatID != "-1001" {
+		t.Errorf("tokens = %q, %q, %q, want them without stray characters",
+			cfg.TelegramBotToken, cfg.SessionToken, cfg.TelegramChatID)
+	}
+	if cfg.FuelThreshold != 450 || cfg.CO2Threshold != 10 {
+		t.Errorf("thresholds = %d, %d, want 450, 10", cfg.FuelThreshold, cfg.CO2Threshold)
+	}
+
+	// A space inside a token is a broken paste, not something to strip
+	for _, key := range []string{"TELEGRAM_BOT_TOKEN", "SESSION_TOKEN"} {
+		vars := map[string]string{"TELEGRAM_BOT_TOKEN": "123:abc", "SESSION_TOKEN": "session"}
+		vars[key] = "abc def"
+		writeTestEnv(t, fmt.Sprintf("TELEGRAM_BOT_TOKEN=%s\nSESSION_TOKEN=%s\n%s",
+			vars["TELEGRAM_BOT_TOKEN"], vars["SESSION_TOKEN"], base))
+		if _, err := loadConfig(nil); err == nil || !strings.Contains(err.Error(), key+" must not contain spaces") {
+			t.Errorf("%s with an embedded space: err = %v, want a spaces error", key, err)
+		}
+	}
+}
+
+func TestFetchPricesGzip(t *testing.T) {
+	want := []PriceSlot{{Time: "10:00", Day: 1, FuelPrice: 420, CO2Price: 9, CO2Reported: true}}
+	client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			t.Errorf("request without gzip in Accept-Encoding")
+		}
+		var resp PriceResponse
+		resp.Data.Prices = want
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		json.NewEncoder(gz).Encode(resp)
+		gz.Close()
+	}))
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+	}{
+		{"decoded by the transport", nil},
+		{"Accept-Encoding set through API_HEADERS", map[string]string{"Accept-Encoding": "gzip, deflate"}},
+	}
+	for _, tt := range tests {
+		cfg := &Config{APIMethod: http.MethodPost, APIHeaders: tt.headers}
+		prices, err := fetchPrices(context.Background(), client, cfg)
+		if err != nil {
+			t.Errorf("%s: fetchPrices: %v", tt.name, err)
+			continue
+		}
+		if len(prices) != 1 || prices[0] != want[0] {
+			t.Errorf("%s: prices = %+v, want %+v", tt.name, prices, want)
+		}
+	}
+}
+
+func TestFetchPricesRetry(t *testing.T) {
+	type response struct {
+		status int
+		body   string
+	}
+	ok := response{200, `{"data":{"prices":[{"time":"10:00","day":1,"fuel_price":420,"co2_price":9}]}}`}
+	tests := []struct {
+		name         string
+		responses    []response // the last one repeats
+		wantRequests int
+		wantErr      error // nil for success
+		wantRetried  bool  // a transient error left after the retries
+	}{
+		{"503 that recovers", []response{{503, "Service Unavailable"}, ok}, 2, nil, false},
+		{"502 that recovers", []response{{502, "Bad Gateway"}, {500, ""}, ok}, 3, nil, false},
+		{"503 outlasting the retries", []response{{503, "Service Unavailable"}}, 3, errMaintenance, false},
+		{"500 outlasting the retries", []response{{500, "oops"}}, 3, nil, true},
+		{"maintenance page", []response{{502, "<h1>Down for Maintenance</h1>"}}, 1, errMaintenance, false},
+		{"rejected session", []response{{401, ""}}, 1, errSessionExpired, false},
+		{"other 4xx", []response{{404, "not found"}}, 1, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(requests.Add(1))
+				resp := tt.responses[min(n, len(tt.responses))-1]
+				w.WriteHeader(resp.status)
+				w.Write([]byte(resp.body))
+			}))
+			cfg := &Config{APIMethod: http.MethodPost, FetchRetries: 2, FetchBackoff: time.Millisecond}
+
+			prices, err := fetchPrices(context.Background(), client, cfg)
+			if n := int(requests.Load()); n != tt.wantRequests {
+				t.Errorf("%d requests, want %d", n, tt.wantRequests)
+			}
+			last := tt.responses[len(tt.responses)-1]
+			switch {
+			case last == ok:
+				if err != nil || len(prices) != 1 {
+					t.Errorf("fetchPrices = %+v, %v, want the prices", prices, err)
+				}
+			case tt.wantErr != nil && !errors.Is(err, tt.wantErr):
+				t.Errorf("error %v, want %v", err, tt.wantErr)
+			case err == nil:
+				t.Error("fetchPrices succeeded, want an error")
+			case tt.wantErr == nil && (errors.Is(err, errMaintenance) || errors.Is(err, errSessionExpired)):
+				t.Errorf("error %v, want a plain fetch error", err)
+			}
+			var transient *transientError
+			if got := errors.As(err, &transient); got != tt.wantRetried {
+				t.Errorf("transient error %v, want %v", got, tt.wantRetried)
+			}
+		})
+	}
+}
+
+func TestSendParseMode(t *testing.T) {
+	var got []string
+	client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		mode := r.PostForm.Get("parse_mode")
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			var raw map[string]any
+			json.NewDecoder(r.Body).Decode(&raw)
+			mode, _ = raw["parse_mode"].(string)
+		}
+		got = append(got, mode)
+		w.Write([]byte(`{"ok":true,"result":{}}`))
+	}))
+
+	tests := []struct {
+		parseMode string
+		want      string
+	}{
+		{"", "Markdown"},
+		{"HTML", "HTML"},
+		{parseModePlain, ""},
+	}
+	for _, format := range []string{"json", "form"} {
+		cfg := &Config{TelegramChatID: "-1001", TelegramSendFormat: format}
+		for _, tt := range tests {
+			got = nil
+			if _, err := sendTelegramWith(client, cfg, "hi", sendOptions{ParseMode: tt.parseMode}); err != nil {
+				t.Fatalf("sendTelegramWith: %v", err)
+			}
+			if len(got) != 1 || got[0] != tt.want {
+				t.Errorf("%s, ParseMode %q: sent parse_mode %q, want %q", format, tt.parseMode, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestHistoryRetention(t *testing.T) {
+	day := func(n int) time.Time {
+		return time.Date(2026, time.March, n, 10, 0, 0, 0, time.UTC)
+	}
+	slot := &PriceSlot{Time: "10:00", FuelPrice: 450}
+
+	tests := []struct {
+		name      string
+		retention time.Duration
+		want      []string // kept dates
+	}{
+		{"default keeps today and yesterday", 24 * time.Hour, []string{"2026-03-09", "2026-03-10"}},
+		{"3d", 3 * 24 * time.Hour, []string{"2026-03-07", "2026-03-08", "2026-03-09", "2026-03-10"}},
+	}
+	for _, tt := range tests {
+		cd := &cooldown{store: &memoryStore{}}
+		for n := 1; n <= 10; n++ {
+			recordSlotPrice(cd, day(n), slot, tt.retention)
+		}
+		var got []string
+		for key := range cd.slotHistory {
+			got = append(got, key[:len("2006-01-02")])
+		}
+		sort.Strings(got)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: kept %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// Pruning runs once a day, a record added later the same day stays
+	cd := &cooldown{store: &memoryStore{}}
+	recordSlotPrice(cd, day(10), slot, 24*time.Hour)
+	cd.slotHistory[slotHistoryKey(day(1), "10:00")] = slotRecord{FuelPrice: 500}
+	recordSlotPrice(cd, day(10).Add(time.Hour), slot, 24*time.Hour)
+	if len(cd.slotHistory) != 2 {
+		t.Errorf("pruned again on the same day, %d records left, want 2", len(cd.slotHistory))
+	}
+	recordSlotPrice(cd, day(11), slot, 24*time.Hour)
+	if _, ok := cd.slotHistory[slotHistoryKey(day(1), "10:00")]; ok {
+		t.Error("old record kept after the next day's prune")
+	}
+
+	for input, want := range map[string]time.Duration{"30d": 30 * 24 * time.Hour, "72h": 72 * time.Hour} {
+		got, err := parseDuration(map[string]string{"HISTORY_RETENTION": input}, "HISTORY_RETENTION")
+		if err != nil || got != want {
+			t.Errorf("parseDuration(%q) = %s, %v, want %s", input, got, err, want)
+		}
+	}
+	if _, err := parseDuration(map[string]string{"HISTORY_RETENTION": "xd"}, "HISTORY_RETENTION"); err == nil {
+		t.Error("parseDuration(\"xd\") accepted an invalid day count")
+	}
+}
+
+func TestResetDedupOnThresholdChange(t *testing.T) {
+	tests := []struct {
+		name                  string
+		fuelAt, co2At         int // thresholds the dedup slots were recorded under
+		fuel, co2             int // thresholds now
+		wantFuelSlot, wantCO2 string
+	}{
+		{"unchanged", 450, 10, 450, 10, "10:00-d3", "10:00-d3"},
+		{"fuel lowered mid-slot", 450, 10, 420, 10, "", "10:00-d3"},
+		{"CO2 raised", 450, 10, 450, 12, "10:00-d3", ""},
+		{"both changed", 450, 10, 400, 8, "", ""},
+		{"recorded before thresholds were tracked", 0, 0, 400, 8, "10:00-d3", "10:00-d3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{FuelThreshold: tt.fuel, CO2Threshold: tt.co2}
+			cd := &cooldown{store: &memoryStore{},
+				lastFuelSlot: "10:00-d3", lastFuelThreshold: tt.fuelAt,
+				lastCO2Slot: "10:00-d3", lastCO2Threshold: tt.co2At,
+			}
+			resetDedupOnThresholdChange(cfg, cd)
+			if cd.lastFuelSlot != tt.wantFuelSlot || cd.lastCO2Slot != tt.wantCO2 {
+				t.Errorf("dedup slots = %q, %q, want %q, %q", cd.lastFuelSlot, cd.lastCO2Slot, tt.wantFuelSlot, tt.wantCO2)
+			}
+		})
+	}
+}
+
+func TestThresholdChangeRealerts(t *testing.T) {
+	client, game := newFakeGame(t, func(current string) []PriceSlot {
+		return []PriceSlot{{Time: current, Day: 1, FuelPrice: 400, CO2Price: 50}}
+	})
+	cfg := checkConfig(t)
+	cd := &cooldown{store: &memoryStore{}}
+	setClock(t, time.Date(2026, 3, 1, 10, 5, 0, 0, time.UTC))
+
+	checkPrices(client, cfg, cd)
+	checkPrices(client, cfg, cd)
+	if n := len(game.sent()); n != 1 {
+		t.Fatalf("sent %d alerts for one slot, want 1", n)
+	}
+
+	// Restarted with a lower threshold the price still qualifies, in the same slot
+	cfg.FuelThreshold = 420
+	resetDedupOnThresholdChange(cfg, cd)
+	checkPrices(client, cfg, cd)
+	if n := len(game.sent()); n != 2 {
+		t.Errorf("sent %d alerts after the threshold change, want a second one", n)
+	}
+}
+
+func TestReloadConfigTimezone(t *testing.T) {
+	t.Cleanup(func() { os.Remove(cooldownFilePath()) })
+	base := "TELEGRAM_BOT_TOKEN=123:abc\nTELEGRAM_CHAT_ID=-1001\nSESSION_TOKEN=session\nCO2_THRESHOLD=10\n"
+	writeTestEnv(t, base+"FUEL_THRESHOLD=450\nTIMEZONE=UTC\n")
+	cfg, err := loadConfig(nil)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	ensureTimezones(cfg)
+	cd := &cooldown{store: &memoryStore{}, lastFuelSlot: "10:00-d1", lastFuelThreshold: 450}
+
+	writeTestEnv(t, base+"FUEL_THRESHOLD=420\nTIMEZONE=Europe/Berlin\nSLOT_MINUTES=15\n")
+	reloaded, err := reloadConfig(cfg, cd, nil)
+	if err != nil {
+		t.Fatalf("reloadConfig: %v", err)
+	}
+
+	at := time.Date(2026, time.July, 1, 12, 0, 0, 0, time.UTC)
+	if got := formatCooldownTime(at, reloaded.Timezone); got != "2026-07-01 14:00:00" {
+		t.Errorf("formatted with the reloaded timezone = %q, want Berlin time", got)
+	}
+	if got := formatCooldownTime(at, cfg.Timezone); got != "2026-07-01 12:00:00" {
+		t.Errorf("old config changed by the reload, formats %q", got)
+	}
+	if reloaded.FuelThreshold != 420 || cd.lastFuelSlot != "" {
+		t.Errorf("FUEL_THRESHOLD = %d, dedup slot %q, want 420 and the dedup reset", reloaded.FuelThreshold, cd.lastFuelSlot)
+	}
+	if reloaded.SlotMinutes != 30 {
+		t.Errorf("SlotMinutes = %d, want 30 kept until a restart", reloaded.SlotMinutes)
+	}
+
+	// A broken config is rejected and leaves the running one in place
+	writeTestEnv(t, base+"FUEL_THRESHOLD=cheap\n")
+	if _, err := reloadConfig(reloaded, cd, nil); err == nil {
+		t.Error("reloadConfig accepted an invalid FUEL_THRESHOLD")
+	}
+}
+
+func TestReloadConfigRefetchesRemote(t *testing.T) {
+	t.Cleanup(func() {
+		os.Remove(cooldownFilePath())
+		os.Remove(remoteConfigCachePath())
+	})
+
+	var mu sync.Mutex
+	remote := "FUEL_THRESHOLD=400\n"
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fetches++
+		w.Write([]byte(remote))
+	}))
+	defer server.Close()
+
+	writeTestEnv(t, "TELEGRAM_BOT_TOKEN=123:abc\nTELEGRAM_CHAT_ID=-1001\nSESSION_TOKEN=session\n"+
+		"FUEL_THRESHOLD=450\nCO2_THRESHOLD=10\nCONFIG_URL="+server.URL+"\n")
+	cfg, err := loadConfig(nil)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	ensureTimezones(cfg)
+	if cfg.FuelThreshold != 400 {
+		t.Fatalf("FUEL_THRESHOLD = %d, want 400 from CONFIG_URL", cfg.FuelThreshold)
+	}
+
+	mu.Lock()
+	remote = "FUEL_THRESHOLD=380\n"
+	mu.Unlock()
+	reloaded, err := reloadConfig(cfg, &cooldown{store: &memoryStore{}}, nil)
+	if err != nil {
+		t.Fatalf("reloadConfig: %v", err)
+	}
+	if reloaded.FuelThreshold != 380 || fetches != 2 {
+		t.Errorf("after reload FUEL_THRESHOLD = %d with %d fetches, want 380 fetched again", reloaded.FuelThreshold, fetches)
+	}
+}
+
+func TestCheckPricesAlerts(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		price PriceSlot
+	)
+	client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var resp PriceResponse
+		slot := price
+		slot.Time = slotTime(timeNow().UTC(), 30)
+		resp.Data.Prices = []PriceSlot{slot}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	cfg := checkConfig(t)
+	notifier := &recordingNotifier{}
+	cfg.Notifier = notifier
+	store := &memoryStore{}
+	cd := &cooldown{store: store}
+
+	steps := []struct {
+		name      string
+		at        string
+		fuel, co2 int
+		want      string // start of the expected alert, "" for none
+	}{
+		{"first alert", "10:05", 400, 50, "*Ahoy, Captain!*\n\nFuel prices"},
+		{"repeat in the same slot", "10:20", 400, 50, ""},
+		{"new slot alerts again", "10:35", 400, 50, "*Ahoy, Captain!*\n\nFuel prices"},
+		{"both green combined", "11:05", 400, 8, "*Great news, Captain!*"},
+		{"both repeated in the same slot", "11:25", 400, 8, ""},
+	}
+	for _, step := range steps {
+		at, err := time.Parse("15:04", step.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		setClock(t, time.Date(2026, 3, 1, at.Hour(), at.Minute(), 0, 0, time.UTC))
+		mu.Lock()
+		price = PriceSlot{Day: 1, FuelPrice: step.fuel, CO2Price: step.co2}
+		mu.Unlock()
+
+		before := len(notifier.sent())
+		checkPrices(client, cfg, cd)
+		sent := notifier.sent()[before:]
+		if step.want == "" {
+			if len(sent) != 0 {
+				t.Errorf("%s: sent %q, want no alert", step.name, sent)
+			}
+			continue
+		}
+		if len(sent) != 1 || !strings.HasPrefix(sent[0], step.want) {
+			t.Errorf("%s: sent %q, want one alert starting with %q", step.name, sent, step.want)
+		}
+	}
+
+	if cd.lastFuelSlot != "11:00-d1" || cd.lastCO2Slot != "11:00-d1" {
+		t.Errorf("marked slots fuel %q, CO2 %q, want 11:00-d1", cd.lastFuelSlot, cd.lastCO2Slot)
+	}
+	if store.state == nil || store.state.LastFuelSlot != "11:00-d1" {
+		t.Errorf("saved state = %+v, want the last alerted slot", store.state)
+	}
+}
+
+func TestCheckWaitSpread(t *testing.T) {
+	client, game := newFakeGame(t, nil)
+	cfg := checkConfig(t)
+	cfg.WaitSpread = 50
+	cd := &cooldown{}
+
+	current := PriceSlot{Time: "10:00", Day: 1, FuelPrice: 500, CO2Price: 9}
+	prices := []PriceSlot{
+		// Cheaper, but already past
+		{Time: "09:30", Day: 1, FuelPrice: 300, CO2Price: 9},
+		current,
+		{Time: "10:30", Day: 1, FuelPrice: 480, CO2Price: 9},
+		{Time: "11:00", Day: 1, FuelPrice: 420, CO2Price: 9},
+		{Time: "11:30", Day: 1, FuelPrice: 460, CO2Price: 9},
+	}
+	checkWaitSpread(client, cfg, cd, prices, &current)
+	sent := game.sent()
+	if len(sent) != 1 || !strings.Contains(sent[0], "drops to *$420/t* at 11:00") {
+		t.Fatalf("sent %q, want one advisory for the 11:00 minimum", sent)
+	}
+
+	// The same minimum on the next check is not advised again
+	checkWaitSpread(client, cfg, cd, prices, &current)
+	if n := len(game.sent()); n != 1 {
+		t.Errorf("sent %d messages, want the 11:00 advisory only once", n)
+	}
+
+	// A new, lower minimum further ahead is advised
+	prices[4].FuelPrice = 400
+	checkWaitSpread(client, cfg, cd, prices, &current)
+	sent = game.sent()
+	if len(sent) != 2 || !strings.Contains(sent[1], "drops to *$400/t* at 11:30") {
+		t.Errorf("sent %q, want a second advisory for the 11:30 minimum", sent)
+	}
+
+	// Only earlier slots are cheap enough, nothing to wait for
+	cd.lastWait = ""
+	prices[3].FuelPrice, prices[4].FuelPrice = 470, 490
+	checkWaitSpread(client, cfg, cd, prices, &current)
+	if n := len(game.sent()); n != 2 {
+		t.Errorf("sent %d messages, want no advisory for a cheaper past slot", n)
+	}
+}
+
+func TestParseThreshold(t *testing.T) {
+	tests := []struct {
+		value     string
+		low, high int
+		err       string
+	}{
+		{"450", 0, 450, ""},
+		{"380-420", 380, 420, ""},
+		{"380 - 420", 380, 420, ""},
+		{"420-380", 0, 0, "0 < LOW < HIGH"},
+		{"400-400", 0, 0, "0 < LOW < HIGH"},
+		{"0-5", 0, 0, "0 < LOW < HIGH"},
+		{"380-", 0, 0, "a range like 380-420"},
+		{"cheap", 0, 0, "must be a number"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			low, high, err := parseThreshold(map[string]string{"FUEL_THRESHOLD": tt.value}, "FUEL_THRESHOLD")
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("error %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseThreshold: %v", err)
+			}
+			if low != tt.low || high != tt.high {
+				t.Errorf("got %d-%d, want %d-%d", low, high, tt.low, tt.high)
+			}
+		})
+	}
+}
+
+func TestBuyZoneNote(t *testing.T) {
+	cfg := &Config{FuelZoneLow: 380, FuelThreshold: 420, CO2Threshold: 10, PriceUnit: "/t"}
+	tests := []struct {
+		name  string
+		price int
+		want  string
+	}{
+		{"below the zone", 370, "\n\nFuel is below your buy zone ($380/t-$420/t), even better!"},
+		{"at the bottom", 380, "\n\nFuel is entering your buy zone ($380/t-$420/t)."},
+		{"inside", 400, "\n\nFuel is entering your buy zone ($380/t-$420/t)."},
+		{"at the top", 420, "\n\nFuel is entering your buy zone ($380/t-$420/t)."},
+		{"above", 421, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slot := &PriceSlot{FuelPrice: tt.price, CO2Price: 5}
+			if got := buyZoneNote(cfg, slot, true, false); got != tt.want {
+				t.Errorf("buyZoneNote = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// A plain threshold has no zone to describe
+	if got := buyZoneNote(cfg, &PriceSlot{FuelPrice: 400, CO2Price: 5}, false, true); got != "" {
+		t.Errorf("buyZoneNote for CO2 without a zone = %q, want none", got)
+	}
+}
+
+func TestFreeCO2Checks(t *testing.T) {
+	client, game := newFakeGame(t, nil)
+	cfg := checkConfig(t)
+	cfg.CO2AllowZero = true
+	cfg.RecordLowAlert = true
+	free := &PriceSlot{Time: "10:00", Day: 1, FuelPrice: 400, CO2Price: 0, CO2Reported: true}
+
+	// Free CO2 is a new record low, and stays the record for later paid prices
+	cd := &cooldown{recordFuel: 380, recordCO2: 5}
+	checkRecordLow(client, cfg, cd, free)
+	if cd.recordCO2 != 0 || !cd.recordCO2Free {
+		t.Errorf("record CO2 %d (free %v), want the free price as record", cd.recordCO2, cd.recordCO2Free)
+	}
+	if sent := game.sent(); len(sent) != 1 || !strings.Contains(sent[0], "CO2: *$0/t*") {
+		t.Errorf("sent %q, want one record low alert for free CO2", sent)
+	}
+	checkRecordLow(client, cfg, cd, &PriceSlot{Time: "10:30", Day: 1, FuelPrice: 400, CO2Price: 3, CO2Reported: true})
+	if cd.recordCO2 != 0 || !cd.recordCO2Free || len(game.sent()) != 1 {
+		t.Errorf("a paid price replaced the free record (record %d, free %v)", cd.recordCO2, cd.recordCO2Free)
+	}
+
+	// A fuel - CO2 spread still exists, a ratio doesn't
+	maxSpread := 300.0
+	cfg.SpreadMax = &maxSpread
+	cfg.SpreadMode = "diff"
+	checkSpread(client, cfg, cd, free, "10:00-d1")
+	if cd.lastSpread != "10:00-d1" {
+		t.Errorf("no spread alert for free CO2 in diff mode")
+	}
+	cfg.SpreadMode = "ratio"
+	cd.lastSpread = ""
+	checkSpread(client, cfg, cd, free, "10:00-d1")
+	if cd.lastSpread != "" {
+		t.Errorf("spread alert for a fuel/CO2 ratio with free CO2")
+	}
+
+	formula, err := parseFormula("fuel + 10*co2 <= 450")
+	if err != nil {
+		t.Fatalf("parseFormula: %v", err)
+	}
+	cfg.AlertFormula = formula
+	checkFormula(client, cfg, cd, free, "10:00-d1")
+	if cd.lastFormula != "10:00-d1" {
+		t.Errorf("free CO2 did not count for ALERT_FORMULA")
+	}
+
+	text := forecastText(cfg, []PriceSlot{*free}, free, time.Now(), cfg.FuelThreshold, cfg.CO2Threshold)
+	if !strings.Contains(text, "CO2 $0/t ✅") {
+		t.Errorf("pinned forecast doesn't mark free CO2 green:\n%s", text)
+	}
+
+	// Without CO2_ALLOW_ZERO a zero price is missing data
+	cfg.CO2AllowZero = false
+	text = forecastText(cfg, []PriceSlot{*free}, free, time.Now(), cfg.FuelThreshold, cfg.CO2Threshold)
+	if strings.Contains(text, "CO2 $0/t ✅") {
+		t.Errorf("pinned forecast marks a zero CO2 price green without CO2_ALLOW_ZERO:\n%s", text)
+	}
+}
+
+func TestCO2AllowZero(t *testing.T) {
+	tests := []struct {
+		name      string
+		json      string
+		allowZero bool
+		want      bool
+	}{
+		{"positive price", `{"time":"10:00","co2_price":9}`, false, true},
+		{"zero without CO2_ALLOW_ZERO", `{"time":"10:00","co2_price":0}`, false, false},
+		{"explicit zero", `{"time":"10:00","co2_price":0}`, true, true},
+		{"missing field", `{"time":"10:00"}`, true, false},
+		{"null field", `{"time":"10:00","co2_price":null}`, true, false},
+		{"negative price", `{"time":"10:00","co2_price":-1}`, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var slot PriceSlot
+			if err := json.Unmarshal([]byte(tt.json), &slot); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if slot.Time != "10:00" {
+				t.Errorf("Time = %q, the other fields must still decode", slot.Time)
+			}
+			cfg := &Config{CO2AllowZero: tt.allowZero}
+			if got := co2Valid(cfg, &slot); got != tt.want {
+				t.Errorf("co2Valid = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	t.Cleanup(func() { os.Remove(remoteConfigCachePath()) })
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.env")
+	override := filepath.Join(dir, "override.env")
+	os.WriteFile(base, []byte(strings.Join([]string{
+		"TELEGRAM_BOT_TOKEN=123:abc",
+		"TELEGRAM_CHAT_ID=-1001",
+		"SESSION_TOKEN=session",
+		"FUEL_THRESHOLD=500",
+		"CO2_THRESHOLD=12",
+		"SLOT_MINUTES=30",
+	}, "\n")), 0600)
+	os.WriteFile(override, []byte("FUEL_THRESHOLD=450\nCO2_THRESHOLD=11\nSLOT_MINUTES=15\n"), 0600)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("FUEL_THRESHOLD=400\nCO2_THRESHOLD=9\n"))
+	}))
+	defer server.Close()
+
+	t.Setenv("FUEL_THRESHOLD", "420")
+	t.Setenv("CONFIG_URL", server.URL)
+
+	cfg, err := loadConfig([]string{base, override})
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+
+	tests := []struct {
+		setting   string
+		got, want int
+	}{
+		{"FUEL_THRESHOLD (every source, environment wins)", cfg.FuelThreshold, 420},
+		{"CO2_THRESHOLD (files and CONFIG_URL)", cfg.CO2Threshold, 9},
+		{"SLOT_MINUTES (later file wins)", cfg.SlotMinutes, 15},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %d, want %d", tt.setting, tt.got, tt.want)
+		}
+	}
+}
+
+func TestEnvironmentVars(t *testing.T) {
+	t.Setenv("CO2_THRESHOLD", "10")
+	t.Setenv("SESSION_TOKEN_FILE", "/run/secrets/session")
+	t.Setenv("CO2_TRESHOLD", "10")
+	env := environmentVars()
+	if env["CO2_THRESHOLD"] != "10" || env["SESSION_TOKEN_FILE"] != "/run/secrets/session" {
+		t.Errorf("environmentVars() = %v, want the config settings", env)
+	}
+	for _, key := range []string{"CO2_TRESHOLD", "PATH", "HOME"} {
+		if _, ok := env[key]; ok {
+			t.Errorf("environmentVars() contains %s, want only config settings", key)
+		}
+	}
+
+	// Every setting documented in .env.example can be set from the environment
+	data, err := os.ReadFile(".env.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	known := make(map[string]bool)
+	for _, key := range configKeys {
+		known[key] = true
+	}
+	for _, key := range secretFileKeys {
+		known[key+"_FILE"] = true
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		key, _, ok := strings.Cut(strings.TrimLeft(line, "# "), "=")
+		if ok && key != "" && key == strings.ToUpper(key) && !strings.Contains(key, " ") && !known[key] {
+			t.Errorf(".env.example documents %s, which is missing from configKeys", key)
+		}
+	}
+}
+
+// testVars returns the minimal settings configFromVars accepts, with extra laid over them
+func testVars(extra map[string]string) map[string]string {
+	vars := map[string]string{
+		"TELEGRAM_BOT_TOKEN": "123:abc",
+		"TELEGRAM_CHAT_ID":   "-1001",
+		"SESSION_TOKEN":      "session",
+		"FUEL_THRESHOLD":     "450",
+		"CO2_THRESHOLD":      "10",
+	}
+	for key, value := range extra {
+		vars[key] = value
+	}
+	return vars
+}
+
+func TestUserAgentRotation(t *testing.T) {
+	tests := []struct {
+		name     string
+		vars     map[string]string
+		pool     []string
+		distinct func(n int) bool
+	}{
+		{"off", nil, []string{defaultAPIHeaders["User-Agent"]}, func(n int) bool { return n == 1 }},
+		{"request, default pool", map[string]string{"USER_AGENT_ROTATE": "request"}, defaultUserAgents, func(n int) bool { return n > 1 }},
+		{"request, own pool", map[string]string{"USER_AGENT_ROTATE": "request", "USER_AGENT_POOL": "Agent A | Agent B|Agent C"}, []string{"Agent A", "Agent B", "Agent C"}, func(n int) bool { return n > 1 }},
+		{"process", map[string]string{"USER_AGENT_ROTATE": "process", "USER_AGENT_POOL": "Agent A|Agent B"}, []string{"Agent A", "Agent B"}, func(n int) bool { return n == 1 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := configFromVars(testVars(tt.vars))
+			if err != nil {
+				t.Fatalf("configFromVars: %v", err)
+			}
+
+			var mu sync.Mutex
+			seen := map[string]int{}
+			client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				seen[r.Header.Get("User-Agent")]++
+				mu.Unlock()
+				w.Write([]byte(`{"data":{"prices":[]}}`))
+			}))
+			for range 40 {
+				if _, err := fetchPrices(context.Background(), client, cfg); err != nil {
+					t.Fatalf("fetchPrices: %v", err)
+				}
+			}
+
+			for agent := range seen {
+				if !slices.Contains(tt.pool, agent) {
+					t.Errorf("User-Agent %q is not in the pool %q", agent, tt.pool)
+				}
+			}
+			if !tt.distinct(len(seen)) {
+				t.Errorf("%d distinct User-Agents over 40 requests: %v", len(seen), seen)
+			}
+		})
+	}
+}
+
+func TestUserAgentPoolErrors(t *testing.T) {
+	for _, vars := range []map[string]string{
+		{"USER_AGENT_ROTATE": "always"},
+		{"USER_AGENT_ROTATE": "request", "USER_AGENT_POOL": " | "},
+	} {
+		if _, err := configFromVars(testVars(vars)); err == nil {
+			t.Errorf("configFromVars(%v) succeeded, want an error", vars)
+		}
+	}
+}
+
+func TestUseFirstSlot(t *testing.T) {
+	// The first forecast slot is cheap, the current one is not
+	setClock(t, time.Date(2026, 3, 1, 10, 5, 0, 0, time.UTC))
+	client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var resp PriceResponse
+		resp.Data.Prices = []PriceSlot{
+			{Time: "09:30", Day: 1, FuelPrice: 400, CO2Price: 20},
+			{Time: "10:00", Day: 1, FuelPrice: 600, CO2Price: 20},
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+
+	tests := []struct {
+		useFirstSlot bool
+		wantFuel     int
+		wantAlert    bool
+	}{
+		{false, 600, false},
+		{true, 400, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("USE_FIRST_SLOT=%v", tt.useFirstSlot), func(t *testing.T) {
+			cfg := checkConfig(t)
+			cfg.UseFirstSlot = tt.useFirstSlot
+			notifier := &recordingNotifier{}
+			cfg.Notifier = notifier
+			cd := &cooldown{store: &memoryStore{}}
+			checkPrices(client, cfg, cd)
+
+			if cd.lastPrices == nil || cd.lastPrices.FuelPrice != tt.wantFuel {
+				t.Fatalf("checked prices = %+v, want fuel $%d/t", cd.lastPrices, tt.wantFuel)
+			}
+			if sent := notifier.sent(); (len(sent) == 1) != tt.wantAlert {
+				t.Errorf("sent %d alerts, want alert: %v", len(sent), tt.wantAlert)
+			}
+		})
+	}
+}
+
+func TestGreenStreak(t *testing.T) {
+	type check struct {
+		slot  string
+		green bool
+	}
+	tests := []struct {
+		name      string
+		checks    []check
+		wantCount int
+	}{
+		{"three green slots", []check{{"10:00-d1", true}, {"10:30-d1", true}, {"11:00-d1", true}}, 3},
+		{"same slot counts once", []check{{"10:00-d1", true}, {"10:00-d1", true}, {"10:30-d1", true}}, 2},
+		{"red resets", []check{{"10:00-d1", true}, {"10:30-d1", true}, {"11:00-d1", false}, {"11:30-d1", true}}, 1},
+		{"red at the end", []check{{"10:00-d1", true}, {"10:30-d1", false}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s greenStreak
+			for _, c := range tt.checks {
+				s.update(c.slot, c.green)
+			}
+			if s.Count != tt.wantCount {
+				t.Errorf("Count = %d, want %d", s.Count, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestConfirmSlots(t *testing.T) {
+	setClock(t, time.Date(2026, 3, 1, 10, 5, 0, 0, time.UTC))
+	var mu sync.Mutex
+	fuel, co2 := 400, 5
+	client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var resp PriceResponse
+		resp.Data.Prices = []PriceSlot{{Time: "10:00", Day: 1, FuelPrice: fuel, CO2Price: co2}}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	cfg := checkConfig(t)
+	cfg.FuelConfirmSlots, cfg.CO2ConfirmSlots = 2, 3
+	notifier := &recordingNotifier{}
+	cfg.Notifier = notifier
+	cd := &cooldown{store: &memoryStore{}}
+
+	// Fuel was already green in the previous slot, CO2 was not
+	cd.fuelStreak = greenStreak{Slot: "earlier", Count: 1}
+	checkPrices(client, cfg, cd)
+
+	sent := notifier.sent()
+	if len(sent) != 1 || !strings.Contains(sent[0], "Fuel") || strings.Contains(sent[0], "CO2") {
+		t.Fatalf("alerts = %q, want one fuel-only alert", sent)
+	}
+	if cd.fuelStreak.Count != 2 || cd.co2Streak.Count != 1 {
+		t.Errorf("streaks = fuel %d, co2 %d, want 2 and 1", cd.fuelStreak.Count, cd.co2Streak.Count)
+	}
+
+	// CO2 is one slot short of its confirmation
+	cd.co2Streak = greenStreak{Slot: "earlier", Count: 1}
+	checkPrices(client, cfg, cd)
+	if n := len(notifier.sent()); n != 1 {
+		t.Errorf("sent %d alerts, want CO2 still waiting at 2 of 3 slots", n)
+	}
+
+	// A red price resets each streak on its own
+	mu.Lock()
+	fuel = 600
+	mu.Unlock()
+	checkPrices(client, cfg, cd)
+	if cd.fuelStreak.Count != 0 || cd.co2Streak.Count != 2 {
+		t.Errorf("streaks after red fuel = fuel %d, co2 %d, want 0 and 2", cd.fuelStreak.Count, cd.co2Streak.Count)
+	}
+}
+
+func TestSentMessageFixture(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "sendMessage.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp TelegramResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		t.Fatalf("decode sendMessage response: %v", err)
+	}
+	sent, err := resp.sentMessage()
+	if err != nil {
+		t.Fatalf("sentMessage: %v", err)
+	}
+	if !resp.OK || sent.MessageID != 4711 || sent.Chat.ID != -1001234567890 {
+		t.Errorf("sent message = %+v (ok %v), want message 4711 in chat -1001234567890", sent, resp.OK)
+	}
+
+	// pinChatMessage answers with result true instead of a message
+	resp = TelegramResponse{Result: json.RawMessage("true")}
+	if _, err := resp.sentMessage(); err == nil {
+		t.Error("sentMessage of a boolean result succeeded, want an error")
+	}
+}
+
+func TestMarketHours(t *testing.T) {
+	at := func(clock string) time.Time {
+		t, _ := time.Parse("15:04", clock)
+		return t
+	}
+	tests := []struct {
+		window  string
+		inside  []string
+		outside []string
+	}{
+		{"08:00-18:00", []string{"08:00", "12:30", "17:59"}, []string{"07:59", "18:00", "23:00"}},
+		{"22:00-06:00", []string{"22:00", "23:59", "00:00", "05:59"}, []string{"06:00", "12:00", "21:59"}},
+		{"12:00-24:00", []string{"12:00", "23:59"}, []string{"00:00", "11:59"}},
+		{"00:00-24:00", []string{"00:00", "12:00", "23:59"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.window, func(t *testing.T) {
+			w, err := parseHoursWindow(map[string]string{"MARKET_HOURS": tt.window}, "MARKET_HOURS")
+			if err != nil {
+				t.Fatalf("parseHoursWindow: %v", err)
+			}
+			for _, clock := range tt.inside {
+				if !w.contains(at(clock)) {
+					t.Errorf("%s is outside, want inside", clock)
+				}
+			}
+			for _, clock := range tt.outside {
+				if w.contains(at(clock)) {
+					t.Errorf("%s is inside, want outside", clock)
+				}
+			}
+		})
+	}
+}
+
+func TestMarketHoursInvalid(t *testing.T) {
+	for _, window := range []string{"08:00", "08:00-08:00", "8-18", "08:00-25:00", "-18:00"} {
+		if _, err := parseHoursWindow(map[string]string{"MARKET_HOURS": window}, "MARKET_HOURS"); err == nil {
+			t.Errorf("MARKET_HOURS=%q parsed, want an error", window)
+		}
+	}
+}
+
+func TestMarketHoursSlotTimezone(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 19:05 in SLOT_TIMEZONE, 10:05 in UTC where the check would fall if it
+	// ignored SLOT_TIMEZONE
+	setClock(t, time.Date(2026, 3, 1, 10, 5, 0, 0, time.UTC))
+
+	for _, tt := range []struct {
+		window    string
+		wantCheck bool
+	}{{"19:00-20:00", true}, {"10:00-11:00", false}} {
+		t.Run(tt.window, func(t *testing.T) {
+			var requests atomic.Int32
+			client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.Write([]byte(`{"data":{"prices":[]}}`))
+			}))
+			cfg := checkConfig(t)
+			cfg.SlotTimezone = tokyo
+			cfg.MarketHours, err = parseHoursWindow(map[string]string{"MARKET_HOURS": tt.window}, "MARKET_HOURS")
+			if err != nil {
+				t.Fatalf("parseHoursWindow: %v", err)
+			}
+			checkPrices(client, cfg, &cooldown{store: &memoryStore{}})
+			if checked := requests.Load() > 0; checked != tt.wantCheck {
+				t.Errorf("price API requested: %v, want %v", checked, tt.wantCheck)
+			}
+		})
+	}
+}
+
+func TestPriceDropWithinSlot(t *testing.T) {
+	setClock(t, time.Date(2026, 3, 1, 10, 5, 0, 0, time.UTC))
+	var fuel atomic.Int32
+	client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var resp PriceResponse
+		resp.Data.Prices = []PriceSlot{{Time: "10:00", Day: 1, FuelPrice: int(fuel.Load()), CO2Price: 20}}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	cfg := checkConfig(t)
+	notifier := &recordingNotifier{}
+	cfg.Notifier = notifier
+	cd := &cooldown{store: &memoryStore{}}
+
+	checks := []struct {
+		fuel       int32
+		wantAlerts int
+	}{
+		{500, 0}, // above threshold at the first check
+		{420, 1}, // the API updated the slot, the drop alerts
+		{400, 1}, // the slot was alerted, no repeat
+	}
+	for i, c := range checks {
+		fuel.Store(c.fuel)
+		checkPrices(client, cfg, cd)
+		if n := len(notifier.sent()); n != c.wantAlerts {
+			t.Fatalf("check %d at $%d/t: %d alerts sent, want %d", i+1, c.fuel, n, c.wantAlerts)
+		}
+	}
+}
+
+func TestRecheckAfterLimit(t *testing.T) {
+	tests := []struct {
+		recheck     string
+		slotMinutes string
+		wantErr     bool
+	}{
+		{"15m", "30", false},
+		{"28m", "30", false},
+		{"29m", "30", true},
+		{"20m", "15", true},
+		{"45m", "60", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.recheck+"/"+tt.slotMinutes, func(t *testing.T) {
+			_, err := configFromVars(testVars(map[string]string{"RECHECK_AFTER": tt.recheck, "SLOT_MINUTES": tt.slotMinutes}))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("configFromVars error = %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestImproved(t *testing.T) {
+	tests := []struct {
+		price, last, margin int
+		want                bool
+	}{
+		{420, 0, 0, true}, // first alert of the streak
+		{419, 420, 0, true},
+		{420, 420, 0, false},
+		{430, 420, 0, false},
+		{415, 420, 5, false},
+		{414, 420, 5, true},
+	}
+	for _, tt := range tests {
+		if got := improved(tt.price, tt.last, tt.margin); got != tt.want {
+			t.Errorf("improved(%d, last %d, margin %d) = %v, want %v", tt.price, tt.last, tt.margin, got, tt.want)
+		}
+	}
+}
+
+func TestImprovementOnly(t *testing.T) {
+	setClock(t, time.Date(2026, 3, 1, 10, 5, 0, 0, time.UTC))
+	var fuel atomic.Int32
+	client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var resp PriceResponse
+		resp.Data.Prices = []PriceSlot{{Time: "10:00", Day: 1, FuelPrice: int(fuel.Load()), CO2Price: 20}}
+		json.NewEncoder(w).Encode(resp)
+	}))
+
+	tests := []struct {
+		name      string
+		margin    int
+		fuel      int32
+		wantAlert bool
+	}{
+		{"flat", 0, 420, false},
+		{"worse", 0, 430, false},
+		{"better", 0, 410, true},
+		{"better within margin", 15, 410, false},
+		{"better beyond margin", 5, 410, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := checkConfig(t)
+			cfg.ImprovementOnly, cfg.ImprovementMargin = true, tt.margin
+			notifier := &recordingNotifier{}
+			cfg.Notifier = notifier
+			// Alerted at $420/t in the previous slot of the same streak
+			cd := &cooldown{store: &memoryStore{}, lastFuelSlot: "earlier", lastFuelAlertPrice: 420}
+			fuel.Store(tt.fuel)
+
+			checkPrices(client, cfg, cd)
+			if alerted := len(notifier.sent()) == 1; alerted != tt.wantAlert {
+				t.Errorf("alerted: %v, want %v", alerted, tt.wantAlert)
+			}
+			wantStored := 420
+			if tt.wantAlert {
+				wantStored = int(tt.fuel)
+			}
+			if cd.lastFuelAlertPrice != wantStored {
+				t.Errorf("last alerted price = $%d/t, want $%d/t", cd.lastFuelAlertPrice, wantStored)
+			}
+		})
+	}
+}
+
+func TestImprovementOnlyStreakEnds(t *testing.T) {
+	setClock(t, time.Date(2026, 3, 1, 10, 5, 0, 0, time.UTC))
+	var fuel atomic.Int32
+	client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var resp PriceResponse
+		resp.Data.Prices = []PriceSlot{{Time: "10:00", Day: 1, FuelPrice: int(fuel.Load()), CO2Price: 20}}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	cfg := checkConfig(t)
+	cfg.ImprovementOnly = true
+	notifier := &recordingNotifier{}
+	cfg.Notifier = notifier
+	cd := &cooldown{store: &memoryStore{}, lastFuelSlot: "earlier", lastFuelAlertPrice: 420}
+
+	// Going above threshold ends the streak and forgets the alerted price
+	fuel.Store(500)
+	checkPrices(client, cfg, cd)
+	if cd.lastFuelAlertPrice != 0 {
+		t.Fatalf("last alerted price = $%d/t after a red check, want it reset", cd.lastFuelAlertPrice)
+	}
+
+	// So the next streak alerts even above the old alert price
+	fuel.Store(440)
+	checkPrices(client, cfg, cd)
+	if sent := notifier.sent(); len(sent) != 1 || cd.lastFuelAlertPrice != 440 {
+		t.Errorf("sent %d alerts, last alerted $%d/t, want one alert at $440/t", len(sent), cd.lastFuelAlertPrice)
+	}
+}
+
+func TestSetThresholdResetsDedup(t *testing.T) {
+	cfg := &Config{FuelThreshold: 450, CO2Threshold: 10, PriceUnit: "/t"}
+	cd := &cooldown{store: &memoryStore{}, lastFuelSlot: "10:00-d3", lastFuelThreshold: 450}
+
+	// The slot alerted under $450/t is evaluated again under the lowered threshold
+	setThreshold(cfg, cd, []string{"440"}, "fuel")
+	if cfg.FuelThreshold != 440 {
+		t.Fatalf("FuelThreshold = %d, want 440", cfg.FuelThreshold)
+	}
+	if cd.lastFuelSlot != "" {
+		t.Errorf("fuel dedup slot = %q after the threshold change, want it cleared", cd.lastFuelSlot)
+	}
+}
+
+func TestReloadKeepsSetThreshold(t *testing.T) {
+	t.Cleanup(func() { os.Remove(cooldownFilePath()) })
+	base := "TELEGRAM_BOT_TOKEN=123:abc\nTELEGRAM_CHAT_ID=-1001\nSESSION_TOKEN=session\nCO2_THRESHOLD=10\n"
+	writeTestEnv(t, base+"FUEL_THRESHOLD=450\n")
+	cfg, err := loadConfig(nil)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	cd := &cooldown{store: &memoryStore{}}
+	setThreshold(cfg, cd, []string{"400"}, "fuel")
+
+	// A reload with the same .env threshold keeps the value set by command
+	reloaded, err := reloadConfig(cfg, cd, nil)
+	if err != nil {
+		t.Fatalf("reloadConfig: %v", err)
+	}
+	if reloaded.FuelThreshold != 400 {
+		t.Errorf("FuelThreshold after reload = %d, want the /setfuel 400 kept", reloaded.FuelThreshold)
+	}
+
+	// Editing the .env threshold wins over it
+	writeTestEnv(t, base+"FUEL_THRESHOLD=420\n")
+	reloaded, err = reloadConfig(reloaded, cd, nil)
+	if err != nil {
+		t.Fatalf("reloadConfig: %v", err)
+	}
+	if reloaded.FuelThreshold != 420 || cd.setFuel != nil {
+		t.Errorf("FuelThreshold after the .env edit = %d, override %v, want 420 and the override dropped", reloaded.FuelThreshold, cd.setFuel)
+	}
+}
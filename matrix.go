@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// matrixNotifier posts to a Matrix room through the client-server API
+type matrixNotifier struct {
+	homeserver string
+	room       string
+	token      string
+	maxLogBody int
+}
+
+// matrixMessage is the m.room.message event content
+type matrixMessage struct {
+	MsgType       string `json:"msgtype"`
+	Body          string `json:"body"`
+	Format        string `json:"format,omitempty"`
+	FormattedBody string `json:"formatted_body,omitempty"`
+}
+
+func (n *matrixNotifier) Send(client *http.Client, message string, opts sendOptions) error {
+	content := matrixMessage{
+		MsgType:       "m.text",
+		Body:          markdownToPlain(message),
+		Format:        "org.matrix.custom.html",
+		FormattedBody: markdownToHTML(message),
+	}
+	// Only Markdown is converted, anything else goes out as plain text
+	if telegramParseMode(opts) != defaultParseMode {
+		content = matrixMessage{MsgType: "m.text", Body: message}
+	}
+	// Matrix has no silent flag, bots send notices which clients don't ping for
+	if opts.Silent {
+		content.MsgType = "m.notice"
+	}
+
+	jsonData, err := json.Marshal(content)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	txnID := fmt.Sprintf("%d-%d", time.Now().UnixNano(), messageSeq.Add(1))
+	apiURL := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		strings.TrimRight(n.homeserver, "/"), url.PathEscape(n.room), txnID)
+	req, err := http.NewRequest(http.MethodPut, apiURL, strings.NewReader(string(jsonData)))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+n.token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Matrix request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read Matrix response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			ErrCode string `json:"errcode"`
+			Error   string `json:"error"`
+		}
+		if json.Unmarshal(body, &errResp) == nil && errResp.ErrCode != "" {
+			return fmt.Errorf("Matrix API error (status %d): %s %s", resp.StatusCode, errResp.ErrCode, errResp.Error)
+		}
+		return fmt.Errorf("Matrix API returned status %d: %s", resp.StatusCode, truncateBody(body, n.maxLogBody))
+	}
+
+	log.Println("Matrix message sent successfully")
+	return nil
+}
+
+func (n *matrixNotifier) Target() string {
+	return fmt.Sprintf("Matrix room %s on %s", n.room, n.homeserver)
+}
+
+// markdownPattern matches the Telegram Markdown the bot writes: [text](url),
+// *bold*, _italic_ and `code`. One pass, so underscores inside a link URL are
+// not taken for italics.
+var markdownPattern = regexp.MustCompile("\\[([^\\]]+)\\]\\(([^)]+)\\)|\\*([^*\\n]+)\\*|_([^_\\n]+)_|`([^`\\n]+)`")
+
+// markdownToHTML renders Telegram Markdown as Matrix-formatted HTML
+func markdownToHTML(message string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range markdownPattern.FindAllStringSubmatchIndex(message, -1) {
+		b.WriteString(html.EscapeString(message[last:m[0]]))
+		group := func(i int) string { return html.EscapeString(message[m[2*i]:m[2*i+1]]) }
+		switch {
+		case m[2] >= 0:
+			fmt.Fprintf(&b, `<a href="%s">%s</a>`, group(2), group(1))
+		case m[6] >= 0:
+			fmt.Fprintf(&b, "<b>%s</b>", group(3))
+		case m[8] >= 0:
+			fmt.Fprintf(&b, "<i>%s</i>", group(4))
+		default:
+			fmt.Fprintf(&b, "<code>%s</code>", group(5))
+		}
+		last = m[1]
+	}
+	b.WriteString(html.EscapeString(message[last:]))
+	return strings.ReplaceAll(b.String(), "\n", "<br>")
+}
+
+// markdownToPlain strips Telegram Markdown for the plain-text body, links
+// become "text (url)"
+func markdownToPlain(message string) string {
+	return markdownPattern.ReplaceAllStringFunc(message, func(s string) string {
+		m := markdownPattern.FindStringSubmatch(s)
+		switch {
+		case m[1] != "":
+			return fmt.Sprintf("%s (%s)", m[1], m[2])
+		case m[3] != "":
+			return m[3]
+		case m[4] != "":
+			return m[4]
+		default:
+			return m[5]
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMatrixNotifierSend(t *testing.T) {
+	type request struct {
+		method, path, auth string
+		content            matrixMessage
+	}
+	var mu sync.Mutex
+	var requests []request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		req := request{method: r.Method, path: r.URL.EscapedPath(), auth: r.Header.Get("Authorization")}
+		json.NewDecoder(r.Body).Decode(&req.content)
+		requests = append(requests, req)
+		w.Write([]byte(`{"event_id":"$event"}`))
+	}))
+	defer server.Close()
+
+	n := &matrixNotifier{homeserver: server.URL + "/", room: "!room:example.org", token: "syt_secret"}
+	if err := n.Send(server.Client(), "*Fuel* is cheap", sendOptions{}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if err := n.Send(server.Client(), "Daily summary", sendOptions{Silent: true}); err != nil {
+		t.Fatalf("silent Send: %v", err)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(requests))
+	}
+	// The room ID is path-escaped, its "!" included
+	prefix := "/_matrix/client/v3/rooms/%21room:example.org/send/m.room.message/"
+	var txnIDs []string
+	for _, req := range requests {
+		if req.method != http.MethodPut {
+			t.Errorf("method %s, want PUT", req.method)
+		}
+		txnID, ok := strings.CutPrefix(req.path, prefix)
+		if !ok || txnID == "" || strings.Contains(txnID, "/") {
+			t.Errorf("path %q, want %s<txnID>", req.path, prefix)
+		}
+		txnIDs = append(txnIDs, txnID)
+		if req.auth != "Bearer syt_secret" {
+			t.Errorf("Authorization %q, want the access token as bearer", req.auth)
+		}
+	}
+	if txnIDs[0] == txnIDs[1] {
+		t.Errorf("both messages used transaction ID %q, Matrix would drop the second", txnIDs[0])
+	}
+
+	first := requests[0].content
+	want := matrixMessage{
+		MsgType:       "m.text",
+		Body:          "Fuel is cheap",
+		Format:        "org.matrix.custom.html",
+		FormattedBody: "<b>Fuel</b> is cheap",
+	}
+	if first != want {
+		t.Errorf("content %+v, want %+v", first, want)
+	}
+	if got := requests[1].content.MsgType; got != "m.notice" {
+		t.Errorf("silent message msgtype %q, want m.notice", got)
+	}
+}
+
+func TestMatrixNotifierError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"errcode":"M_FORBIDDEN","error":"not in room"}`))
+	}))
+	defer server.Close()
+
+	n := &matrixNotifier{homeserver: server.URL, room: "!room:example.org", token: "syt_secret"}
+	err := n.Send(server.Client(), "hello", sendOptions{})
+	if err == nil || !strings.Contains(err.Error(), "M_FORBIDDEN not in room") {
+		t.Errorf("Send error %v, want the Matrix errcode and message", err)
+	}
+}
+
+func TestMarkdownToHTML(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"bold", "Fuel: *$400/t*", "Fuel: <b>$400/t</b>"},
+		{"italic", "_Updated 10:00_", "<i>Updated 10:00</i>"},
+		{"code", "`10:30`  Fuel", "<code>10:30</code>  Fuel"},
+		{"link", "[Open game](https://shippingmanager.cc/)", `<a href="https://shippingmanager.cc/">Open game</a>`},
+		{"underscores in a link URL", "[docs](https://x.test/a_b_c)", `<a href="https://x.test/a_b_c">docs</a>`},
+		{"escaping", "<b> & \"quotes\"", "&lt;b&gt; &amp; &#34;quotes&#34;"},
+		{"escaping inside bold", "*a<b*", "<b>a&lt;b</b>"},
+		{"escaping in a link", "[a&b](https://x.test/?q=1&r=2)", `<a href="https://x.test/?q=1&amp;r=2">a&amp;b</a>`},
+		{"newlines", "line 1\nline 2", "line 1<br>line 2"},
+		{"unclosed marker", "5 * 3", "5 * 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := markdownToHTML(tt.in); got != tt.want {
+				t.Errorf("markdownToHTML(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkdownToPlain(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"bold", "Fuel: *$400/t*", "Fuel: $400/t"},
+		{"italic and code", "_at_ `10:30`", "at 10:30"},
+		{"link", "[Open game](https://shippingmanager.cc/)", "Open game (https://shippingmanager.cc/)"},
+		{"underscores in a link URL", "[docs](https://x.test/a_b_c)", "docs (https://x.test/a_b_c)"},
+		{"no escaping", "<b> & *x*", "<b> & x"},
+		{"newlines kept", "*a*\nb", "a\nb"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := markdownToPlain(tt.in); got != tt.want {
+				t.Errorf("markdownToPlain(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"sync"
+)
+
+// chatMigration holds the new chat ID after the configured group was upgraded to
+// a supergroup. It is shared by all sends and persisted in the cooldown state.
+var chatMigration struct {
+	mu   sync.Mutex
+	from string // configured chat ID the migration applies to
+	to   string
+}
+
+// recordChatMigration switches sends from chat from to the supergroup ID Telegram reported
+func recordChatMigration(from string, to int64) string {
+	newID := strconv.FormatInt(to, 10)
+
+	chatMigration.mu.Lock()
+	defer chatMigration.mu.Unlock()
+
+	// from may already be the migrated ID, keep pointing at the configured one
+	if chatMigration.from == "" || chatMigration.to != from {
+		chatMigration.from = from
+	}
+	chatMigration.to = newID
+
+	log.Printf("WARNING: Telegram chat %s was upgraded to a supergroup, now using chat ID %s. Update TELEGRAM_CHAT_ID in .env to %s.",
+		from, newID, newID)
+	return newID
+}
+
+// migratedChatID returns the chat ID to use instead of chatID, or chatID itself
+func migratedChatID(chatID string) string {
+	chatMigration.mu.Lock()
+	defer chatMigration.mu.Unlock()
+
+	if chatMigration.from == chatID && chatMigration.to != "" {
+		return chatMigration.to
+	}
+	return chatID
+}
+
+// applyChatMigration restores a migration from a previous run, unless
+// TELEGRAM_CHAT_ID was changed since, e.g. to the new supergroup ID
+func applyChatMigration(cfg *Config, cd *cooldown) {
+	if cd.migratedFrom == "" {
+		return
+	}
+	if cd.migratedFrom != configuredChatID(cfg) {
+		cd.migratedFrom = ""
+		cd.migratedTo = ""
+		return
+	}
+
+	chatMigration.mu.Lock()
+	chatMigration.from = cd.migratedFrom
+	chatMigration.to = cd.migratedTo
+	chatMigration.mu.Unlock()
+	log.Printf("Using chat ID %s, %s was upgraded to a supergroup in a previous run", cd.migratedTo, cd.migratedFrom)
+}
+
+// syncChatMigration copies the live migration into the state before it is saved
+func syncChatMigration(cd *cooldown) {
+	chatMigration.mu.Lock()
+	defer chatMigration.mu.Unlock()
+
+	if chatMigration.to != "" {
+		cd.migratedFrom = chatMigration.from
+		cd.migratedTo = chatMigration.to
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// Notifier delivers alert messages. Messages are written in Telegram's
+// Markdown, other notifiers convert them to their own format.
+type Notifier interface {
+	Send(client *http.Client, message string, opts sendOptions) error
+	// Target describes where messages go, for the startup log
+	Target() string
+}
+
+// messageSeq numbers sent messages within one run, for Matrix transaction IDs
+// and spool file names
+var messageSeq atomic.Int64
+
+// newNotifier returns the notifier selected by NOTIFIER
+func newNotifier(cfg *Config) Notifier {
+	switch cfg.NotifierType {
+	case "matrix":
+		return &matrixNotifier{
+			homeserver: cfg.MatrixHomeserver,
+			room:       cfg.MatrixRoom,
+			token:      cfg.MatrixToken,
+			maxLogBody: cfg.MaxLogBody,
+		}
+	case "file":
+		return &fileNotifier{dir: cfg.SpoolDir}
+	case "email":
+		return &emailNotifier{
+			host: cfg.SMTPHost,
+			port: cfg.SMTPPort,
+			user: cfg.SMTPUser,
+			pass: cfg.SMTPPass,
+			from: cfg.EmailFrom,
+			to:   cfg.EmailTo,
+		}
+	default:
+		return &telegramNotifier{cfg: cfg}
+	}
+}
+
+// telegramNotifier sends to the configured Telegram chat, or to chatID when set
+type telegramNotifier struct {
+	cfg    *Config
+	chatID string
+}
+
+func (n *telegramNotifier) Send(client *http.Client, message string, opts sendOptions) error {
+	if n.chatID != "" {
+		opts.ChatID = n.chatID
+	}
+	sent, err := sendTelegramWith(client, n.cfg, message, opts)
+	if sent != nil && opts.Sent != nil {
+		*opts.Sent = *sent
+	}
+	return err
+}
+
+func (n *telegramNotifier) Target() string {
+	if n.chatID != "" {
+		return fmt.Sprintf("Telegram chat %s", n.chatID)
+	}
+	return fmt.Sprintf("Telegram chat %s", n.cfg.TelegramChatID)
+}
+
+// notify sends a message through the configured notifier
+func notify(client *http.Client, cfg *Config, message string) error {
+	return notifyWith(client, cfg, message, sendOptions{})
+}
+
+// notifyWith sends a message through the configured notifier with per-message
+// options, subject to the MAX_SENDS_PER_MINUTE safety throttle
+func notifyWith(client *http.Client, cfg *Config, message string, opts sendOptions) error {
+	return sendThrottled(client, cfg, cfg.Notifier, message, opts)
+}
+
+// sendThrottled sends a message through n, subject to the MAX_SENDS_PER_MINUTE
+// safety throttle
+func sendThrottled(client *http.Client, cfg *Config, n Notifier, message string, opts sendOptions) error {
+	if !opts.SkipThrottle && !allowSend(cfg.MaxSendsPerMinute) {
+		notifyThrottleTripped(client, cfg)
+		return fmt.Errorf("send throttle of %d messages per minute exceeded, message dropped", cfg.MaxSendsPerMinute)
+	}
+	return n.Send(client, message, opts)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// pinnedForecastSlots is how many slots from the current one the pinned forecast lists
+const pinnedForecastSlots = 8
+
+// updatePinnedForecast keeps a single pinned message with the current and
+// upcoming prices up to date. It is created and pinned on first use and edited
+// on every check after that. When it was deleted it is created again.
+func updatePinnedForecast(client *http.Client, cfg *Config, cd *cooldown, prices []PriceSlot, slot *PriceSlot, now time.Time) {
+	fuelThreshold, co2Threshold := effectiveThresholds(cfg, cd, now)
+	text := forecastText(cfg, prices, slot, now, fuelThreshold, co2Threshold)
+
+	if cd.pinnedMessageID != 0 {
+		payload := telegramMessage{
+			ChatID:    targetChatID(cfg),
+			MessageID: cd.pinnedMessageID,
+			Text:      text,
+			ParseMode: defaultParseMode,
+		}
+		resp, err := callTelegram(client, cfg, "editMessageText", payload)
+		if err == nil || (resp != nil && strings.Contains(resp.Description, "message is not modified")) {
+			return
+		}
+		if resp == nil || !strings.Contains(resp.Description, "message to edit not found") {
+			log.Printf("ERROR updating pinned forecast: %s", err)
+			return
+		}
+		log.Println("Pinned forecast message was deleted, creating a new one")
+		cd.pinnedMessageID = 0
+	}
+
+	payload := telegramMessage{
+		ChatID:              targetChatID(cfg),
+		Text:                text,
+		ParseMode:           defaultParseMode,
+		DisableNotification: true,
+	}
+	resp, err := callTelegram(client, cfg, "sendMessage", payload)
+	if err != nil {
+		log.Printf("ERROR creating pinned forecast: %s", err)
+		return
+	}
+
+	sent, err := resp.sentMessage()
+	if err != nil {
+		log.Printf("ERROR creating pinned forecast: %s", err)
+		return
+	}
+	cd.pinnedMessageID = sent.MessageID
+
+	pin := telegramMessage{
+		ChatID:              targetChatID(cfg),
+		MessageID:           sent.MessageID,
+		DisableNotification: true,
+	}
+	if _, err := callTelegram(client, cfg, "pinChatMessage", pin); err != nil {
+		// Still edited from now on, the bot may just lack the pin permission
+		log.Printf("WARNING: Failed to pin forecast message: %s", err)
+		return
+	}
+	log.Printf("Pinned forecast message created (message %d)", sent.MessageID)
+}
+
+// forecastText renders the current slot and the next ones, green prices marked
+func forecastText(cfg *Config, prices []PriceSlot, slot *PriceSlot, now time.Time, fuelThreshold, co2Threshold int) string {
+	start := 0
+	for i := range prices {
+		if prices[i].Time == slot.Time && prices[i].Day == slot.Day {
+			start = i
+			break
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*Price forecast*\n_Updated %s_\n\n", now.In(cfg.Timezone).Format("2006-01-02 15:04 MST"))
+	for i := start; i < len(prices) && i < start+pinnedForecastSlots; i++ {
+		p := prices[i]
+		fmt.Fprintf(&b, "`%s`  Fuel %s%s  CO2 %s%s\n",
+			p.Time, formatPrice(cfg, p.FuelPrice), greenMark(p.FuelPrice > 0, p.FuelPrice, fuelThreshold),
+			formatPrice(cfg, p.CO2Price), greenMark(co2Valid(cfg, &p), p.CO2Price, co2Threshold))
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// greenMark returns a check mark for valid prices at or below the threshold
+func greenMark(valid bool, price, threshold int) string {
+	if valid && price <= threshold {
+		return " ✅"
+	}
+	return ""
+}
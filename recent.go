@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// sentAlert is one price alert in the /recent list
+type sentAlert struct {
+	Type  string `json:"type"`
+	Price int    `json:"price"`
+	Slot  string `json:"slot"`
+	Time  string `json:"time"`
+}
+
+// recordSentAlert appends an alert to the recent list, keeping the last
+// RECENT_ALERTS entries. Caller must hold cd.mu.
+func recordSentAlert(cfg *Config, cd *cooldown, kind string, price int, slotKey string, at time.Time) {
+	cd.recentAlerts = append(cd.recentAlerts, sentAlert{
+		Type:  kind,
+		Price: price,
+		Slot:  slotKey,
+		Time:  formatStateTime(at),
+	})
+	if len(cd.recentAlerts) > cfg.RecentAlerts {
+		cd.recentAlerts = cd.recentAlerts[len(cd.recentAlerts)-cfg.RecentAlerts:]
+	}
+}
+
+// handleRecent lists the last alerts sent, newest first
+func handleRecent(ctx context.Context, client *http.Client, cfg *Config, cd *cooldown, args []string) string {
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+
+	if len(cd.recentAlerts) == 0 {
+		return "No alerts sent yet."
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*Last %d alert(s)*\n", len(cd.recentAlerts))
+	for i := len(cd.recentAlerts) - 1; i >= 0; i-- {
+		a := cd.recentAlerts[i]
+		sent := parseStateTime(a.Time).In(cfg.Timezone).Format("Jan 2 15:04")
+		fmt.Fprintf(&b, "\n%s %s: %s (slot %s)", sent, alertTypeLabel(a.Type), formatPrice(cfg, a.Price), a.Slot)
+	}
+	return b.String()
+}
+
+// alertTypeLabel returns the display name of a recorded alert type
+func alertTypeLabel(kind string) string {
+	if kind == "co2" {
+		return "CO2"
+	}
+	return "Fuel"
+}
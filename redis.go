@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redisTimeout bounds a whole state load or save, so an unreachable Redis
+// delays a check by seconds rather than hanging it
+const redisTimeout = 5 * time.Second
+
+// redisStore keeps the state as a JSON string under one Redis key, so several
+// instances (or a replacement container) pick up the same dedup state. Each
+// alert is claimed with SET NX under key:claim:..., so instances sharing the
+// key never both send it. It speaks just enough RESP for AUTH, SELECT, GET, SET
+// and DEL over a fresh connection per call.
+type redisStore struct {
+	url string
+	key string
+}
+
+func (s *redisStore) Load() (cooldownState, error) {
+	var state cooldownState
+	reply, err := s.do([]string{"GET", s.key})
+	if err != nil {
+		return state, err
+	}
+	if reply == nil {
+		return state, errNoState
+	}
+	if err := json.Unmarshal(reply, &state); err != nil {
+		return state, fmt.Errorf("failed to parse state from Redis key %s: %w", s.key, err)
+	}
+	return state, nil
+}
+
+func (s *redisStore) Save(state cooldownState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+	_, err = s.do([]string{"SET", s.key, string(data)})
+	return err
+}
+
+// Claim sets key:claim:name unless it exists, with ttl as its expiry
+func (s *redisStore) Claim(name string, ttl time.Duration) (bool, error) {
+	reply, err := s.do([]string{"SET", s.key + ":claim:" + name, "1", "NX", "PX", strconv.FormatInt(ttl.Milliseconds(), 10)})
+	if err != nil {
+		return false, err
+	}
+	return reply != nil, nil
+}
+
+// Release deletes the claim key:claim:name
+func (s *redisStore) Release(name string) error {
+	_, err := s.do([]string{"DEL", s.key + ":claim:" + name})
+	return err
+}
+
+func (s *redisStore) Name() string {
+	u, err := url.Parse(s.url)
+	if err != nil {
+		return "Redis key " + s.key
+	}
+	return fmt.Sprintf("Redis %s key %s", u.Host, s.key)
+}
+
+// do connects, authenticates, selects the database and runs one command,
+// returning its bulk string reply (nil for a missing key)
+func (s *redisStore) do(cmd []string) ([]byte, error) {
+	u, err := url.Parse(s.url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+
+	dialer := &net.Dialer{Timeout: redisTimeout}
+	var conn net.Conn
+	if u.Scheme == "rediss" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: u.Hostname()})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(redisTimeout))
+
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+
+	var setup [][]string
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			if name := u.User.Username(); name != "" {
+				setup = append(setup, []string{"AUTH", name, pass})
+			} else {
+				setup = append(setup, []string{"AUTH", pass})
+			}
+		}
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" && db != "0" {
+		setup = append(setup, []string{"SELECT", db})
+	}
+	for _, c := range setup {
+		if _, err := redisCommand(rw, c); err != nil {
+			return nil, fmt.Errorf("Redis %s failed: %w", c[0], err)
+		}
+	}
+
+	reply, err := redisCommand(rw, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("Redis %s failed: %w", cmd[0], err)
+	}
+	return reply, nil
+}
+
+// redisCommand writes one command as a RESP array and reads its reply
+func redisCommand(rw *bufio.ReadWriter, args []string) ([]byte, error) {
+	fmt.Fprintf(rw, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(rw, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := rw.Flush(); err != nil {
+		return nil, err
+	}
+	return readRedisReply(rw.Reader)
+}
+
+// readRedisReply reads a simple string, error, integer or bulk string reply
+func readRedisReply(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("empty reply")
+	}
+
+	switch line[0] {
+	case '+', ':':
+		return []byte(line[1:]), nil
+	case '-':
+		return nil, errors.New(line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("malformed bulk reply: %s", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	default:
+		return nil, fmt.Errorf("unexpected reply: %s", line)
+	}
+}
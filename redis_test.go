@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is an in-process RESP server for AUTH, SELECT, GET, SET (with NX)
+// and DEL, with canned error replies per command
+type fakeRedis struct {
+	addr     string
+	password string
+	errors   map[string]string
+
+	mu       sync.Mutex
+	values   map[string]string
+	commands []string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	r := &fakeRedis{addr: ln.Addr().String(), errors: map[string]string{}, values: map[string]string{}}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+	return r
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	for {
+		args, err := readRESPArray(br)
+		if err != nil {
+			return
+		}
+		fmt.Fprint(conn, r.reply(args))
+	}
+}
+
+func (r *fakeRedis) reply(args []string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands = append(r.commands, strings.Join(args, " "))
+
+	if msg, ok := r.errors[args[0]]; ok {
+		return "-" + msg + "\r\n"
+	}
+	switch args[0] {
+	case "AUTH":
+		if args[len(args)-1] != r.password {
+			return "-WRONGPASS invalid username-password pair\r\n"
+		}
+		return "+OK\r\n"
+	case "SELECT":
+		return "+OK\r\n"
+	case "GET":
+		value, ok := r.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "SET":
+		if _, exists := r.values[args[1]]; exists && slices.Contains(args[3:], "NX") {
+			return "$-1\r\n"
+		}
+		r.values[args[1]] = args[2]
+		return "+OK\r\n"
+	case "DEL":
+		delete(r.values, args[1])
+		return ":1\r\n"
+	}
+	return "-ERR unknown command\r\n"
+}
+
+// readRESPArray reads one command sent as a RESP array of bulk strings
+func readRESPArray(br *bufio.Reader) ([]string, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func (r *fakeRedis) sentCommands() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.commands...)
+}
+
+func TestRedisStoreRoundTrip(t *testing.T) {
+	server := newFakeRedis(t)
+	server.password = "secret"
+	store := &redisStore{url: "redis://:secret@" + server.addr + "/2", key: "alertbot:state"}
+
+	if _, err := store.Load(); !errors.Is(err, errNoState) {
+		t.Fatalf("Load of a missing key: %v, want %v", err, errNoState)
+	}
+
+	want := cooldownState{LastFuelSlot: "10:00-d3", LastCO2Slot: "09:30-d3", UpdateOffset: 42, FuelStreak: greenStreak{Slot: "10:00-d3", Count: 2}}
+	if err := store.Save(want); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	got, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got.LastFuelSlot != want.LastFuelSlot || got.LastCO2Slot != want.LastCO2Slot || got.UpdateOffset != want.UpdateOffset || got.FuelStreak != want.FuelStreak {
+		t.Errorf("Load = %+v, want %+v", got, want)
+	}
+
+	// Every call authenticates and selects the database on its own connection.
+	// The SET value is left out, it is the state JSON.
+	commands := server.sentCommands()
+	if len(commands) != 9 || commands[0] != "AUTH secret" || commands[1] != "SELECT 2" || !strings.HasPrefix(commands[5], "SET alertbot:state {") {
+		t.Errorf("commands = %q", commands)
+	}
+}
+
+func TestRedisStoreErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		url      string
+		errors   map[string]string
+		value    string
+		wantErr  string
+	}{
+		{name: "wrong password", password: "secret", url: "redis://:guess@%s", wantErr: "AUTH failed: WRONGPASS"},
+		{name: "read-only replica", url: "redis://%s", errors: map[string]string{"SET": "READONLY You can't write against a read only replica."}, wantErr: "SET failed: READONLY"},
+		{name: "bad database", url: "redis://%s/99", errors: map[string]string{"SELECT": "ERR DB index is out of range"}, wantErr: "SELECT failed: ERR DB index"},
+		{name: "corrupt value", url: "redis://%s", value: "{not json", wantErr: "failed to parse state"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeRedis(t)
+			server.password = tt.password
+			for cmd, msg := range tt.errors {
+				server.errors[cmd] = msg
+			}
+			server.values["state"] = `{"last_fuel_slot":"10:00-d3"}`
+			if tt.value != "" {
+				server.values["state"] = tt.value
+			}
+			store := &redisStore{url: fmt.Sprintf(tt.url, server.addr), key: "state"}
+
+			var err error
+			if _, ok := tt.errors["SET"]; ok {
+				err = store.Save(cooldownState{})
+			} else {
+				_, err = store.Load()
+			}
+			if err == nil || errors.Is(err, errNoState) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRedisStoreUnreachable(t *testing.T) {
+	// Grab a free port and close it again, so nothing listens there
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	store := &redisStore{url: "redis://" + addr, key: "state"}
+	if _, err := store.Load(); err == nil || !strings.Contains(err.Error(), "failed to connect") {
+		t.Errorf("Load error = %v, want a connection error", err)
+	}
+
+	// The bot starts with empty state instead of failing
+	if cd := loadCooldown(store); cd.lastFuelSlot != "" {
+		t.Errorf("loadCooldown kept %q from an unreachable store", cd.lastFuelSlot)
+	}
+}
+
+func TestCooldownStoreRoundTrip(t *testing.T) {
+	server := newFakeRedis(t)
+	stores := map[string]StateStore{
+		"memory": &memoryStore{},
+		"redis":  &redisStore{url: "redis://" + server.addr, key: "state"},
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			cd := &cooldown{store: store}
+			cd.lastFuelSlot = "10:00-d3"
+			cd.lastCO2Threshold = 8
+			cd.fuelStreak = greenStreak{Slot: "10:00-d3", Count: 3}
+			cd.updateOffset = 17
+			saveCooldown(cd)
+
+			restored := loadCooldown(store)
+			if restored.lastFuelSlot != cd.lastFuelSlot || restored.lastCO2Threshold != 8 || restored.fuelStreak != cd.fuelStreak || restored.updateOffset != 17 {
+				t.Errorf("restored %+v %d %+v %d", restored.lastFuelSlot, restored.lastCO2Threshold, restored.fuelStreak, restored.updateOffset)
+			}
+		})
+	}
+}
+
+func TestRedisStoreClaim(t *testing.T) {
+	server := newFakeRedis(t)
+	store := &redisStore{url: "redis://" + server.addr, key: "state"}
+
+	for i, want := range []bool{true, false} {
+		won, err := store.Claim("fuel:10:00-d1:450", time.Hour)
+		if err != nil || won != want {
+			t.Errorf("claim %d = %v, %v, want %v", i+1, won, err, want)
+		}
+	}
+	if err := store.Release("fuel:10:00-d1:450"); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if won, err := store.Claim("fuel:10:00-d1:450", time.Hour); err != nil || !won {
+		t.Errorf("claim after release = %v, %v, want it won again", won, err)
+	}
+	if cmd := server.sentCommands()[0]; cmd != "SET state:claim:fuel:10:00-d1:450 1 NX PX 3600000" {
+		t.Errorf("claim command = %q", cmd)
+	}
+}
+
+func TestSharedStateAlertsOnce(t *testing.T) {
+	setClock(t, time.Date(2026, 3, 1, 10, 5, 0, 0, time.UTC))
+	client, _ := newFakeGame(t, func(current string) []PriceSlot {
+		return []PriceSlot{{Time: current, Day: 1, FuelPrice: 400, CO2Price: 50}}
+	})
+	server := newFakeRedis(t)
+
+	// Two instances on the same key, both started before either alerted
+	var sent int
+	var instances []*cooldown
+	var notifiers []*recordingNotifier
+	for range 2 {
+		store := &redisStore{url: "redis://" + server.addr, key: "state"}
+		instances = append(instances, loadCooldown(store))
+		notifiers = append(notifiers, &recordingNotifier{})
+	}
+	for i, cd := range instances {
+		cfg := checkConfig(t)
+		cfg.Notifier = notifiers[i]
+		checkPrices(client, cfg, cd)
+		sent += len(notifiers[i].sent())
+	}
+	if sent != 1 {
+		t.Errorf("instances sent %d alerts for one slot, want 1", sent)
+	}
+
+	// A stale state without the slot still loses to the claim
+	server.mu.Lock()
+	server.values["state"] = `{"last_fuel_slot":""}`
+	server.mu.Unlock()
+	cfg := checkConfig(t)
+	notifier := &recordingNotifier{}
+	cfg.Notifier = notifier
+	cd := instances[1]
+	checkPrices(client, cfg, cd)
+	if n := len(notifier.sent()); n != 0 || cd.lastFuelSlot != "10:00-d1" {
+		t.Errorf("sent %d alerts, fuel slot %q, want none and the slot marked", n, cd.lastFuelSlot)
+	}
+}
+
+func TestFailedSendReleasesClaim(t *testing.T) {
+	setClock(t, time.Date(2026, 3, 1, 10, 5, 0, 0, time.UTC))
+	client, _ := newFakeGame(t, func(current string) []PriceSlot {
+		return []PriceSlot{{Time: current, Day: 1, FuelPrice: 400, CO2Price: 50}}
+	})
+	server := newFakeRedis(t)
+	cfg := checkConfig(t)
+	cfg.Notifier = &recordingNotifier{err: errors.New("chat unreachable")}
+	checkPrices(client, cfg, loadCooldown(&redisStore{url: "redis://" + server.addr, key: "state"}))
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if _, held := server.values["state:claim:fuel:10:00-d1:450"]; held {
+		t.Error("claim still held after the send failed, no instance would retry")
+	}
+}
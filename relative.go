@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// recordRelativePrice appends a slot price to a RELATIVE_WINDOW history, once
+// per slot, keeping the last window entries
+func recordRelativePrice(history []slotPrice, slotKey string, price, window int) []slotPrice {
+	if n := len(history); n > 0 && history[n-1].Slot == slotKey {
+		history[n-1].Price = price
+		return history
+	}
+	history = append(history, slotPrice{Slot: slotKey, Price: price})
+	if len(history) > window {
+		history = history[len(history)-window:]
+	}
+	return history
+}
+
+// belowAverage reports whether price is at least dropPct below the average of
+// the last window slots before slotKey in history, and returns that average.
+// It is false until the history holds a full window of earlier slots.
+func belowAverage(history []slotPrice, slotKey string, price, window int, dropPct float64) (bool, float64) {
+	if n := len(history); n > 0 && history[n-1].Slot == slotKey {
+		history = history[:n-1]
+	}
+	if window <= 0 || len(history) < window {
+		return false, 0
+	}
+
+	sum := 0
+	for _, p := range history[len(history)-window:] {
+		sum += p.Price
+	}
+	// Compared on the sum so an exact drop like 119 against 170 at 30% isn't
+	// lost to float rounding of the average
+	below := float64(price*window)*100 <= float64(sum)*(100-dropPct)
+	return below, float64(sum) / float64(window)
+}
+
+// relativeGreen decides with ALERT_MODE=relative whether the current prices
+// are alert-worthy, then records them in the rolling history. Caller must hold cd.mu.
+func relativeGreen(cfg *Config, cd *cooldown, slotKey string, slot *PriceSlot) (bool, bool) {
+	fuelGreen, co2Green := false, false
+
+	if slot.FuelPrice > 0 {
+		var avg float64
+		fuelGreen, avg = belowAverage(cd.relativeFuel, slotKey, slot.FuelPrice, cfg.RelativeWindow, cfg.RelativeDropPct)
+		if fuelGreen {
+			log.Printf("Fuel $%d/t is at least %g%% below the %d-slot average of $%.0f/t (ALERT_MODE=relative)", slot.FuelPrice, cfg.RelativeDropPct, cfg.RelativeWindow, avg)
+		}
+		cd.relativeFuel = recordRelativePrice(cd.relativeFuel, slotKey, slot.FuelPrice, cfg.RelativeWindow+1)
+	}
+	if co2Valid(cfg, slot) {
+		var avg float64
+		co2Green, avg = belowAverage(cd.relativeCO2, slotKey, slot.CO2Price, cfg.RelativeWindow, cfg.RelativeDropPct)
+		if co2Green {
+			log.Printf("CO2 $%d/t is at least %g%% below the %d-slot average of $%.0f/t (ALERT_MODE=relative)", slot.CO2Price, cfg.RelativeDropPct, cfg.RelativeWindow, avg)
+		}
+		cd.relativeCO2 = recordRelativePrice(cd.relativeCO2, slotKey, slot.CO2Price, cfg.RelativeWindow+1)
+	}
+	return fuelGreen, co2Green
+}
+
+// relativeNote names the average each alerted price dropped below with
+// ALERT_MODE=relative, e.g. "Fuel: 12% below the 12-slot average of $460/t",
+// followed by the BUY_ADVICE tier for that drop
+func relativeNote(cfg *Config, cd *cooldown, slot *PriceSlot, fuel, co2 bool) string {
+	slotKey := fmt.Sprintf("%s-d%d", slot.Time, slot.Day)
+	var lines []string
+	add := func(label string, history []slotPrice, price int) {
+		_, avg := belowAverage(history, slotKey, price, cfg.RelativeWindow, cfg.RelativeDropPct)
+		if avg <= 0 {
+			return
+		}
+		lines = append(lines, fmt.Sprintf("%s: %.0f%% below the %d-slot average of %s",
+			label, (1-float64(price)/avg)*100, cfg.RelativeWindow, formatPrice(cfg, int(avg+0.5))))
+		if advice, _ := adviceFor(cfg.BuyTiers, price, int(avg+0.5)); advice != "" {
+			lines = append(lines, fmt.Sprintf("%s advice: %s", label, advice))
+		}
+	}
+	if fuel {
+		add("Fuel", cd.relativeFuel, slot.FuelPrice)
+	}
+	if co2 {
+		add("CO2", cd.relativeCO2, slot.CO2Price)
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return "\n\n" + strings.Join(lines, "\n")
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// relativeHistory builds a history of consecutive slots with the given prices
+func relativeHistory(prices ...int) []slotPrice {
+	history := make([]slotPrice, len(prices))
+	for i, price := range prices {
+		history[i] = slotPrice{Slot: slotName(i), Price: price}
+	}
+	return history
+}
+
+func slotName(i int) string {
+	return string(rune('a'+i)) + "-d1"
+}
+
+func TestRecordRelativePrice(t *testing.T) {
+	tests := []struct {
+		name    string
+		history []slotPrice
+		slot    string
+		price   int
+		window  int
+		want    []slotPrice
+	}{
+		{"first price", nil, "a-d1", 400, 3, relativeHistory(400)},
+		{"window not yet full", relativeHistory(400), "b-d1", 410, 3, relativeHistory(400, 410)},
+		{"recheck replaces the slot's price", relativeHistory(400, 410), "b-d1", 390, 3, relativeHistory(400, 390)},
+		{"trimmed to the window", relativeHistory(400, 410, 420), "d-d1", 430, 3,
+			[]slotPrice{{"b-d1", 410}, {"c-d1", 420}, {"d-d1", 430}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := recordRelativePrice(tt.history, tt.slot, tt.price, tt.window)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBelowAverage(t *testing.T) {
+	tests := []struct {
+		name    string
+		history []slotPrice
+		slot    string
+		price   int
+		window  int
+		dropPct float64
+		want    bool
+		wantAvg float64
+	}{
+		{"window not yet full", relativeHistory(500, 500), "c-d1", 100, 3, 10, false, 0},
+		{"current slot doesn't count towards the window", relativeHistory(500, 500, 100), "c-d1", 100, 3, 10, false, 0},
+		{"exactly the drop below", relativeHistory(500, 500, 500), "d-d1", 450, 3, 10, true, 500},
+		{"one above the drop", relativeHistory(500, 500, 500), "d-d1", 451, 3, 10, false, 500},
+		{"exact drop float rounding would miss", relativeHistory(170, 170), "c-d1", 119, 2, 30, true, 170},
+		{"only the last window slots count", relativeHistory(1000, 400, 400), "d-d1", 360, 2, 10, true, 400},
+		{"recheck compares against the earlier slots", relativeHistory(400, 400, 360), "c-d1", 350, 2, 10, true, 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, avg := belowAverage(tt.history, tt.slot, tt.price, tt.window, tt.dropPct)
+			if got != tt.want || avg != tt.wantAvg {
+				t.Errorf("belowAverage = %v, %g, want %v, %g", got, avg, tt.want, tt.wantAvg)
+			}
+		})
+	}
+}
+
+func TestRelativeGreen(t *testing.T) {
+	cfg := checkConfig(t)
+	cfg.AlertMode = "relative"
+	cfg.RelativeWindow = 3
+	cfg.RelativeDropPct = 10
+	cd := &cooldown{store: &memoryStore{}}
+
+	steps := []struct {
+		slot     string
+		fuel     int
+		co2      int
+		wantFuel bool
+		wantCO2  bool
+	}{
+		{"a-d1", 500, 10, false, false},
+		{"b-d1", 500, 10, false, false},
+		{"c-d1", 500, 10, false, false},
+		// A full window from here on
+		{"d-d1", 450, 10, true, false},
+		// Rechecks of the slot neither double-record nor move the average
+		{"d-d1", 440, 9, true, true},
+		{"d-d1", 451, 9, false, true},
+		// d-d1 at $451 is in the window now, a-d1 dropped out
+		{"e-d1", 451, 9, false, false},
+	}
+	for _, step := range steps {
+		slot := &PriceSlot{FuelPrice: step.fuel, CO2Price: step.co2}
+		fuel, co2 := relativeGreen(cfg, cd, step.slot, slot)
+		if fuel != step.wantFuel || co2 != step.wantCO2 {
+			t.Errorf("%s fuel $%d CO2 $%d: green %v/%v, want %v/%v",
+				step.slot, step.fuel, step.co2, fuel, co2, step.wantFuel, step.wantCO2)
+		}
+	}
+
+	wantFuel := []slotPrice{{"b-d1", 500}, {"c-d1", 500}, {"d-d1", 451}, {"e-d1", 451}}
+	if !reflect.DeepEqual(cd.relativeFuel, wantFuel) {
+		t.Errorf("fuel history %+v, want the last window+1 slots %+v", cd.relativeFuel, wantFuel)
+	}
+	if n := len(cd.relativeCO2); n != cfg.RelativeWindow+1 {
+		t.Errorf("CO2 history holds %d slots, want %d", n, cfg.RelativeWindow+1)
+	}
+}
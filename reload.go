@@ -0,0 +1,37 @@
+package main
+
+import "log"
+
+// reloadConfig loads the config again for a SIGHUP reload, with the
+// timezones re-resolved and this run's state applied as on startup. The old
+// config is left untouched, the caller swaps in the returned one.
+// SLOT_MINUTES keeps its value, since the check schedule is aligned to it,
+// and the state store stays the one loaded on startup.
+// envFiles are the --env files given on startup, read again in the same order.
+func reloadConfig(old *Config, cd *cooldown, envFiles []string) (*Config, error) {
+	log.Println("Reloading config...")
+	cfg, err := loadConfig(envFiles)
+	if err != nil {
+		return nil, err
+	}
+	ensureTimezones(cfg)
+
+	if cfg.SlotMinutes != old.SlotMinutes {
+		log.Printf("WARNING: SLOT_MINUTES changes need a restart, keeping %d", old.SlotMinutes)
+		cfg.SlotMinutes = old.SlotMinutes
+	}
+	if cfg.StateBackend != old.StateBackend || cfg.RedisURL != old.RedisURL || cfg.RedisKey != old.RedisKey {
+		log.Printf("WARNING: STATE_BACKEND changes need a restart, keeping state in %s", cd.store.Name())
+	}
+	if cfg.Timezone.String() != old.Timezone.String() || cfg.SlotTimezone.String() != old.SlotTimezone.String() {
+		log.Printf("Timezone changed from %s to %s, slot timezone from %s to %s",
+			old.Timezone, cfg.Timezone, old.SlotTimezone, cfg.SlotTimezone)
+	}
+
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+	applyRefreshedSession(cfg, cd)
+	applyThresholdOverrides(cfg, cd)
+	resetDedupOnThresholdChange(cfg, cd)
+	return cfg, nil
+}
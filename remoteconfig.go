@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxRemoteConfigSize caps the CONFIG_URL response, a config is a few KB at most
+const maxRemoteConfigSize = 1 << 20
+
+// loadRemoteConfig merges the key/value set from CONFIG_URL over the local
+// .env, with the real environment variables env over both, and validates the
+// result like a local config. A remote config that
+// can't be fetched or doesn't validate is replaced by the last known good one,
+// and without one the local .env is used alone.
+func loadRemoteConfig(local, env map[string]string) (*Config, error) {
+	configURL := local["CONFIG_URL"]
+
+	remote, err := fetchRemoteConfig(configURL)
+	if err == nil {
+		cfg, err := configFromVars(mergeVars(local, remote, env))
+		if err == nil {
+			log.Printf("Remote config loaded from %s (%d values)", configURL, len(remote))
+			saveRemoteConfigCache(remote)
+			return cfg, nil
+		}
+		log.Printf("WARNING: Remote config from %s is invalid: %s", configURL, err)
+	} else {
+		log.Printf("WARNING: Failed to fetch remote config: %s", err)
+	}
+
+	cached, err := readEnvFile(remoteConfigCachePath())
+	if err != nil {
+		log.Println("WARNING: No last known good remote config, using the local .env only")
+		return configFromVars(mergeVars(local, nil, env))
+	}
+	log.Println("Using the last known good remote config")
+	return configFromVars(mergeVars(local, cached, env))
+}
+
+// fetchRemoteConfig downloads and parses the .env-style config at configURL
+func fetchRemoteConfig(configURL string) (map[string]string, error) {
+	// The shared client is set up after the config is loaded
+	client := &http.Client{Timeout: 15 * time.Second}
+
+	resp, err := client.Get(configURL)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned status %d", resp.StatusCode)
+	}
+
+	return parseEnv(io.LimitReader(resp.Body, maxRemoteConfigSize))
+}
+
+// mergeVars returns a copy of local with the remote values laid over it and
+// the environment values over those. CONFIG_URL itself always stays local.
+func mergeVars(local, remote, env map[string]string) map[string]string {
+	merged := make(map[string]string, len(local)+len(remote))
+	for k, v := range local {
+		merged[k] = v
+	}
+	for k, v := range remote {
+		if k != "CONFIG_URL" {
+			merged[k] = v
+		}
+	}
+	for k, v := range env {
+		merged[k] = v
+	}
+	return merged
+}
+
+// remoteConfigCachePath returns where the last known good remote config is
+// kept, next to the executable
+func remoteConfigCachePath() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return ".config-cache"
+	}
+	return filepath.Join(filepath.Dir(exe), ".config-cache")
+}
+
+// saveRemoteConfigCache stores a validated remote config as the last known
+// good one. It may hold secrets, so it is only readable by the current user.
+func saveRemoteConfigCache(remote map[string]string) {
+	keys := make([]string, 0, len(remote))
+	for k := range remote {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("# Last known good config from CONFIG_URL, written by the bot\n")
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s=%s\n", k, remote[k])
+	}
+
+	if err := writeFileAtomic(remoteConfigCachePath(), []byte(b.String()), 0600); err != nil {
+		log.Printf("WARNING: Failed to save remote config cache: %s", err)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// runReport fetches the prices once and prints what the bot sees and would
+// decide, without sending anything or changing the state. It returns the
+// process exit code, non-zero when the fetch fails.
+func runReport(out io.Writer, client *http.Client, cfg *Config, cd *cooldown) int {
+	now := time.Now().In(cfg.SlotTimezone)
+	prices, err := fetchPrices(context.Background(), client, cfg)
+	if err != nil {
+		fmt.Fprintf(out, "Failed to fetch prices: %s\n", err)
+		return 1
+	}
+	if len(prices) == 0 {
+		fmt.Fprintln(out, "The API returned an empty price list.")
+		return 1
+	}
+
+	currentSlot := slotTime(now, cfg.SlotMinutes)
+	matched := matchSlot(prices, currentSlot)
+	if cfg.UseFirstSlot {
+		matched = &prices[0]
+	}
+	fallback := matched == nil
+	if fallback {
+		matched = fallbackSlot(prices, now, cfg.FallbackMode)
+	}
+	fuelThreshold, co2Threshold := effectiveThresholds(cfg, cd, now)
+
+	fmt.Fprintf(out, "Price report at %s\n\n", now.In(cfg.Timezone).Format("2006-01-02 15:04 MST"))
+	fmt.Fprintf(out, "Thresholds: fuel %s, CO2 %s\n", formatPrice(cfg, fuelThreshold), formatPrice(cfg, co2Threshold))
+	switch {
+	case matched == nil:
+		fmt.Fprintf(out, "Current slot: %s not in the forecast (fallback: %s)\n", currentSlot, cfg.FallbackMode)
+	case fallback:
+		fmt.Fprintf(out, "Current slot: %s not in the forecast, using %s (day %d) (fallback: %s)\n", currentSlot, matched.Time, matched.Day, cfg.FallbackMode)
+	case cfg.UseFirstSlot:
+		fmt.Fprintf(out, "Current slot: %s (day %d), the first forecast slot (USE_FIRST_SLOT)\n", matched.Time, matched.Day)
+	default:
+		fmt.Fprintf(out, "Current slot: %s (day %d)\n", matched.Time, matched.Day)
+	}
+
+	fmt.Fprintf(out, "\nForecast (%d slots, * = at or below threshold):\n", len(prices))
+	for i := range prices {
+		p := &prices[i]
+		marker := ""
+		if p == matched {
+			marker = "  <- current"
+		}
+		fmt.Fprintf(out, "  %s day %-2d  fuel %8s %s  CO2 %6s %s%s\n",
+			p.Time, p.Day,
+			formatPrice(cfg, p.FuelPrice), reportMark(p.FuelPrice > 0 && p.FuelPrice <= fuelThreshold),
+			formatPrice(cfg, p.CO2Price), reportMark(co2Valid(cfg, p) && p.CO2Price <= co2Threshold),
+			marker)
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "Fuel: %s\n", forecastRange(cfg, prices, func(s PriceSlot) int { return s.FuelPrice }))
+	fmt.Fprintf(out, "CO2:  %s\n", forecastRange(cfg, prices, func(s PriceSlot) int { return s.CO2Price }))
+
+	if matched != nil {
+		fmt.Fprintln(out, "\nDecision for the current slot:")
+		fmt.Fprintf(out, "  Fuel: %s\n", reportDecision(cfg, cd, now, matched, "fuel"))
+		fmt.Fprintf(out, "  CO2:  %s\n", reportDecision(cfg, cd, now, matched, "co2"))
+	}
+	return 0
+}
+
+// reportMark flags forecast prices at or below threshold
+func reportMark(green bool) string {
+	if green {
+		return "*"
+	}
+	return " "
+}
+
+// forecastRange summarizes one price type over the forecast as min/max/avg,
+// ignoring slots without a price
+func forecastRange(cfg *Config, prices []PriceSlot, price func(PriceSlot) int) string {
+	lowest, highest, sum, n := 0, 0, 0, 0
+	for _, slot := range prices {
+		p := price(slot)
+		if p <= 0 {
+			continue
+		}
+		if n == 0 || p < lowest {
+			lowest = p
+		}
+		if p > highest {
+			highest = p
+		}
+		sum += p
+		n++
+	}
+	if n == 0 {
+		return "no prices"
+	}
+	return fmt.Sprintf("min %s, max %s, avg %s", formatPrice(cfg, lowest), formatPrice(cfg, highest), formatPrice(cfg, sum/n))
+}
+
+// reportDecision explains whether checkPrices would alert for one price type
+// in the current slot, following the same checks in the same order.
+func reportDecision(cfg *Config, cd *cooldown, now time.Time, slot *PriceSlot, kind string) string {
+	fuelThreshold, co2Threshold := effectiveThresholds(cfg, cd, now)
+	slotKey := fmt.Sprintf("%s-d%d", slot.Time, slot.Day)
+	localNow := now.In(cfg.Timezone)
+
+	green, threshold, price := slot.FuelPrice > 0 && slot.FuelPrice <= fuelThreshold, fuelThreshold, slot.FuelPrice
+	valid, relative := slot.FuelPrice > 0, cd.relativeFuel
+	hours, hoursKey := cfg.FuelHours, "FUEL_HOURS"
+	streak, confirmSlots, confirmKey := cd.fuelStreak, cfg.FuelConfirmSlots, "FUEL_CONFIRM_SLOTS"
+	lastSlot, lastSent, gap, gapKey := cd.lastFuelSlot, cd.lastFuelSent, cfg.FuelMinGap, "FUEL_MIN_GAP"
+	lastAlertPrice := cd.lastFuelAlertPrice
+	if kind == "co2" {
+		green, threshold, price = co2Valid(cfg, slot) && slot.CO2Price <= co2Threshold, co2Threshold, slot.CO2Price
+		valid, relative = co2Valid(cfg, slot), cd.relativeCO2
+		hours, hoursKey = cfg.CO2Hours, "CO2_HOURS"
+		streak, confirmSlots, confirmKey = cd.co2Streak, cfg.CO2ConfirmSlots, "CO2_CONFIRM_SLOTS"
+		lastSlot, lastSent, gap, gapKey = cd.lastCO2Slot, cd.lastCO2Sent, cfg.CO2MinGap, "CO2_MIN_GAP"
+		lastAlertPrice = cd.lastCO2AlertPrice
+	}
+
+	notGreen := fmt.Sprintf("no alert, %s is above the %s threshold", formatPrice(cfg, price), formatPrice(cfg, threshold))
+	if cfg.AlertMode == "relative" {
+		var avg float64
+		green = false
+		if valid {
+			green, avg = belowAverage(relative, slotKey, price, cfg.RelativeWindow, cfg.RelativeDropPct)
+		}
+		switch {
+		case !valid:
+			notGreen = "no alert, no valid price in this slot"
+		case avg == 0:
+			notGreen = fmt.Sprintf("no alert, fewer than %d earlier slots recorded for the average (ALERT_MODE=relative)", cfg.RelativeWindow)
+		default:
+			notGreen = fmt.Sprintf("no alert, %s is less than %g%% below the %d-slot average of %s (ALERT_MODE=relative)",
+				formatPrice(cfg, price), cfg.RelativeDropPct, cfg.RelativeWindow, formatPrice(cfg, int(avg+0.5)))
+		}
+	}
+	// The streak as checkPrices would count it with this check
+	streak.update(slotKey, green)
+	if !green {
+		lastAlertPrice = 0
+	}
+
+	switch {
+	case !cfg.MarketHours.contains(now):
+		return "no check, outside MARKET_HOURS"
+	case cd.lastCheck.IsZero() && cfg.FirstRunSilent:
+		return "no alert, the first check only records a baseline (FIRST_RUN_SILENT)"
+	case slices.Contains(cfg.ExcludeSlots, slot.Time):
+		return "no alert, slot is in EXCLUDE_SLOTS"
+	case !green:
+		return notGreen
+	case !hours.contains(localNow):
+		return fmt.Sprintf("no alert, outside %s", hoursKey)
+	case streak.Count < confirmSlots:
+		return fmt.Sprintf("no alert, green for %d of %d slots (%s)", streak.Count, confirmSlots, confirmKey)
+	case lastSlot == slotKey:
+		return fmt.Sprintf("no alert, already alerted for slot %s", slotKey)
+	case withinGap(lastSent, gap):
+		return fmt.Sprintf("no alert, last alert was less than %s ago (%s)", formatDuration(gap), gapKey)
+	case cfg.ImprovementOnly && !improved(price, lastAlertPrice, cfg.ImprovementMargin):
+		return fmt.Sprintf("no alert, not below the last alert at %s (ALERT_ON_IMPROVEMENT_ONLY)", formatPrice(cfg, lastAlertPrice))
+	case cd.snoozeRemaining > 0:
+		return fmt.Sprintf("no alert, snoozed (%d more to skip)", cd.snoozeRemaining)
+	default:
+		return "would alert"
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// errSessionExpired is returned by fetchPrices when the game rejects the session token
+var errSessionExpired = errors.New("session token expired or invalid")
+
+// refreshSession asks SESSION_REFRESH_URL for a new session cookie, updates the
+// in-memory token and remembers it in the cooldown state for restarts
+func refreshSession(client *http.Client, cfg *Config, cd *cooldown) error {
+	req, err := http.NewRequest("POST", cfg.SessionRefreshURL, strings.NewReader(cfg.SessionRefreshBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for key, value := range defaultAPIHeaders {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set("Cookie", fmt.Sprintf("shipping_manager_session=%s", cfg.SessionToken))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("refresh request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("refresh endpoint returned status %d", resp.StatusCode)
+	}
+
+	for _, c := range resp.Cookies() {
+		if c.Name == "shipping_manager_session" && c.Value != "" {
+			if cd.sessionSource == "" {
+				cd.sessionSource = tokenHash(cfg.SessionToken)
+			}
+			cfg.SessionToken = c.Value
+			cd.sessionToken = c.Value
+			log.Println("Session token refreshed")
+			return nil
+		}
+	}
+
+	return fmt.Errorf("refresh response did not set a shipping_manager_session cookie")
+}
+
+// applyRefreshedSession reuses a token refreshed in a previous run, unless the
+// SESSION_TOKEN in .env was changed since (then the user's new token wins)
+func applyRefreshedSession(cfg *Config, cd *cooldown) {
+	if cd.sessionToken == "" {
+		return
+	}
+
+	if cd.sessionSource != tokenHash(cfg.SessionToken) {
+		cd.sessionToken = ""
+		cd.sessionSource = ""
+		return
+	}
+
+	cfg.SessionToken = cd.sessionToken
+	log.Println("Using session token refreshed in a previous run")
+}
+
+// sessionConfig copies cfg under cd.mu, so a request made without holding the
+// lock sees a consistent session token while a refresh may replace it
+func sessionConfig(cfg *Config, cd *cooldown) *Config {
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+	snapshot := *cfg
+	return &snapshot
+}
+
+// tokenHash identifies a token in the state file without storing it
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
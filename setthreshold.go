@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// persistedThreshold is a threshold set with /setfuel or /setco2, together
+// with the .env value it replaced. ZoneLow is the bottom of a buy zone range.
+type persistedThreshold struct {
+	Price             int `json:"price"`
+	ZoneLow           int `json:"zone_low,omitempty"`
+	Configured        int `json:"configured"`
+	ConfiguredZoneLow int `json:"configured_zone_low,omitempty"`
+}
+
+// applyThresholdOverrides reuses thresholds set by command in a previous run,
+// unless the .env value was changed since (then the edited .env wins)
+func applyThresholdOverrides(cfg *Config, cd *cooldown) {
+	apply := func(label string, override **persistedThreshold, zoneLow, threshold *int) {
+		if *override == nil {
+			return
+		}
+		o := *override
+		if o.Configured != *threshold || o.ConfiguredZoneLow != *zoneLow {
+			log.Printf("%s threshold in .env changed, dropping the %s set by command", label, thresholdSetting(o.ZoneLow, o.Price))
+			*override = nil
+			return
+		}
+		*zoneLow, *threshold = o.ZoneLow, o.Price
+		log.Printf("%s threshold %s set by command still in effect (.env: %s)", label,
+			thresholdSetting(o.ZoneLow, o.Price), thresholdSetting(o.ConfiguredZoneLow, o.Configured))
+	}
+	apply("Fuel", &cd.setFuel, &cfg.FuelZoneLow, &cfg.FuelThreshold)
+	apply("CO2", &cd.setCO2, &cfg.CO2ZoneLow, &cfg.CO2Threshold)
+}
+
+// handleSetFuel changes the fuel threshold until changed again, across restarts.
+// Usage: /setfuel PRICE or LOW-HIGH, or /setfuel reset to go back to FUEL_THRESHOLD.
+func handleSetFuel(ctx context.Context, client *http.Client, cfg *Config, cd *cooldown, args []string) string {
+	return setThreshold(cfg, cd, args, "fuel")
+}
+
+// handleSetCO2 changes the CO2 threshold until changed again, across restarts.
+// Usage: /setco2 PRICE or LOW-HIGH, or /setco2 reset to go back to CO2_THRESHOLD.
+func handleSetCO2(ctx context.Context, client *http.Client, cfg *Config, cd *cooldown, args []string) string {
+	return setThreshold(cfg, cd, args, "co2")
+}
+
+// setThreshold updates cfg and the persisted override for one price type. A
+// single price keeps the current buy zone and must stay above its bottom.
+func setThreshold(cfg *Config, cd *cooldown, args []string, what string) string {
+	label, key, override, zoneLow, threshold := "Fuel", "FUEL_THRESHOLD", &cd.setFuel, &cfg.FuelZoneLow, &cfg.FuelThreshold
+	if what == "co2" {
+		label, key, override, zoneLow, threshold = "CO2", "CO2_THRESHOLD", &cd.setCO2, &cfg.CO2ZoneLow, &cfg.CO2Threshold
+	}
+	usage := fmt.Sprintf("Usage: /set%s PRICE (e.g. /set%s 400), /set%s LOW-HIGH for a buy zone, or /set%s reset", what, what, what, what)
+	if len(args) != 1 {
+		return usage
+	}
+
+	// Checks read the thresholds under the same lock
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+
+	configuredLow, configured := *zoneLow, *threshold
+	if *override != nil {
+		configuredLow, configured = (*override).ConfiguredZoneLow, (*override).Configured
+	}
+
+	if strings.EqualFold(args[0], "reset") {
+		*override = nil
+		*zoneLow, *threshold = configuredLow, configured
+		resetDedupOnThresholdChange(cfg, cd)
+		saveCooldown(cd)
+		log.Printf("%s threshold reset via command to %s %s", label, key, thresholdSetting(configuredLow, configured))
+		return fmt.Sprintf("%s threshold back to %s (%s).", label, formatThreshold(cfg, configuredLow, configured), key)
+	}
+
+	low, price := *zoneLow, 0
+	if lowText, highText, isRange := strings.Cut(args[0], "-"); isRange {
+		var errLow, errHigh error
+		low, errLow = strconv.Atoi(lowText)
+		price, errHigh = strconv.Atoi(highText)
+		if errLow != nil || errHigh != nil || low <= 0 || low >= price {
+			return fmt.Sprintf("A buy zone must be LOW-HIGH with whole numbers and 0 < LOW < HIGH. %s", usage)
+		}
+	} else {
+		var err error
+		price, err = strconv.Atoi(args[0])
+		if err != nil || price <= 0 {
+			return fmt.Sprintf("The price must be a positive whole number. %s", usage)
+		}
+		if low > 0 && price <= low {
+			return fmt.Sprintf("The price must be above your buy zone starting at %s, or set a new zone with /set%s LOW-HIGH.",
+				formatPrice(cfg, low), what)
+		}
+	}
+
+	*override = &persistedThreshold{Price: price, ZoneLow: low, Configured: configured, ConfiguredZoneLow: configuredLow}
+	*zoneLow, *threshold = low, price
+	resetDedupOnThresholdChange(cfg, cd)
+	saveCooldown(cd)
+	log.Printf("%s threshold set via command: %s (%s: %s)", label, thresholdSetting(low, price), key, thresholdSetting(configuredLow, configured))
+	return fmt.Sprintf("%s threshold set to %s. It stays in effect after restarts until changed, /set%s reset goes back to %s.",
+		label, formatThreshold(cfg, low, price), what, formatThreshold(cfg, configuredLow, configured))
+}
+
+// formatThreshold renders a threshold for chat replies, as a range with a buy zone
+func formatThreshold(cfg *Config, zoneLow, threshold int) string {
+	if zoneLow > 0 {
+		return formatPrice(cfg, zoneLow) + "-" + formatPrice(cfg, threshold)
+	}
+	return formatPrice(cfg, threshold)
+}
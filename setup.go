@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// setupField describes a single value asked for during interactive setup
+type setupField struct {
+	Key      string
+	Prompt   string
+	Numeric  bool
+	Optional bool
+}
+
+// setupFields lists the values collected by the interactive setup, in prompt order
+var setupFields = []setupField{
+	{Key: "TELEGRAM_BOT_TOKEN", Prompt: "Telegram bot token (from @BotFather)"},
+	{Key: "TELEGRAM_CHAT_ID", Prompt: "Telegram chat ID (group IDs start with -)"},
+	{Key: "SESSION_TOKEN", Prompt: "Shipping Manager session token (cookie \"shipping_manager_session\")"},
+	{Key: "FUEL_THRESHOLD", Prompt: "Fuel price threshold in $/t", Numeric: true},
+	{Key: "CO2_THRESHOLD", Prompt: "CO2 price threshold in $/t", Numeric: true},
+	{Key: "TIMEZONE", Prompt: "Timezone for log output (e.g. CET, leave empty for system timezone)", Optional: true},
+}
+
+// isInteractive reports whether the bot is attached to a terminal.
+// Both stdin and stdout must be terminals, so services (systemd, NSSM, launchd)
+// whose stdin is /dev/null but whose output goes to a log are not prompted.
+func isInteractive() bool {
+	for _, f := range []*os.File{os.Stdin, os.Stdout} {
+		fi, err := f.Stat()
+		if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// runSetup prompts for the required config values and offers to save them to .env
+func runSetup(in io.Reader, out io.Writer) (map[string]string, error) {
+	reader := bufio.NewReader(in)
+	vars := make(map[string]string)
+
+	fmt.Fprintln(out, "No .env file found. Let's set up the bot.")
+	fmt.Fprintln(out, "See README.md for how to get each value.")
+	fmt.Fprintln(out)
+
+	for _, field := range setupFields {
+		for {
+			value, err := promptLine(reader, out, field.Prompt)
+			if err != nil {
+				return nil, err
+			}
+
+			if value == "" {
+				if field.Optional {
+					break
+				}
+				fmt.Fprintln(out, "This value is required.")
+				continue
+			}
+
+			if field.Numeric {
+				if _, err := strconv.Atoi(value); err != nil {
+					fmt.Fprintln(out, "Please enter a whole number.")
+					continue
+				}
+			}
+
+			vars[field.Key] = value
+			break
+		}
+	}
+
+	path := envWritePath()
+	answer, err := promptLine(reader, out, fmt.Sprintf("Save these settings to %s? [Y/n]", path))
+	if err != nil {
+		return nil, err
+	}
+
+	if answer == "" || strings.EqualFold(answer, "y") || strings.EqualFold(answer, "yes") {
+		if err := writeEnvFile(path, vars); err != nil {
+			return nil, err
+		}
+		log.Printf("Config saved to: %s", path)
+	} else {
+		log.Println("Config not saved, settings will only be used for this run")
+	}
+
+	return vars, nil
+}
+
+// promptLine prints a prompt and reads one trimmed line of input
+func promptLine(reader *bufio.Reader, out io.Writer, prompt string) (string, error) {
+	fmt.Fprintf(out, "%s: ", prompt)
+	line, err := reader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("failed to read input: %w", err)
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// envWritePath returns where interactive setup saves .env (next to the executable)
+func envWritePath() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return ".env"
+	}
+	return filepath.Join(filepath.Dir(exe), ".env")
+}
+
+// writeEnvFile writes the collected setup values as a .env file.
+// The file contains secrets, so it is only readable by the current user.
+func writeEnvFile(path string, vars map[string]string) error {
+	var b strings.Builder
+	b.WriteString("# Generated by interactive setup, see .env.example for all options\n")
+	for _, field := range setupFields {
+		if value, ok := vars[field.Key]; ok {
+			fmt.Fprintf(&b, "%s=%s\n", field.Key, value)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte(b.String()), 0600); err != nil {
+		return fmt.Errorf("failed to write .env: %w", err)
+	}
+	return nil
+}
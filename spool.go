@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// fileNotifier writes each message into a spool directory for a separate
+// relay to deliver. Every message is its own <unix-nanos>-<n>.json file holding
+// one spoolEntry as a JSON line. Files are written under a dot-prefixed temp
+// name and renamed into place, so a relay that picks up *.json in name order
+// (and deletes them once sent) never reads a partial message.
+type fileNotifier struct {
+	dir string
+}
+
+// spoolEntry is the on-disk format of a spooled message
+type spoolEntry struct {
+	Time      string `json:"time"`
+	Text      string `json:"text"`
+	ParseMode string `json:"parse_mode,omitempty"`
+	Silent    bool   `json:"silent,omitempty"`
+}
+
+func (n *fileNotifier) Send(client *http.Client, message string, opts sendOptions) error {
+	// Created on demand, a reload may have pointed SPOOL_DIR somewhere new
+	if err := ensureSpoolDir(n.dir); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	data, err := json.Marshal(spoolEntry{
+		Time:      now.Format(time.RFC3339),
+		Text:      message,
+		ParseMode: telegramParseMode(opts),
+		Silent:    opts.Silent,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal spool entry: %w", err)
+	}
+
+	// The counter keeps names unique and ordered within the same nanosecond
+	name := fmt.Sprintf("%d-%d.json", now.UnixNano(), messageSeq.Add(1))
+	if err := writeFileAtomic(filepath.Join(n.dir, name), append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to spool message: %w", err)
+	}
+
+	log.Printf("Message spooled to %s", name)
+	return nil
+}
+
+func (n *fileNotifier) Target() string {
+	return fmt.Sprintf("spool directory %s", n.dir)
+}
+
+// ensureSpoolDir creates the spool directory if it doesn't exist yet
+func ensureSpoolDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("SPOOL_DIR could not be created: %w", err)
+	}
+	return nil
+}
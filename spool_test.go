@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileNotifierSend(t *testing.T) {
+	// The spool directory doesn't exist yet, the first send creates it
+	dir := filepath.Join(t.TempDir(), "spool")
+	n := &fileNotifier{dir: dir}
+
+	messages := []struct {
+		text string
+		opts sendOptions
+		want spoolEntry
+	}{
+		{"*Fuel* is cheap", sendOptions{}, spoolEntry{Text: "*Fuel* is cheap", ParseMode: "Markdown"}},
+		{"Daily summary", sendOptions{Silent: true}, spoolEntry{Text: "Daily summary", ParseMode: "Markdown", Silent: true}},
+		{"<b>HTML</b>", sendOptions{ParseMode: "HTML"}, spoolEntry{Text: "<b>HTML</b>", ParseMode: "HTML"}},
+		{"plain_text", sendOptions{ParseMode: parseModePlain}, spoolEntry{Text: "plain_text"}},
+	}
+	for _, m := range messages {
+		if err := n.Send(nil, m.text, m.opts); err != nil {
+			t.Fatalf("Send(%q): %v", m.text, err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read spool dir: %v", err)
+	}
+	if len(entries) != len(messages) {
+		t.Fatalf("spool holds %d files, want %d (no temp files left behind)", len(entries), len(messages))
+	}
+	// ReadDir sorts by name, which is the send order
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+
+	namePattern := regexp.MustCompile(`^\d+-\d+\.json$`)
+	for i, name := range names {
+		if !namePattern.MatchString(name) {
+			t.Errorf("file name %q, want <unix-nanoseconds>-<n>.json", name)
+		}
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("stat %s: %v", name, err)
+		}
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Errorf("%s has mode %v, want 0600", name, perm)
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		if !strings.HasSuffix(string(data), "}\n") || strings.Count(string(data), "\n") != 1 {
+			t.Errorf("%s holds %q, want one JSON line", name, data)
+		}
+		var got spoolEntry
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("%s is not JSON: %v", name, err)
+		}
+		if _, err := time.Parse(time.RFC3339, got.Time); err != nil {
+			t.Errorf("%s time %q is not RFC 3339: %v", name, got.Time, err)
+		}
+		got.Time = ""
+		if got != messages[i].want {
+			t.Errorf("%s holds %+v, want %+v", name, got, messages[i].want)
+		}
+	}
+
+	// Plain text messages leave parse_mode out
+	data, _ := os.ReadFile(filepath.Join(dir, names[3]))
+	if strings.Contains(string(data), "parse_mode") {
+		t.Errorf("plain message %s has a parse_mode: %s", names[3], data)
+	}
+}
+
+func TestFileNotifierAtomic(t *testing.T) {
+	dir := t.TempDir()
+	n := &fileNotifier{dir: dir}
+	text := strings.Repeat("x", 256*1024)
+
+	// A relay reading *.json meanwhile only ever sees complete messages
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	defer func() {
+		close(done)
+		wg.Wait()
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			paths, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+			for _, path := range paths {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					continue
+				}
+				var entry spoolEntry
+				if err := json.Unmarshal(data, &entry); err != nil || entry.Text != text {
+					t.Errorf("relay read a partial message from %s (%d bytes)", filepath.Base(path), len(data))
+					return
+				}
+			}
+		}
+	}()
+
+	for range 20 {
+		if err := n.Send(nil, text, sendOptions{}); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+}
+
+func TestWriteFileAtomicFailedRename(t *testing.T) {
+	dir := t.TempDir()
+	// A non-empty directory in the way makes the rename fail
+	target := filepath.Join(dir, "1-1.json")
+	if err := os.MkdirAll(filepath.Join(target, "busy"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFileAtomic(target, []byte("{}\n"), 0600); err == nil {
+		t.Fatal("writeFileAtomic succeeded, want the rename to fail")
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			t.Errorf("temp file %s left behind after the failed rename", e.Name())
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// errNoState is returned by StateStore.Load when nothing was saved yet
+var errNoState = errors.New("no saved state")
+
+// StateStore persists the cooldown state between runs. Load returns
+// errNoState on a first run, any other error means the state was unreadable.
+type StateStore interface {
+	Load() (cooldownState, error)
+	Save(state cooldownState) error
+	// Name describes the store for logs
+	Name() string
+}
+
+// slotClaimer is implemented by stores that several instances share. Claim
+// reports whether this instance is the first to claim name, and the claim
+// expires after ttl. Release gives it up again.
+type slotClaimer interface {
+	Claim(name string, ttl time.Duration) (bool, error)
+	Release(name string) error
+}
+
+// claimTTL is how long an alert claim is held, well past the slot it is for
+const claimTTL = 24 * time.Hour
+
+// newStateStore builds the store selected by STATE_BACKEND
+func newStateStore(cfg *Config) StateStore {
+	if cfg.StateBackend == "redis" {
+		return &redisStore{url: cfg.RedisURL, key: cfg.RedisKey}
+	}
+	return &fileStore{path: cooldownFilePath()}
+}
+
+// fileStore keeps the state in the .cooldown file next to the executable,
+// with a copy of the last good save in .cooldown.bak
+type fileStore struct {
+	path string
+}
+
+func (s *fileStore) Load() (cooldownState, error) {
+	state, err := readCooldownState(s.path)
+	if os.IsNotExist(err) {
+		return state, errNoState
+	}
+	if err != nil {
+		log.Printf("WARNING: Failed to read .cooldown file: %s", err)
+		state, err = readCooldownState(s.path + ".bak")
+		if err != nil {
+			return state, err
+		}
+		log.Println("Restored state from .cooldown.bak")
+	}
+	return state, nil
+}
+
+func (s *fileStore) Save(state cooldownState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+
+	// A refreshed session token is a secret, keep the file private then
+	perm := os.FileMode(0644)
+	if state.SessionToken != "" {
+		perm = 0600
+	}
+
+	// Replace the file atomically and keep a copy of the last good save, which
+	// Load falls back to if the main file is ever unreadable
+	if err := writeFileAtomic(s.path, data, perm); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.path+".bak", data, perm); err != nil {
+		log.Printf("WARNING: Failed to save .cooldown.bak file: %s", err)
+	}
+	return nil
+}
+
+func (s *fileStore) Name() string {
+	return s.path
+}
+
+// refreshSharedState re-reads the dedup state from a store shared with other
+// instances at the start of a check, so a slot another instance alerted since
+// the last check is not alerted here again. Other stores are left alone.
+func refreshSharedState(cd *cooldown) {
+	if _, ok := cd.store.(slotClaimer); !ok {
+		return
+	}
+	state, err := cd.store.Load()
+	if err != nil {
+		if !errors.Is(err, errNoState) {
+			log.Printf("WARNING: Failed to refresh state from %s: %s", cd.store.Name(), err)
+		}
+		return
+	}
+	cd.lastFuelSlot = state.LastFuelSlot
+	cd.lastCO2Slot = state.LastCO2Slot
+	cd.lastFuelThreshold = state.FuelAlertAt
+	cd.lastCO2Threshold = state.CO2AlertAt
+	cd.lastFuelSent = parseStateTime(state.LastFuelSent)
+	cd.lastCO2Sent = parseStateTime(state.LastCO2Sent)
+	cd.lastFuelAlertPrice = state.FuelAlerted
+	cd.lastCO2AlertPrice = state.CO2Alerted
+}
+
+// claimAlerts claims slotKey for each price type about to alert, when the
+// store is shared with other instances. A type another instance claimed first
+// is marked as alerted and dropped. If the claim fails the alert still goes
+// out, a duplicate is better than a missed alert. The returned release gives
+// the claims back when the alert could not be sent.
+func claimAlerts(cfg *Config, cd *cooldown, slotKey string, fuel, co2 bool) (bool, bool, func()) {
+	claimer, ok := cd.store.(slotClaimer)
+	if !ok {
+		return fuel, co2, func() {}
+	}
+	var claimed []string
+	claim := func(kind string, threshold int) bool {
+		name := fmt.Sprintf("%s:%s:%d", kind, slotKey, threshold)
+		won, err := claimer.Claim(name, claimTTL)
+		if err != nil {
+			log.Printf("WARNING: Failed to claim the %s alert for slot %s, sending it anyway: %s", kind, slotKey, err)
+			return true
+		}
+		if !won {
+			log.Printf("The %s alert for slot %s was already sent by another instance", kind, slotKey)
+			return false
+		}
+		claimed = append(claimed, name)
+		return true
+	}
+
+	if fuel && !claim("fuel", cfg.FuelThreshold) {
+		fuel = false
+		cd.lastFuelSlot = slotKey
+		cd.lastFuelThreshold = cfg.FuelThreshold
+	}
+	if co2 && !claim("co2", cfg.CO2Threshold) {
+		co2 = false
+		cd.lastCO2Slot = slotKey
+		cd.lastCO2Threshold = cfg.CO2Threshold
+	}
+	release := func() {
+		for _, name := range claimed {
+			if err := claimer.Release(name); err != nil {
+				log.Printf("WARNING: Failed to release alert claim %s: %s", name, err)
+			}
+		}
+	}
+	return fuel, co2, release
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStoreBackupFallback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".cooldown")
+	store := &fileStore{path: path}
+
+	if err := store.Save(cooldownState{LastFuelSlot: "10:00-d3", UpdateOffset: 7}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	// A write cut short leaves a truncated primary next to the last good .bak
+	if err := os.WriteFile(path, []byte(`{"last_fuel_sl`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if state.LastFuelSlot != "10:00-d3" || state.UpdateOffset != 7 {
+		t.Errorf("Load = %+v, want the .bak contents", state)
+	}
+}
+
+func TestFileStoreLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		primary string // "" leaves the file out
+		backup  string
+		wantErr error
+		anyErr  bool
+	}{
+		{name: "first run", wantErr: errNoState},
+		{name: "primary wins", primary: `{"last_fuel_slot":"a"}`, backup: `{"last_fuel_slot":"b"}`},
+		{name: "corrupt without backup", primary: `{`, anyErr: true},
+		{name: "both corrupt", primary: `{`, backup: `not json`, anyErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), ".cooldown")
+			if tt.primary != "" {
+				os.WriteFile(path, []byte(tt.primary), 0644)
+			}
+			if tt.backup != "" {
+				os.WriteFile(path+".bak", []byte(tt.backup), 0644)
+			}
+
+			state, err := (&fileStore{path: path}).Load()
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Load error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.anyErr:
+				if err == nil || errors.Is(err, errNoState) {
+					t.Errorf("Load error = %v, want a read error", err)
+				}
+			default:
+				if err != nil || state.LastFuelSlot != "a" {
+					t.Errorf("Load = %+v, %v, want the primary file", state, err)
+				}
+			}
+		})
+	}
+}
+
+func TestReadCooldownState(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		content  string // "" leaves the file out
+		wantSlot string
+		notExist bool
+		wantErr  bool
+	}{
+		{name: "missing file", notExist: true, wantErr: true},
+		{name: "valid state", content: `{"last_fuel_slot":"a"}`, wantSlot: "a"},
+		{name: "corrupt", content: `{`, wantErr: true},
+	}
+	for i, tt := range tests {
+		path := filepath.Join(dir, string(rune('a'+i))+".cooldown")
+		if tt.content != "" {
+			os.WriteFile(path, []byte(tt.content), 0644)
+		}
+
+		state, err := readCooldownState(path)
+		if (err != nil) != tt.wantErr || os.IsNotExist(err) != tt.notExist {
+			t.Errorf("%s: readCooldownState error = %v", tt.name, err)
+			continue
+		}
+		if state.LastFuelSlot != tt.wantSlot {
+			t.Errorf("%s: last fuel slot = %q, want %q", tt.name, state.LastFuelSlot, tt.wantSlot)
+		}
+	}
+}
+
+func TestWriteFileAtomicKeepsNoTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".cooldown")
+	for _, content := range []string{"one", "two", "three"} {
+		if err := writeFileAtomic(path, []byte(content), 0600); err != nil {
+			t.Fatalf("writeFileAtomic: %v", err)
+		}
+	}
+
+	if data, _ := os.ReadFile(path); string(data) != "three" {
+		t.Errorf("file holds %q, want the last write", data)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("directory holds %q, want only .cooldown", names)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// statusFile is the machine-readable snapshot written to STATUS_FILE after each check
+type statusFile struct {
+	UpdatedAt     string     `json:"updated_at"`
+	Healthy       bool       `json:"healthy"`
+	LastCheck     string     `json:"last_check,omitempty"`
+	Slot          string     `json:"slot,omitempty"`
+	Day           int        `json:"day,omitempty"`
+	FuelPrice     int        `json:"fuel_price,omitempty"`
+	CO2Price      int        `json:"co2_price,omitempty"`
+	FuelThreshold int        `json:"fuel_threshold"`
+	CO2Threshold  int        `json:"co2_threshold"`
+	LastFuelAlert string     `json:"last_fuel_alert,omitempty"`
+	LastCO2Alert  string     `json:"last_co2_alert,omitempty"`
+	Stats         checkStats `json:"stats"`
+
+	// VERIFY_TELEGRAM result, telegram_ok is omitted when the check is off
+	TelegramOK    *bool  `json:"telegram_ok,omitempty"`
+	TelegramError string `json:"telegram_error,omitempty"`
+}
+
+// writeStatusFile writes the current check status to STATUS_FILE, if configured.
+// Prices are the last successfully fetched ones, healthy reports whether this check succeeded.
+func writeStatusFile(cfg *Config, cd *cooldown, healthy bool) {
+	if cfg.StatusFile == "" {
+		return
+	}
+
+	status := statusFile{
+		UpdatedAt:     time.Now().Format(time.RFC3339),
+		Healthy:       healthy,
+		LastCheck:     formatStateTime(cd.lastCheck),
+		FuelThreshold: cfg.FuelThreshold,
+		CO2Threshold:  cfg.CO2Threshold,
+		LastFuelAlert: formatStateTime(cd.lastFuelSent),
+		LastCO2Alert:  formatStateTime(cd.lastCO2Sent),
+		Stats:         cd.stats,
+	}
+	if cfg.VerifyTelegram && !cd.telegramVerifiedAt.IsZero() {
+		ok := cd.telegramError == ""
+		status.TelegramOK = &ok
+		status.TelegramError = cd.telegramError
+	}
+	if cd.lastPrices != nil {
+		status.Slot = cd.lastPrices.Time
+		status.Day = cd.lastPrices.Day
+		status.FuelPrice = cd.lastPrices.FuelPrice
+		status.CO2Price = cd.lastPrices.CO2Price
+	}
+
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		log.Printf("WARNING: Failed to marshal status: %s", err)
+		return
+	}
+
+	if err := writeFileAtomic(cfg.StatusFile, data, 0644); err != nil {
+		log.Printf("WARNING: Failed to write status file: %s", err)
+	}
+}
+
+// writeFileAtomic writes data to a temp file in the target directory and renames
+// it over path, so readers never see a partially written file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	// Flush before the rename, so a crash can't leave an empty file in place
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to sync temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to set permissions: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// dailyLows are the lowest prices seen on one local day, for SUMMARY_TIME
+type dailyLows struct {
+	Date     string `json:"date"`
+	Fuel     int    `json:"fuel,omitempty"`
+	FuelSlot string `json:"fuel_slot,omitempty"`
+	CO2      int    `json:"co2,omitempty"`
+	CO2Slot  string `json:"co2_slot,omitempty"`
+	Sent     bool   `json:"sent,omitempty"`
+}
+
+// recordDailyLow keeps the day's lowest prices, starting over on the first
+// check of a new day in TIMEZONE. Caller must hold cd.mu.
+func recordDailyLow(cfg *Config, cd *cooldown, now time.Time, slot *PriceSlot) {
+	today := now.In(cfg.Timezone).Format("2006-01-02")
+	if cd.dailyLows.Date != today {
+		cd.dailyLows = dailyLows{Date: today}
+	}
+
+	lows := &cd.dailyLows
+	if slot.FuelPrice > 0 && (lows.Fuel == 0 || slot.FuelPrice < lows.Fuel) {
+		lows.Fuel, lows.FuelSlot = slot.FuelPrice, slot.Time
+	}
+	if co2Valid(cfg, slot) && (lows.CO2Slot == "" || slot.CO2Price < lows.CO2) {
+		lows.CO2, lows.CO2Slot = slot.CO2Price, slot.Time
+	}
+}
+
+// checkDailySummary sends the day's lows with the first check at or after
+// SUMMARY_TIME, once per day
+func checkDailySummary(client *http.Client, cfg *Config, cd *cooldown) {
+	if cfg.SummaryTime == "" {
+		return
+	}
+
+	cd.mu.Lock()
+	local := time.Now().In(cfg.Timezone)
+	lows := cd.dailyLows
+	// Zero-padded HH:MM strings compare in time order
+	due := lows.Date == local.Format("2006-01-02") && !lows.Sent && (lows.FuelSlot != "" || lows.CO2Slot != "") &&
+		local.Format("15:04") >= cfg.SummaryTime
+	cd.mu.Unlock()
+	if !due {
+		return
+	}
+
+	message := "*Today's lows*\n"
+	if lows.FuelSlot != "" {
+		message += fmt.Sprintf("\nFuel *%s* at %s (%s)", formatPrice(cfg, lows.Fuel), lows.FuelSlot, cfg.SlotTimezone)
+	}
+	if lows.CO2Slot != "" {
+		message += fmt.Sprintf("\nCO2 *%s* at %s (%s)", formatPrice(cfg, lows.CO2), lows.CO2Slot, cfg.SlotTimezone)
+	}
+	err := notifyWith(client, cfg, message, sendOptions{Silent: true})
+
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+	if err != nil {
+		log.Printf("ERROR sending daily summary: %s", err)
+		cd.stats.SendErrors++
+		cd.recordError(err)
+		return
+	}
+	if cd.dailyLows.Date == lows.Date {
+		cd.dailyLows.Sent = true
+	}
+	saveCooldown(cd)
+	log.Printf("Daily summary sent (fuel low $%d/t at %s, CO2 low $%d/t at %s)", lows.Fuel, formatSlot(lows.FuelSlot), lows.CO2, formatSlot(lows.CO2Slot))
+}
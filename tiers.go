@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// chatTier routes price alerts at least MinDiscount percent below threshold
+// to more Telegram chats
+type chatTier struct {
+	MinDiscount float64
+	ChatIDs     []string
+}
+
+// parseTierChats reads TIER_CHATS, e.g. "15:@fueldeals;5:-1001234567890,987654321".
+// Tiers are returned deepest discount first.
+func parseTierChats(value string) ([]chatTier, error) {
+	var tiers []chatTier
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pct, chats, ok := strings.Cut(entry, ":")
+		chatIDs := parseChatIDs(chats)
+		if !ok || len(chatIDs) == 0 {
+			return nil, fmt.Errorf("TIER_CHATS entries must be PERCENT:chat,chat, got: %s", entry)
+		}
+		minDiscount, err := strconv.ParseFloat(strings.TrimSpace(pct), 64)
+		if err != nil || minDiscount < 0 || minDiscount >= 100 {
+			return nil, fmt.Errorf("TIER_CHATS percent must be from 0 to below 100, got: %s", pct)
+		}
+		tiers = append(tiers, chatTier{MinDiscount: minDiscount, ChatIDs: chatIDs})
+	}
+
+	sort.SliceStable(tiers, func(i, j int) bool { return tiers[i].MinDiscount > tiers[j].MinDiscount })
+	return tiers, nil
+}
+
+// alertDiscount returns how far the shown prices go below their thresholds,
+// in percent of the threshold. With both shown the deeper one counts.
+func alertDiscount(cfg *Config, slot *PriceSlot, fuel, co2 bool) float64 {
+	var discount float64
+	if fuel {
+		discount = max(discount, discountPct(slot.FuelPrice, cfg.FuelThreshold))
+	}
+	if co2 {
+		discount = max(discount, discountPct(slot.CO2Price, cfg.CO2Threshold))
+	}
+	return discount
+}
+
+// discountPct returns how many percent price is below threshold, 0 when it isn't
+func discountPct(price, threshold int) float64 {
+	if price <= 0 || threshold <= 0 || price > threshold {
+		return 0
+	}
+	return float64(threshold-price) / float64(threshold) * 100
+}
+
+// tierFor returns the deepest tier an alert discount reaches, nil when none does
+func tierFor(tiers []chatTier, discount float64) *chatTier {
+	for i := range tiers {
+		if discount >= tiers[i].MinDiscount {
+			return &tiers[i]
+		}
+	}
+	return nil
+}
+
+// tierAlert is the last price alert sent with TIER_CHATS
+type tierAlert struct {
+	Discount float64 `json:"discount"`       // MinDiscount of the tier it reached, 0 for none
+	Fuel     int     `json:"fuel,omitempty"` // last alerted prices per type
+	CO2      int     `json:"co2,omitempty"`
+}
+
+// selectTier returns the tier a price alert discount percent below threshold
+// goes to. With MIN_TIER_IMPROVEMENT, a tier deeper than the last alert's is
+// only reached once a shown price is at least that much below its last
+// alerted price. Until then the alert stays in the last alert's tier.
+func selectTier(cfg *Config, last *tierAlert, discount float64, slot *PriceSlot, fuel, co2 bool) *chatTier {
+	tier := tierFor(cfg.TierChats, discount)
+	if tier == nil || last == nil || cfg.MinTierImprovement <= 0 {
+		return tier
+	}
+	lastTier := tierFor(cfg.TierChats, last.Discount)
+	if lastTier != nil && tier.MinDiscount <= lastTier.MinDiscount {
+		return tier
+	}
+
+	if fuel && improvedBy(slot.FuelPrice, last.Fuel, cfg.MinTierImprovement) ||
+		co2 && improvedBy(slot.CO2Price, last.CO2, cfg.MinTierImprovement) {
+		return tier
+	}
+	log.Printf("Alert reaches the %g%% tier but improved less than MIN_TIER_IMPROVEMENT ($%d) on the last alert, keeping its tier",
+		tier.MinDiscount, cfg.MinTierImprovement)
+	return lastTier
+}
+
+// improvedBy reports whether price is at least margin below last, or there is
+// no last price to compare with
+func improvedBy(price, last, margin int) bool {
+	return last == 0 || price <= last-margin
+}
+
+// nextTierAlert returns last updated with an alert sent to tier. Types the
+// alert didn't show keep their last alerted price.
+func nextTierAlert(last *tierAlert, tier *chatTier, slot *PriceSlot, fuel, co2 bool) *tierAlert {
+	next := tierAlert{}
+	if last != nil {
+		next = *last
+	}
+	next.Discount = 0
+	if tier != nil {
+		next.Discount = tier.MinDiscount
+	}
+	if fuel {
+		next.Fuel = slot.FuelPrice
+	}
+	if co2 {
+		next.CO2 = slot.CO2Price
+	}
+	return &next
+}
+
+// alertChatIDs returns the chats a price alert goes to besides
+// TELEGRAM_CHAT_ID: EXTRA_CHAT_IDS and the chats of tier, each chat once
+func alertChatIDs(cfg *Config, tier *chatTier) []string {
+	chatIDs := slices.Clone(cfg.ExtraChatIDs)
+	if tier == nil {
+		return chatIDs
+	}
+	for _, chatID := range tier.ChatIDs {
+		if chatID != targetChatID(cfg) && !slices.Contains(chatIDs, chatID) {
+			chatIDs = append(chatIDs, chatID)
+		}
+	}
+	return chatIDs
+}
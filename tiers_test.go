@@ -0,0 +1,124 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseTierChats(t *testing.T) {
+	tiers, err := parseTierChats("5:1001234567890; 15:@fueldeals, -1002 ;")
+	if err != nil {
+		t.Fatalf("parseTierChats: %v", err)
+	}
+	if len(tiers) != 2 {
+		t.Fatalf("got %d tiers, want 2: %+v", len(tiers), tiers)
+	}
+	// Deepest tier first, chat IDs read like EXTRA_CHAT_IDS
+	if tiers[0].MinDiscount != 15 || !slices.Equal(tiers[0].ChatIDs, []string{"@fueldeals", "-1002"}) {
+		t.Errorf("first tier = %+v, want 15%% to @fueldeals and -1002", tiers[0])
+	}
+	if tiers[1].MinDiscount != 5 || !slices.Equal(tiers[1].ChatIDs, []string{"-1001234567890"}) {
+		t.Errorf("second tier = %+v, want 5%% to -1001234567890", tiers[1])
+	}
+
+	if tiers, err := parseTierChats(""); err != nil || tiers != nil {
+		t.Errorf("parseTierChats(\"\") = %+v, %v, want no tiers", tiers, err)
+	}
+	for _, value := range []string{"15", "15:", "15: , ", "x:@fueldeals", "100:@fueldeals", "-5:@fueldeals"} {
+		if _, err := parseTierChats(value); err == nil {
+			t.Errorf("parseTierChats(%q) accepted", value)
+		}
+	}
+}
+
+func TestAlertTierRouting(t *testing.T) {
+	tiers, err := parseTierChats("15:@fueldeals;5:-1002,-1001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{
+		TelegramChatID: "-1001",
+		FuelThreshold:  500,
+		CO2Threshold:   10,
+		ExtraChatIDs:   []string{"-1002", "-1003"},
+		TierChats:      tiers,
+	}
+
+	tests := []struct {
+		name      string
+		slot      PriceSlot
+		fuel, co2 bool
+		want      []string
+	}{
+		{"fuel 2% below", PriceSlot{FuelPrice: 490}, true, false, []string{"-1002", "-1003"}},
+		{"fuel 10% below", PriceSlot{FuelPrice: 450}, true, false, []string{"-1002", "-1003"}},
+		{"fuel 20% below", PriceSlot{FuelPrice: 400}, true, false, []string{"-1002", "-1003", "@fueldeals"}},
+		{"fuel exactly 15% below", PriceSlot{FuelPrice: 425}, true, false, []string{"-1002", "-1003", "@fueldeals"}},
+		// With both shown the deeper discount picks the tier
+		{"CO2 deeper than fuel", PriceSlot{FuelPrice: 490, CO2Price: 8}, true, true, []string{"-1002", "-1003", "@fueldeals"}},
+		// A price that isn't shown doesn't count
+		{"CO2 not shown", PriceSlot{FuelPrice: 490, CO2Price: 8}, true, false, []string{"-1002", "-1003"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tier := tierFor(cfg.TierChats, alertDiscount(cfg, &tt.slot, tt.fuel, tt.co2))
+			if got := alertChatIDs(cfg, tier); !slices.Equal(got, tt.want) {
+				t.Errorf("chats = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Without tiers only EXTRA_CHAT_IDS get the alert
+	cfg.TierChats = nil
+	if got := alertChatIDs(cfg, tierFor(cfg.TierChats, 50)); !slices.Equal(got, cfg.ExtraChatIDs) {
+		t.Errorf("chats without TIER_CHATS = %q, want EXTRA_CHAT_IDS", got)
+	}
+}
+
+func TestMinTierImprovement(t *testing.T) {
+	tiers, err := parseTierChats("15:@fueldeals;5:-1002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{FuelThreshold: 500, CO2Threshold: 10, TierChats: tiers, MinTierImprovement: 10}
+
+	// Each alert in turn, the guard compares with the one before
+	steps := []struct {
+		name string
+		fuel int
+		want float64 // MinDiscount of the tier reached, -1 for none
+	}{
+		{"first alert, no tier", 490, -1},
+		{"into the 5% tier, $60 better", 430, 5},
+		{"just across into the 15% tier, $6 better", 424, 5},
+		{"$10 better than the last alert", 414, 15},
+		{"staying in the 15% tier needs no improvement", 420, 15},
+		{"back in the 5% tier", 450, 5},
+	}
+	var last *tierAlert
+	for _, step := range steps {
+		slot := &PriceSlot{FuelPrice: step.fuel}
+		tier := selectTier(cfg, last, alertDiscount(cfg, slot, true, false), slot, true, false)
+		got := -1.0
+		if tier != nil {
+			got = tier.MinDiscount
+		}
+		if got != step.want {
+			t.Errorf("%s ($%d): tier %g, want %g", step.name, step.fuel, got, step.want)
+		}
+		last = nextTierAlert(last, tier, slot, true, false)
+	}
+
+	// A CO2 alert keeps the last fuel price to compare with
+	last = nextTierAlert(last, nil, &PriceSlot{CO2Price: 9}, false, true)
+	if last.Fuel != 450 || last.CO2 != 9 || last.Discount != 0 {
+		t.Errorf("last alert = %+v, want fuel $450, CO2 $9 and no tier", *last)
+	}
+
+	// Without MIN_TIER_IMPROVEMENT the deepest tier reached always counts
+	cfg.MinTierImprovement = 0
+	slot := &PriceSlot{FuelPrice: 424}
+	if tier := selectTier(cfg, &tierAlert{Discount: 5, Fuel: 425}, alertDiscount(cfg, slot, true, false), slot, true, false); tier == nil || tier.MinDiscount != 15 {
+		t.Errorf("tier without the guard = %+v, want 15%%", tier)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed VERSION
+var versionFile string
+
+// releasesURL is the GitHub API endpoint for the latest published release
+const releasesURL = "https://api.github.com/repos/justonlyforyou/shippingmanager_alertbot_telegram/releases/latest"
+
+// updateCheckInterval throttles release checks to once a day
+const updateCheckInterval = 24 * time.Hour
+
+// githubRelease is the part of the GitHub release response the update check uses
+type githubRelease struct {
+	TagName string `json:"tag_name"`
+	HTMLURL string `json:"html_url"`
+}
+
+// currentVersion returns the version the binary was built from, e.g. "v0.0.1"
+func currentVersion() string {
+	return "v" + strings.TrimSpace(versionFile)
+}
+
+// checkForUpdate sends a one-time notice when a newer release is published.
+// Runs at most once a day and only when UPDATE_CHECK is enabled.
+func checkForUpdate(client *http.Client, cfg *Config, cd *cooldown) {
+	if !cfg.UpdateCheck {
+		return
+	}
+
+	cd.mu.Lock()
+	if time.Since(cd.lastUpdateCheck) < updateCheckInterval {
+		cd.mu.Unlock()
+		return
+	}
+	cd.lastUpdateCheck = time.Now()
+	saveCooldown(cd)
+	notified := cd.notifiedVersion
+	cd.mu.Unlock()
+
+	// The GitHub request and the notice go out without holding the state lock
+	release, err := fetchLatestRelease(client)
+	if err != nil {
+		log.Printf("WARNING: Update check failed: %s", err)
+		return
+	}
+
+	if !isNewerVersion(release.TagName, currentVersion()) {
+		log.Printf("Update check: running the latest version (%s)", currentVersion())
+		return
+	}
+	if notified == release.TagName {
+		return
+	}
+
+	log.Printf("Update available: %s (running %s)", release.TagName, currentVersion())
+	message := fmt.Sprintf("*Update available, Captain!*\n\nAlert bot %s is out, you are running %s.\n\n[Download the new version](%s)",
+		release.TagName, currentVersion(), release.HTMLURL)
+	if err := notify(client, cfg, message); err != nil {
+		log.Printf("ERROR sending update notice: %s", err)
+		return
+	}
+
+	cd.mu.Lock()
+	cd.notifiedVersion = release.TagName
+	saveCooldown(cd)
+	cd.mu.Unlock()
+}
+
+// fetchLatestRelease queries the GitHub releases API for the latest release
+func fetchLatestRelease(client *http.Client) (*githubRelease, error) {
+	req, err := http.NewRequest("GET", releasesURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "shippingmanager-alertbot/"+currentVersion())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("GitHub request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GitHub response: %w", err)
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("GitHub returned status %d", resp.StatusCode)
+	}
+
+	var release githubRelease
+	if err := json.Unmarshal(body, &release); err != nil {
+		return nil, fmt.Errorf("failed to parse GitHub response: %w", err)
+	}
+	if release.TagName == "" {
+		return nil, fmt.Errorf("GitHub response has no tag_name")
+	}
+
+	return &release, nil
+}
+
+// isNewerVersion reports whether version a ("v1.2.3") is newer than b.
+// Missing or non-numeric parts count as 0.
+func isNewerVersion(a, b string) bool {
+	pa, pb := versionParts(a), versionParts(b)
+	for i := range pa {
+		if pa[i] != pb[i] {
+			return pa[i] > pb[i]
+		}
+	}
+	return false
+}
+
+// versionParts splits "v1.2.3" into its major, minor and patch numbers
+func versionParts(v string) [3]int {
+	var parts [3]int
+	for i, p := range strings.SplitN(strings.TrimPrefix(strings.TrimSpace(v), "v"), ".", 3) {
+		n, _ := strconv.Atoi(p)
+		parts[i] = n
+	}
+	return parts
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// velocityWindow is how many recent slot prices the fuel velocity is computed over
+const velocityWindow = 4
+
+// slotPrice is the fuel price seen for a slot, keyed like the dedup slot key
+type slotPrice struct {
+	Slot  string `json:"slot"`
+	Price int    `json:"price"`
+}
+
+// recordRecentFuel appends the slot's fuel price, once per slot, keeping the
+// last velocityWindow entries
+func recordRecentFuel(cd *cooldown, slotKey string, price int) {
+	if n := len(cd.recentFuel); n > 0 && cd.recentFuel[n-1].Slot == slotKey {
+		cd.recentFuel[n-1].Price = price
+		return
+	}
+	cd.recentFuel = append(cd.recentFuel, slotPrice{Slot: slotKey, Price: price})
+	if len(cd.recentFuel) > velocityWindow {
+		cd.recentFuel = cd.recentFuel[len(cd.recentFuel)-velocityWindow:]
+	}
+}
+
+// fuelVelocity returns the average fuel price change per slot over the given
+// prices, false when there are fewer than two
+func fuelVelocity(prices []slotPrice) (float64, bool) {
+	if len(prices) < 2 {
+		return 0, false
+	}
+	first, last := prices[0].Price, prices[len(prices)-1].Price
+	return float64(last-first) / float64(len(prices)-1), true
+}
+
+// checkVelocity alerts when fuel falls faster than FUEL_VELOCITY $/slot (wait
+// for the bottom), or when a fall reverses upward by at least as much (buy
+// now). Each slot alerts at most once.
+func checkVelocity(client *http.Client, cfg *Config, cd *cooldown, slot *PriceSlot, slotKey string) {
+	if slot.FuelPrice <= 0 {
+		return
+	}
+	recordRecentFuel(cd, slotKey, slot.FuelPrice)
+	if cfg.FuelVelocity <= 0 || cd.lastVelocity == slotKey {
+		return
+	}
+
+	velocity, ok := fuelVelocity(cd.recentFuel)
+	if !ok {
+		return
+	}
+	n := len(cd.recentFuel)
+	step := cd.recentFuel[n-1].Price - cd.recentFuel[n-2].Price
+	before, falling := fuelVelocity(cd.recentFuel[:n-1])
+	falling = falling && before <= -float64(cfg.FuelVelocity)
+
+	var message string
+	switch {
+	case falling && step >= cfg.FuelVelocity:
+		message = fmt.Sprintf("*📈 Fuel turned upward, Captain!*\n\nAfter falling $%.0f/slot, fuel rose %s in the last slot to *%s*.\n\nThe bottom may be in, a good time to buy.",
+			-before, formatPrice(cfg, step), formatPrice(cfg, slot.FuelPrice))
+	case velocity <= -float64(cfg.FuelVelocity):
+		message = fmt.Sprintf("*📉 Fuel is falling fast, Captain!*\n\nFuel is dropping $%.0f/slot over the last %d slots, now *%s*.\n\nConsider waiting for the bottom.",
+			-velocity, n-1, formatPrice(cfg, slot.FuelPrice))
+	default:
+		return
+	}
+
+	message += gameLink(cfg)
+	if err := notify(client, cfg, message); err != nil {
+		log.Printf("ERROR sending velocity alert: %s", err)
+		cd.stats.SendErrors++
+		cd.recordError(err)
+		return
+	}
+	cd.lastVelocity = slotKey
+	log.Printf("Fuel velocity alert sent (%.1f $/slot, slot %s)", velocity, slotKey)
+}
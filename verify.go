@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// telegramBot is the getMe result
+type telegramBot struct {
+	Username string `json:"username"`
+}
+
+// verifyTelegram calls getMe once per VERIFY_TELEGRAM_INTERVAL to catch a
+// revoked bot token before an alert is due. A failure can't be reported over
+// Telegram, so it is logged and shown in the status file.
+func verifyTelegram(client *http.Client, cfg *Config, cd *cooldown) {
+	if !cfg.VerifyTelegram {
+		return
+	}
+
+	cd.mu.Lock()
+	if time.Since(cd.telegramVerifiedAt) < cfg.VerifyInterval {
+		cd.mu.Unlock()
+		return
+	}
+	cd.telegramVerifiedAt = time.Now()
+	cd.mu.Unlock()
+
+	username, err := telegramGetMe(client, cfg)
+
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+	if err != nil {
+		log.Printf("ERROR: Telegram bot check failed, alerts can't be delivered: %s", err)
+		cd.telegramError = err.Error()
+		cd.recordError(err)
+		return
+	}
+	if cd.telegramError != "" || cd.telegramUsername == "" {
+		log.Printf("Telegram bot check passed: @%s", username)
+	}
+	cd.telegramUsername = username
+	cd.telegramError = ""
+}
+
+// telegramGetMe returns the bot's username, failing when the token is rejected
+func telegramGetMe(client *http.Client, cfg *Config) (string, error) {
+	result, err := telegramGet(client, cfg, "getMe", nil)
+	if err != nil {
+		return "", err
+	}
+
+	var bot telegramBot
+	if err := json.Unmarshal(result, &bot); err != nil {
+		return "", fmt.Errorf("failed to parse getMe result: %w", err)
+	}
+	return bot.Username, nil
+}
+
+// telegramChat is the part of the getChat result logged by VERIFY_CHAT
+type telegramChat struct {
+	Title    string `json:"title"`
+	Username string `json:"username"`
+	Type     string `json:"type"`
+}
+
+// verifyChat checks with getChat that the bot can reach the configured chat,
+// catching a wrong TELEGRAM_CHAT_ID or a bot that isn't in the group yet
+func verifyChat(client *http.Client, cfg *Config) error {
+	chatID := targetChatID(cfg)
+	result, err := telegramGet(client, cfg, "getChat", url.Values{"chat_id": {chatID}})
+	if err != nil {
+		return fmt.Errorf("bot can't access chat %s, check TELEGRAM_CHAT_ID and that the bot was added to the group or channel: %w", chatID, err)
+	}
+
+	var chat telegramChat
+	if err := json.Unmarshal(result, &chat); err != nil {
+		return fmt.Errorf("failed to parse getChat result: %w", err)
+	}
+	name := chat.Title
+	if name == "" {
+		name = "@" + chat.Username
+	}
+	log.Printf("Chat check passed: %s %q (%s)", chat.Type, name, chatID)
+	return nil
+}
+
+// telegramGet calls a Bot API method and returns its result, failing on an API error
+func telegramGet(client *http.Client, cfg *Config, method string, params url.Values) (json.RawMessage, error) {
+	apiURL := fmt.Sprintf("https://api.telegram.org/bot%s/%s", cfg.TelegramBotToken, method)
+	if len(params) > 0 {
+		apiURL += "?" + params.Encode()
+	}
+	resp, err := client.Get(apiURL)
+	if err != nil {
+		return nil, fmt.Errorf("Telegram request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := readResponseBody(resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Telegram response: %w", err)
+	}
+
+	var tgResp TelegramResponse
+	if err := json.Unmarshal(body, &tgResp); err != nil {
+		return nil, fmt.Errorf("failed to parse Telegram response: %w", err)
+	}
+	if !tgResp.OK {
+		return nil, fmt.Errorf("Telegram API error: %s", tgResp.Description)
+	}
+	return tgResp.Result, nil
+}
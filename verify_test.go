@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// telegramAPI serves canned Bot API responses by method name and counts the calls
+func telegramAPI(t *testing.T, responses map[string]string) (*http.Client, *atomic.Int32) {
+	var calls atomic.Int32
+	client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		body, ok := responses[method]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	return client, &calls
+}
+
+func TestVerifyTelegram(t *testing.T) {
+	tests := []struct {
+		name         string
+		response     string
+		wantUsername string
+		wantError    string
+	}{
+		{"valid token", `{"ok":true,"result":{"id":1,"is_bot":true,"username":"price_bot"}}`, "price_bot", ""},
+		{"revoked token", `{"ok":false,"error_code":401,"description":"Unauthorized"}`, "", "Unauthorized"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, calls := telegramAPI(t, map[string]string{"getMe": tt.response})
+			cfg := &Config{TelegramBotToken: "123:abc", VerifyTelegram: true, VerifyInterval: time.Hour}
+			cd := &cooldown{store: &memoryStore{}}
+
+			verifyTelegram(client, cfg, cd)
+			if cd.telegramUsername != tt.wantUsername {
+				t.Errorf("username = %q, want %q", cd.telegramUsername, tt.wantUsername)
+			}
+			if !strings.Contains(cd.telegramError, tt.wantError) || (tt.wantError == "") != (cd.telegramError == "") {
+				t.Errorf("error = %q, want %q", cd.telegramError, tt.wantError)
+			}
+
+			// The next call within VERIFY_TELEGRAM_INTERVAL doesn't ask again
+			verifyTelegram(client, cfg, cd)
+			if n := calls.Load(); n != 1 {
+				t.Errorf("getMe called %d times, want 1 within the interval", n)
+			}
+		})
+	}
+}
+
+func TestVerifyTelegramRecovers(t *testing.T) {
+	responses := map[string]string{"getMe": `{"ok":false,"description":"Unauthorized"}`}
+	client, calls := telegramAPI(t, responses)
+	cfg := &Config{TelegramBotToken: "123:abc", VerifyTelegram: true, VerifyInterval: time.Hour}
+	cd := &cooldown{store: &memoryStore{}}
+
+	verifyTelegram(client, cfg, cd)
+	if cd.telegramError == "" {
+		t.Fatal("a rejected token left no error")
+	}
+
+	// Once the interval passed, a working token clears the error again
+	responses["getMe"] = `{"ok":true,"result":{"username":"price_bot"}}`
+	cd.telegramVerifiedAt = time.Now().Add(-2 * time.Hour)
+	verifyTelegram(client, cfg, cd)
+	if cd.telegramError != "" || cd.telegramUsername != "price_bot" || calls.Load() != 2 {
+		t.Errorf("after recovery: error %q, username %q, %d calls", cd.telegramError, cd.telegramUsername, calls.Load())
+	}
+}
+
+func TestVerifyTelegramDisabled(t *testing.T) {
+	client, calls := telegramAPI(t, nil)
+	verifyTelegram(client, &Config{VerifyInterval: time.Hour}, &cooldown{store: &memoryStore{}})
+	if n := calls.Load(); n != 0 {
+		t.Errorf("getMe called %d times without VERIFY_TELEGRAM", n)
+	}
+}
+
+func TestVerifyChat(t *testing.T) {
+	tests := []struct {
+		name      string
+		response  string
+		wantError string
+	}{
+		{"group", `{"ok":true,"result":{"id":-1001,"title":"Fuel desk","type":"supergroup"}}`, ""},
+		{"channel by username", `{"ok":true,"result":{"id":-1001,"username":"fuel_prices","type":"channel"}}`, ""},
+		{"wrong chat ID", `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`, "chat not found"},
+		{"bot not in group", `{"ok":false,"error_code":403,"description":"Forbidden: bot is not a member of the supergroup chat"}`, "bot is not a member"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var chatID string
+			client := testClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !strings.HasSuffix(r.URL.Path, "/getChat") {
+					http.NotFound(w, r)
+					return
+				}
+				chatID = r.URL.Query().Get("chat_id")
+				w.Write([]byte(tt.response))
+			}))
+
+			// A numeric-only chat ID is sent as a group ID
+			err := verifyChat(client, &Config{TelegramBotToken: "123:abc", TelegramChatID: "1001"})
+			if chatID != "-1001" {
+				t.Errorf("getChat chat_id = %q, want -1001", chatID)
+			}
+			switch {
+			case tt.wantError == "" && err != nil:
+				t.Errorf("verifyChat: %v", err)
+			case tt.wantError != "" && (err == nil || !strings.Contains(err.Error(), tt.wantError) || !strings.Contains(err.Error(), "TELEGRAM_CHAT_ID")):
+				t.Errorf("verifyChat error = %v, want %q with a TELEGRAM_CHAT_ID hint", err, tt.wantError)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// thresholdOverride is a temporary threshold set with /watch, active until expiry
+type thresholdOverride struct {
+	Price int    `json:"price"`
+	Until string `json:"until"`
+}
+
+// effectiveThresholds returns the thresholds in force at now, /watch overrides
+// included. Caller must hold cd.mu.
+func effectiveThresholds(cfg *Config, cd *cooldown, now time.Time) (int, int) {
+	fuel, co2 := cfg.FuelThreshold, cfg.CO2Threshold
+	if cd.watchFuel != nil && now.Before(parseStateTime(cd.watchFuel.Until)) {
+		fuel = cd.watchFuel.Price
+	}
+	if cd.watchCO2 != nil && now.Before(parseStateTime(cd.watchCO2.Until)) {
+		co2 = cd.watchCO2.Price
+	}
+	return fuel, co2
+}
+
+// expireWatches drops overrides whose time is up, so checks revert to the configured thresholds
+func expireWatches(cfg *Config, cd *cooldown, now time.Time) {
+	if cd.watchFuel != nil && !now.Before(parseStateTime(cd.watchFuel.Until)) {
+		log.Printf("Fuel threshold override expired, back to $%d/t", cfg.FuelThreshold)
+		cd.watchFuel = nil
+	}
+	if cd.watchCO2 != nil && !now.Before(parseStateTime(cd.watchCO2.Until)) {
+		log.Printf("CO2 threshold override expired, back to $%d/t", cfg.CO2Threshold)
+		cd.watchCO2 = nil
+	}
+}
+
+// handleWatch temporarily overrides a threshold.
+// Usage: /watch fuel|co2 PRICE DURATION, or /watch fuel|co2 off to revert early.
+func handleWatch(ctx context.Context, client *http.Client, cfg *Config, cd *cooldown, args []string) string {
+	const usage = "Usage: /watch fuel|co2 PRICE DURATION (e.g. /watch fuel 400 2h), or /watch fuel|co2 off"
+	if len(args) < 2 {
+		return usage
+	}
+
+	what := strings.ToLower(args[0])
+	if what != "fuel" && what != "co2" {
+		return usage
+	}
+	label := "Fuel"
+	if what == "co2" {
+		label = "CO2"
+	}
+
+	cd.mu.Lock()
+	defer cd.mu.Unlock()
+
+	target := &cd.watchFuel
+	configured := cfg.FuelThreshold
+	if what == "co2" {
+		target = &cd.watchCO2
+		configured = cfg.CO2Threshold
+	}
+
+	if strings.EqualFold(args[1], "off") {
+		*target = nil
+		saveCooldown(cd)
+		log.Printf("%s threshold override removed via command", label)
+		return fmt.Sprintf("%s threshold back to %s.", label, formatPrice(cfg, configured))
+	}
+
+	if len(args) != 3 {
+		return usage
+	}
+	price, err := strconv.Atoi(args[1])
+	if err != nil || price <= 0 {
+		return "The price must be a positive whole number, e.g. /watch fuel 400 2h"
+	}
+	d, err := time.ParseDuration(args[2])
+	if err != nil || d <= 0 {
+		return "The duration must be like 30m, 2h or 1h30m"
+	}
+	if d > 7*24*time.Hour {
+		return "The duration can be at most 168h (7 days)"
+	}
+
+	until := time.Now().Add(d)
+	*target = &thresholdOverride{Price: price, Until: formatStateTime(until)}
+	saveCooldown(cd)
+
+	log.Printf("%s threshold overridden via command: $%d/t until %s", label, price, formatCooldownTime(until, cfg.Timezone))
+	return fmt.Sprintf("%s threshold set to %s for %s, until %s. Then back to %s.",
+		label, formatPrice(cfg, price), formatDuration(d),
+		until.In(cfg.Timezone).Format("15:04 MST"), formatPrice(cfg, configured))
+}